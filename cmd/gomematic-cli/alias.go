@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// FilterAliases drops all aliases which would shadow builtin or plugin
+// commands and prints a warning for each of them.
+func FilterAliases(aliases map[string]string, commands []*cli.Command) map[string]string {
+	reserved := map[string]bool{
+		"help": true,
+		"h":    true,
+	}
+
+	for _, cmd := range commands {
+		for _, name := range cmd.Names() {
+			reserved[name] = true
+		}
+	}
+
+	result := make(map[string]string, len(aliases))
+
+	for name, command := range aliases {
+		if reserved[name] {
+			logger.Warnf("alias %s shadows a builtin command, ignoring it", name)
+			continue
+		}
+
+		result[name] = command
+	}
+
+	return result
+}
+
+// AliasCommands wraps the aliases into commands to list them within help,
+// the aliases get expanded before parsing so these actions never run.
+func AliasCommands(aliases map[string]string) []*cli.Command {
+	names := make([]string, 0, len(aliases))
+
+	for name := range aliases {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	result := make([]*cli.Command, 0, len(names))
+
+	for _, name := range names {
+		name := name
+
+		result = append(result, &cli.Command{
+			Name:            name,
+			Usage:           fmt.Sprintf("alias for %s", aliases[name]),
+			Category:        "Aliases",
+			SkipFlagParsing: true,
+			HideHelp:        true,
+			Action: func(c *cli.Context) error {
+				logger.Errorf("failed to expand alias %s", name)
+				os.Exit(1)
+
+				return nil
+			},
+		})
+	}
+
+	return result
+}
+
+// ExpandAlias replaces the first command of the arguments if it matches an
+// alias. Positional parameters like $1 get substituted by the following
+// arguments, $@ inserts all of them, and unused arguments get appended.
+func ExpandAlias(args []string, aliases map[string]string, flags []cli.Flag) ([]string, error) {
+	pos := aliasPosition(args, flags)
+
+	if pos < 0 {
+		return args, nil
+	}
+
+	name := args[pos]
+	command, ok := aliases[name]
+
+	if !ok {
+		return args, nil
+	}
+
+	words, err := splitCommandLine(command)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid alias %s: %s", name, err)
+	}
+
+	params := args[pos+1:]
+	used := make(map[int]bool)
+	expanded := make([]string, 0, len(words)+len(params))
+
+	for _, word := range words {
+		if word == "$@" {
+			for i, param := range params {
+				used[i] = true
+				expanded = append(expanded, param)
+			}
+
+			continue
+		}
+
+		replaced, err := substituteParams(word, params, used)
+
+		if err != nil {
+			return nil, fmt.Errorf("alias %s %s", name, err)
+		}
+
+		expanded = append(expanded, replaced)
+	}
+
+	for i, param := range params {
+		if !used[i] {
+			expanded = append(expanded, param)
+		}
+	}
+
+	result := make([]string, 0, pos+len(expanded))
+	result = append(result, args[:pos]...)
+	result = append(result, expanded...)
+
+	return result, nil
+}
+
+// aliasPosition detects the index of the first command, skipping all global
+// flags and their values.
+func aliasPosition(args []string, flags []cli.Flag) int {
+	bools := map[string]bool{
+		"help":    true,
+		"h":       true,
+		"version": true,
+	}
+
+	for _, flag := range flags {
+		switch flag.(type) {
+		case *cli.BoolFlag:
+			for _, name := range flag.Names() {
+				bools[name] = true
+			}
+		case *CountFlag:
+			for _, name := range flag.Names() {
+				bools[name] = true
+
+				if len(name) == 1 {
+					bools[name+name] = true
+					bools[name+name+name] = true
+				}
+			}
+		}
+	}
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			return -1
+		}
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return i
+		}
+
+		name := strings.TrimLeft(arg, "-")
+
+		if strings.Contains(name, "=") || bools[name] {
+			continue
+		}
+
+		i++
+	}
+
+	return -1
+}
+
+// substituteParams replaces all $N references within a word.
+func substituteParams(word string, params []string, used map[int]bool) (string, error) {
+	var result strings.Builder
+
+	for i := 0; i < len(word); i++ {
+		if word[i] != '$' || i+1 == len(word) || word[i+1] < '0' || word[i+1] > '9' {
+			result.WriteByte(word[i])
+			continue
+		}
+
+		end := i + 1
+
+		for end < len(word) && word[end] >= '0' && word[end] <= '9' {
+			end++
+		}
+
+		num, _ := strconv.Atoi(word[i+1 : end])
+
+		if num < 1 || num > len(params) {
+			return "", fmt.Errorf("requires at least %d arguments", num)
+		}
+
+		used[num-1] = true
+		result.WriteString(params[num-1])
+		i = end - 1
+	}
+
+	return result.String(), nil
+}
+
+// splitCommandLine splits a command line into words, respecting single and
+// double quotes as well as backslash escapes.
+func splitCommandLine(line string) ([]string, error) {
+	var (
+		result  []string
+		current strings.Builder
+		quote   rune
+		escaped bool
+		started bool
+	)
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			started = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			started = true
+		case r == ' ' || r == '\t':
+			if started {
+				result = append(result, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape")
+	}
+
+	if started {
+		result = append(result, current.String())
+	}
+
+	return result, nil
+}
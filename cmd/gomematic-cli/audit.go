@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gomematic/gomematic-go/models"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// tmplAuditLog represents a single entry within the audit journal.
+var tmplAuditLog = "ID: \x1b[33m{{ .ID }} \x1b[0m" + `
+Time: {{ .Time.Format "2006-01-02 15:04:05 MST" }}
+Operator: {{ .Operator }}
+Server: {{ .Server }}{{ with .Context }} ({{ . }}){{ end }}
+Command: {{ join " " .Args }}
+Targets: {{ join ", " .Targets }}
+Outcome: {{ .Outcome }}{{ with .Error }}, {{ . }}{{ end }}
+`
+
+// auditMutations defines the command names which modify records.
+var auditMutations = map[string]bool{
+	"create":   true,
+	"update":   true,
+	"delete":   true,
+	"append":   true,
+	"perm":     true,
+	"remove":   true,
+	"sync":     true,
+	"clone":    true,
+	"transfer": true,
+	"restore":  true,
+	"undo":     true,
+	"import":   true,
+}
+
+// AuditEntry represents a single mutating command within the journal.
+type AuditEntry struct {
+	ID       string           `json:"id"`
+	Time     time.Time        `json:"time"`
+	Operator string           `json:"operator"`
+	Server   string           `json:"server"`
+	Context  string           `json:"context,omitempty"`
+	Command  []string         `json:"command"`
+	Args     []string         `json:"args"`
+	Targets  []string         `json:"targets"`
+	Before   *AuditSnapshot   `json:"before,omitempty"`
+	After    *AuditSnapshot   `json:"after,omitempty"`
+	Batch    []*AuditSnapshot `json:"batch,omitempty"`
+	Outcome  string           `json:"outcome"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// AuditSnapshot represents the state of the affected record.
+type AuditSnapshot struct {
+	User    *models.User       `json:"user,omitempty"`
+	Team    *models.Team       `json:"team,omitempty"`
+	Profile *models.Profile    `json:"profile,omitempty"`
+	Members []*models.TeamUser `json:"members,omitempty"`
+}
+
+// recordID returns the id of the recorded user or team, it returns an empty
+// string if the record has not been available.
+func (s *AuditSnapshot) recordID() string {
+	switch {
+	case s == nil:
+		return ""
+	case s.User != nil:
+		return s.User.ID.String()
+	case s.Team != nil:
+		return s.Team.ID.String()
+	default:
+		return ""
+	}
+}
+
+// Audit provides the sub-command for the audit journal.
+func Audit() *cli.Command {
+	return &cli.Command{
+		Name:  "audit",
+		Usage: "audit journal commands",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "log",
+				Usage:     "query the local audit journal",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "only entries after a duration like 24h or a date",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Usage: "only entries before a duration like 24h or a date",
+					},
+					&cli.StringFlag{
+						Name:  "target",
+						Usage: "only entries affecting this id or slug",
+					},
+					&cli.StringFlag{
+						Name:  "operator",
+						Usage: "only entries executed by this os user",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "export matching entries as json lines",
+					},
+					&cli.StringFlag{
+						Name:   "format",
+						Value:  tmplAuditLog,
+						Usage:  "custom output format",
+						Hidden: true,
+					},
+				},
+				Action: AuditLog,
+			},
+		},
+	}
+}
+
+// AuditLog provides the sub-command to query the audit journal.
+func AuditLog(c *cli.Context) error {
+	since, err := parseAuditTime(c.String("since"))
+
+	if err != nil {
+		logger.Errorf("invalid since: %s", err)
+		os.Exit(1)
+	}
+
+	until, err := parseAuditTime(c.String("until"))
+
+	if err != nil {
+		logger.Errorf("invalid until: %s", err)
+		os.Exit(1)
+	}
+
+	records, err := readAudit(auditPath(c))
+
+	if err != nil {
+		logger.Errorf("failed to read audit journal: %s", err)
+		os.Exit(2)
+	}
+
+	result := make([]*AuditEntry, 0, len(records))
+
+	for _, record := range records {
+		if !since.IsZero() && record.Time.Before(since) {
+			continue
+		}
+
+		if !until.IsZero() && record.Time.After(until) {
+			continue
+		}
+
+		if val := c.String("operator"); val != "" && record.Operator != val {
+			continue
+		}
+
+		if val := c.String("target"); val != "" && !containsString(record.Targets, val) {
+			continue
+		}
+
+		result = append(result, record)
+	}
+
+	if len(result) == 0 {
+		logger.Info("empty result")
+		return nil
+	}
+
+	if c.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+
+		for _, record := range result {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	tmpl, err := template.New(
+		"_",
+	).Funcs(
+		globalFuncMap,
+	).Funcs(
+		sprigFuncMap,
+	).Parse(
+		fmt.Sprintln(c.String("format")),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	for _, record := range result {
+		if err := tmpl.Execute(os.Stdout, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// auditPath returns the path of the audit journal.
+func auditPath(c *cli.Context) string {
+	if val := c.String("audit-log"); val != "" {
+		return val
+	}
+
+	return filepath.Join(configDir(), "audit.jsonl")
+}
+
+// auditBegin prepares the journal entry and records the state before the
+// command runs, it returns nil for commands which do not modify anything.
+func auditBegin(ctx context.Context, c *cli.Context, client *Client) *AuditEntry {
+	command := commandPath(c)
+
+	if !isMutation(command) || c.Bool("dry-run") {
+		return nil
+	}
+
+	args, ok := c.App.Metadata["args"].([]string)
+
+	if !ok {
+		args = os.Args
+	}
+
+	entry := &AuditEntry{
+		ID:       auditID(),
+		Time:     time.Now().UTC(),
+		Operator: auditOperator(),
+		Server:   c.String("server"),
+		Context:  c.String("context"),
+		Command:  command,
+		Args:     redactArgs(args),
+		Targets:  auditTargets(c, command),
+	}
+
+	entry.Before = auditSnapshot(ctx, c, client, command, auditSubject(c, command))
+
+	// commands accepting multiple ids record the state of the further ids
+	// separately, the primary id keeps its place within before and after.
+	if ids, _ := identifierParams(c); len(ids) > 1 {
+		entry.Batch = make([]*AuditSnapshot, len(ids)-1)
+
+		parallel(ctx, batchConcurrency, len(ids)-1, func(ctx context.Context, i int) error {
+			entry.Batch[i] = auditSnapshot(ctx, c, client, command, ids[i+1])
+			return nil
+		})
+	}
+
+	return entry
+}
+
+// isMutation checks if the command modifies records.
+func isMutation(command []string) bool {
+	if len(command) == 0 {
+		return false
+	}
+
+	return auditMutations[command[0]] || auditMutations[command[len(command)-1]]
+}
+
+// auditFinish records the state after the command and appends the entry to
+// the journal, failing to write the journal only prints a warning.
+func auditFinish(c *cli.Context, client *Client, entry *AuditEntry, err error) {
+	if entry == nil {
+		return
+	}
+
+	ctx, cancel := timeoutContext(context.Background(), c.Duration("timeout"))
+	defer cancel()
+
+	subject := auditSubject(c, entry.Command)
+
+	// the record id stays the same even if the command changed the slug of
+	// the record which has been used as identifier.
+	if id := entry.Before.recordID(); id != "" {
+		subject = id
+	}
+
+	entry.After = auditSnapshot(ctx, c, client, entry.Command, subject)
+	auditWrite(c, entry, err, RootContext(c).Err() != nil)
+}
+
+// auditWrite records the outcome and appends the entry to the journal.
+func auditWrite(c *cli.Context, entry *AuditEntry, err error, interrupted bool) {
+	switch {
+	case err == nil:
+		entry.Outcome = "success"
+	case interrupted:
+		entry.Outcome = "interrupted"
+		entry.Error = Redact(err.Error())
+	default:
+		entry.Outcome = "failure"
+		entry.Error = Redact(err.Error())
+	}
+
+	if err := appendAudit(auditPath(c), entry); err != nil {
+		logger.Warnf("failed to write audit journal: %s", err)
+	}
+}
+
+// auditSnapshot fetches the record affected by the command, errors like a
+// not yet created or already deleted record result in an empty snapshot.
+func auditSnapshot(ctx context.Context, c *cli.Context, client *Client, command []string, id string) *AuditSnapshot {
+	result := &AuditSnapshot{}
+
+	switch command[0] {
+	case "user":
+		record, err := showUser(ctx, client, id)
+
+		if err != nil {
+			return nil
+		}
+
+		record.Password = nil
+		result.User = record
+		result.Members, _ = userTeams(ctx, client, id)
+	case "team":
+		record, err := showTeam(ctx, client, id)
+
+		if err != nil {
+			return nil
+		}
+
+		result.Team = record
+		result.Members, _ = teamUsers(ctx, client, id)
+	case "profile":
+		record, err := showProfile(ctx, client)
+
+		if err != nil {
+			return nil
+		}
+
+		record.Password = nil
+		result.Profile = record
+	default:
+		return nil
+	}
+
+	return result
+}
+
+// auditSubject detects the id or slug of the primary record, for created
+// records the slug or name is the only known identifier.
+func auditSubject(c *cli.Context, command []string) string {
+	if len(command) > 1 && (command[1] == "create" || command[1] == "clone") {
+		for _, name := range []string{"slug", "username", "name"} {
+			if val := c.String(name); val != "" {
+				return val
+			}
+		}
+	}
+
+	if ids, _ := identifierParams(c); len(ids) > 0 {
+		return ids[0]
+	}
+
+	return ""
+}
+
+// auditTargets collects all ids or slugs affected by the command.
+func auditTargets(c *cli.Context, command []string) []string {
+	result := make([]string, 0)
+
+	if val := auditSubject(c, command); val != "" {
+		result = append(result, val)
+	}
+
+	if ids, _ := identifierParams(c); len(ids) > 1 {
+		result = append(result, ids[1:]...)
+	}
+
+	if len(command) > 1 && command[1] == "clone" && c.String("id") != "" {
+		result = append(result, c.String("id"))
+	}
+
+	for _, flag := range c.Command.Flags {
+		name := flag.Names()[0]
+
+		if name != "user" && name != "team" && name != "to" {
+			continue
+		}
+
+		switch flag.(type) {
+		case *cli.StringFlag:
+			if val := c.String(name); val != "" {
+				result = append(result, val)
+			}
+		case *cli.StringSliceFlag:
+			for _, val := range c.StringSlice(name) {
+				result = append(result, strings.SplitN(val, ":", 2)[0])
+			}
+		}
+	}
+
+	return result
+}
+
+// commandPath returns the names of the executed command, without the name
+// of the binary itself, like user team append.
+func commandPath(c *cli.Context) []string {
+	if c.Command == nil {
+		return nil
+	}
+
+	names := strings.Fields(c.App.Name)
+
+	if len(names) > 0 {
+		names = names[1:]
+	}
+
+	return append(names, c.Command.Name)
+}
+
+// redactArgs replaces the values of all secret flags.
+func redactArgs(args []string) []string {
+	result := make([]string, len(args))
+
+	for i, arg := range args {
+		result[i] = Redact(arg)
+	}
+
+	for i := 0; i < len(result); i++ {
+		if !strings.HasPrefix(result[i], "-") {
+			continue
+		}
+
+		name := strings.TrimLeft(result[i], "-")
+
+		if parts := strings.SplitN(name, "=", 2); len(parts) == 2 {
+			if secretFlags[parts[0]] {
+				result[i] = strings.TrimSuffix(result[i], parts[1]) + secretRedacted
+			}
+
+			continue
+		}
+
+		if secretFlags[name] && i+1 < len(result) {
+			result[i+1] = secretRedacted
+			i++
+		}
+	}
+
+	return result
+}
+
+// appendAudit writes a single entry as json line to the journal.
+func appendAudit(name string, entry *AuditEntry) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	line, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// readAudit parses all entries of the journal, a missing file is not an
+// error.
+func readAudit(name string) ([]*AuditEntry, error) {
+	file, err := os.Open(name)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer file.Close()
+
+	result := make([]*AuditEntry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for num := 1; scanner.Scan(); num++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		record := &AuditEntry{}
+
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, num, err)
+		}
+
+		result = append(result, record)
+	}
+
+	return result, scanner.Err()
+}
+
+// parseAuditTime parses either a duration relative to now or a date.
+func parseAuditTime(val string) (time.Time, error) {
+	if val == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(val); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, val, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("expected a duration like 24h or a date like 2006-01-02")
+}
+
+// auditOperator detects the name of the local os user.
+func auditOperator() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+
+	return os.Getenv("USER")
+}
+
+// auditID generates a random identifier for a journal entry.
+func auditID() string {
+	buf := make([]byte, 8)
+
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// containsString checks if the list contains the value.
+func containsString(list []string, val string) bool {
+	for _, row := range list {
+		if row == val {
+			return true
+		}
+	}
+
+	return false
+}
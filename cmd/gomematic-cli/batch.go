@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// ExitPartial defines the exit code if only some identifiers failed.
+const ExitPartial = 3
+
+// batchConcurrency defines the number of identifiers handled in parallel.
+const batchConcurrency = 8
+
+// BatchFunc executes a command for a single identifier, the output and the
+// messages of the logger get buffered to keep the order of the identifiers.
+type BatchFunc func(ctx context.Context, id string, stdout io.Writer, log *Logger) error
+
+// FetchOneFunc fetches the records rendered for a single identifier.
+type FetchOneFunc func(ctx context.Context, id string) ([]interface{}, error)
+
+// BatchError represents the summary of failed identifiers.
+type BatchError struct {
+	Failed []string
+	Total  int
+}
+
+// Error implements the error interface.
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d of %d failed: %s", len(e.Failed), e.Total, strings.Join(e.Failed, ", "))
+}
+
+// Partial checks if some of the identifiers succeeded.
+func (e *BatchError) Partial() bool {
+	return len(e.Failed) < e.Total
+}
+
+// batchResult represents the buffered output of a single identifier.
+type batchResult struct {
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	err    error
+	done   chan struct{}
+}
+
+// runBatch executes the function concurrently for all identifiers, the
+// output is printed in order of the identifiers. A single identifier
+// behaves like before and returns its error unchanged.
+func runBatch(ctx context.Context, ids []string, fn BatchFunc) error {
+	results := make([]*batchResult, len(ids))
+
+	for i := range results {
+		results[i] = &batchResult{
+			done: make(chan struct{}),
+		}
+	}
+
+	sem := make(chan struct{}, batchConcurrency)
+	wg := sync.WaitGroup{}
+
+	for i, id := range ids {
+		wg.Add(1)
+
+		go func(result *batchResult, id string) {
+			defer wg.Done()
+			defer close(result.done)
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				result.err = ctx.Err()
+				return
+			}
+
+			ctx, span := StartSpan(ctx, "item", SpanInternal)
+			span.SetAttribute("gomematic.id", id)
+
+			log := logger.Item(&result.stderr, "")
+
+			if len(ids) > 1 {
+				log = logger.Item(&result.stderr, id)
+			}
+
+			result.err = fn(ctx, id, &result.stdout, log)
+
+			if result.err != nil && len(ids) > 1 {
+				log.Error(result.err.Error())
+			}
+
+			span.SetError(result.err)
+			span.Finish()
+		}(results[i], id)
+	}
+
+	failed := make([]string, 0)
+
+	for i, result := range results {
+		<-result.done
+
+		os.Stdout.Write(result.stdout.Bytes())
+		os.Stderr.Write(result.stderr.Bytes())
+
+		if result.err != nil {
+			failed = append(failed, ids[i])
+		}
+	}
+
+	wg.Wait()
+
+	if len(ids) == 1 {
+		return results[0].err
+	}
+
+	if len(failed) > 0 {
+		return &BatchError{
+			Failed: failed,
+			Total:  len(ids),
+		}
+	}
+
+	return nil
+}
+
+// renderBatch renders the records of all identifiers with the format
+// template, in watch mode the records of all identifiers get refreshed
+// together.
+func renderBatch(ctx context.Context, c *cli.Context, fetch FetchOneFunc) error {
+	ids := GetIdentifierParams(c)
+
+	if c.Bool("watch") {
+		return renderRecords(ctx, c, func(ctx context.Context) ([]interface{}, error) {
+			records := make([][]interface{}, len(ids))
+
+			if err := parallel(ctx, batchConcurrency, len(ids), func(ctx context.Context, i int) error {
+				result, err := fetch(ctx, ids[i])
+
+				if err != nil {
+					return fmt.Errorf("%s: %s", ids[i], err)
+				}
+
+				records[i] = result
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+
+			result := make([]interface{}, 0)
+
+			for _, rows := range records {
+				result = append(result, rows...)
+			}
+
+			return result, nil
+		})
+	}
+
+	tmpl, err := parseFormat(c)
+
+	if err != nil {
+		return err
+	}
+
+	return runBatch(ctx, ids, func(ctx context.Context, id string, stdout io.Writer, log *Logger) error {
+		records, err := fetch(ctx, id)
+
+		if err != nil {
+			return err
+		}
+
+		if len(records) == 0 {
+			log.Info("empty result")
+			return nil
+		}
+
+		for _, record := range records {
+			if err := tmpl.Execute(stdout, record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomematic/gomematic-go/gomematic"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// cacheResource matches paths of users and teams including the identifier.
+var cacheResource = regexp.MustCompile(`^(.*/(?:users|teams))/([^/]+)(/.*)?$`)
+
+// cacheCollection matches paths listing all users or teams.
+var cacheCollection = regexp.MustCompile(`^(.*/(?:users|teams))$`)
+
+// cacheAllowed matches the list and show paths of users and teams including
+// their memberships, everything else like the profile never gets cached.
+var cacheAllowed = regexp.MustCompile(`^.*` + regexp.QuoteMeta(gomematic.DefaultBasePath) + `/(?:users(?:/[^/]+(?:/teams)?)?|teams(?:/[^/]+(?:/users)?)?)$`)
+
+// CacheEntry represents a single cached api response.
+type CacheEntry struct {
+	Key         string    `json:"key"`
+	Time        time.Time `json:"time"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	Partial     bool      `json:"partial,omitempty"`
+}
+
+// OfflineError represents a request which can not be served in offline mode.
+type OfflineError struct {
+	Method string
+	Path   string
+}
+
+// Error implements the error interface.
+func (e *OfflineError) Error() string {
+	if e.Method != http.MethodGet {
+		return fmt.Sprintf("offline mode, can not send %s %s", e.Method, e.Path)
+	}
+
+	return fmt.Sprintf("offline mode, %s is not cached", e.Path)
+}
+
+// cacheTransport stores successful read responses on disk and serves them
+// for cached and offline reads. Memberships span users and teams, so every
+// mutation clears the whole cache of the context. Responses are separated
+// by a hash of the token, so they are never served to another identity.
+type cacheTransport struct {
+	next     http.RoundTripper
+	dir      string
+	identity string
+	server   string
+	ttl      time.Duration
+	cached   bool
+	offline  bool
+
+	mu     sync.Mutex
+	oldest time.Time
+}
+
+// Cache provides the sub-command to manage the response cache.
+func Cache() *cli.Command {
+	return &cli.Command{
+		Name:  "cache",
+		Usage: "response cache commands",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "clear",
+				Usage:     "remove all cached responses",
+				ArgsUsage: " ",
+				Action:    CacheClear,
+			},
+		},
+	}
+}
+
+// CacheClear provides the sub-command to remove all cached responses.
+func CacheClear(c *cli.Context) error {
+	if err := os.RemoveAll(filepath.Join(configDir(), "cache")); err != nil {
+		logger.Errorf("failed to clear cache: %s", err)
+		os.Exit(1)
+	}
+
+	logger.Info("successfully cleared cache")
+	return nil
+}
+
+// newCacheTransport initializes the cache for the context of the command,
+// mutating commands never get served from the cache. Watch mode only reads
+// from the cache in offline mode, otherwise it would never see changes.
+func newCacheTransport(c *cli.Context, next http.RoundTripper) *cacheTransport {
+	name := c.String("context")
+
+	if name == "" {
+		name = "default"
+	}
+
+	bypass := isMutation(commandPath(c)) || (c.Bool("watch") && !c.Bool("offline"))
+	identity := sha256.Sum256([]byte(c.String("token")))
+
+	return &cacheTransport{
+		next:     next,
+		dir:      filepath.Join(configDir(), "cache", name),
+		identity: hex.EncodeToString(identity[:]),
+		server:   c.String("server"),
+		ttl:      c.Duration("cache-ttl"),
+		cached:   (c.Bool("cached") || c.Bool("offline")) && !bypass,
+		offline:  c.Bool("offline"),
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		if t.offline {
+			return nil, &OfflineError{Method: req.Method, Path: req.URL.Path}
+		}
+
+		resp, err := t.next.RoundTrip(req)
+
+		if err := t.Clear(); err != nil {
+			logger.Warnf("failed to clear cache: %s", err)
+		}
+
+		return resp, err
+	}
+
+	if !cacheAllowed.MatchString(req.URL.Path) {
+		if t.offline {
+			return nil, &OfflineError{Method: req.Method, Path: req.URL.Path}
+		}
+
+		return t.next.RoundTrip(req)
+	}
+
+	key := req.URL.Path
+
+	if req.URL.RawQuery != "" {
+		key = key + "?" + req.URL.RawQuery
+	}
+
+	if t.cached {
+		if entry := t.Lookup(key); entry != nil && (t.offline || (!entry.Partial && time.Since(entry.Time) <= t.ttl)) {
+			t.mu.Lock()
+
+			if t.oldest.IsZero() || entry.Time.Before(t.oldest) {
+				t.oldest = entry.Time
+			}
+
+			t.mu.Unlock()
+			logger.Trace("served from cache", "path", key, "age", time.Since(entry.Time).Round(time.Second))
+			SpanFromContext(req.Context()).SetAttribute("gomematic.cache", "hit")
+
+			if entry.Partial {
+				logger.Warnf("%s is only cached from a list, details like memberships are missing", key)
+			}
+
+			return &http.Response{
+				Status:        "200 OK",
+				StatusCode:    http.StatusOK,
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        http.Header{"Content-Type": []string{entry.ContentType}},
+				Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+				ContentLength: int64(len(entry.Body)),
+				Request:       req,
+			}, nil
+		}
+
+		if t.offline {
+			return nil, &OfflineError{Method: req.Method, Path: req.URL.Path}
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err := t.Store(key, resp.Header.Get("Content-Type"), body); err != nil {
+		logger.Warnf("failed to write cache: %s", err)
+	}
+
+	return resp, nil
+}
+
+// Banner prints a notice about the age of served cache entries.
+func (t *cacheTransport) Banner() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.oldest.IsZero() {
+		return
+	}
+
+	logger.Info(
+		"served from cache",
+		"age", time.Since(t.oldest).Round(time.Second),
+		"since", t.oldest.Local().Format("2006-01-02 15:04:05"),
+	)
+}
+
+// Lookup returns the cached entry of the key, identifiers of users and
+// teams get resolved between slug and id by the recorded aliases.
+func (t *cacheTransport) Lookup(key string) *CacheEntry {
+	if entry := t.read(key); entry != nil {
+		return entry
+	}
+
+	match := cacheResource.FindStringSubmatch(key)
+
+	if match == nil {
+		return nil
+	}
+
+	aliases := t.aliases()
+	alias, ok := aliases[match[1]+"/"+match[2]]
+
+	if !ok {
+		return nil
+	}
+
+	return t.read(match[1] + "/" + alias + match[3])
+}
+
+// Store writes the response, single users and teams as well as all
+// entries of lists record aliases between slug and id.
+func (t *cacheTransport) Store(key, contentType string, body []byte) error {
+	if err := t.write(&CacheEntry{Key: key, Time: time.Now(), ContentType: contentType, Body: body}); err != nil {
+		return err
+	}
+
+	type record struct {
+		ID   string `json:"id"`
+		Slug string `json:"slug"`
+	}
+
+	if match := cacheResource.FindStringSubmatch(key); match != nil && match[3] == "" {
+		val := record{}
+
+		if err := json.Unmarshal(body, &val); err != nil || val.ID == "" || val.Slug == "" {
+			return nil
+		}
+
+		return t.alias(match[1], [][2]string{{val.ID, val.Slug}})
+	}
+
+	if match := cacheCollection.FindStringSubmatch(key); match != nil {
+		list := make([]json.RawMessage, 0)
+
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil
+		}
+
+		pairs := make([][2]string, 0, len(list))
+
+		for _, raw := range list {
+			val := record{}
+
+			if err := json.Unmarshal(raw, &val); err != nil || val.ID == "" || val.Slug == "" {
+				continue
+			}
+
+			pairs = append(pairs, [2]string{val.ID, val.Slug})
+
+			// list entries are less detailed than the single records, so
+			// they are marked as partial and only served in offline mode.
+			if t.read(match[1]+"/"+val.ID) == nil {
+				if err := t.write(&CacheEntry{Key: match[1] + "/" + val.ID, Time: time.Now(), ContentType: contentType, Body: raw, Partial: true}); err != nil {
+					return err
+				}
+			}
+		}
+
+		return t.alias(match[1], pairs)
+	}
+
+	return nil
+}
+
+// Clear removes all cached responses of the context.
+func (t *cacheTransport) Clear() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return os.RemoveAll(t.dir)
+}
+
+// root returns the directory of the identity within the context.
+func (t *cacheTransport) root() string {
+	return filepath.Join(t.dir, t.identity)
+}
+
+// path returns the file of the key, the server is part of the hash as
+// contexts can be overridden by flags.
+func (t *cacheTransport) path(key string) string {
+	sum := sha256.Sum256([]byte(t.server + " " + key))
+	return filepath.Join(t.root(), hex.EncodeToString(sum[:])+".json")
+}
+
+// read loads the entry of the key, broken entries are treated as missing.
+func (t *cacheTransport) read(key string) *CacheEntry {
+	content, err := ioutil.ReadFile(t.path(key))
+
+	if err != nil {
+		return nil
+	}
+
+	entry := &CacheEntry{}
+
+	if err := json.Unmarshal(content, entry); err != nil || entry.Key != key {
+		return nil
+	}
+
+	return entry
+}
+
+// write persists the entry atomically with restricted permissions.
+func (t *cacheTransport) write(entry *CacheEntry) error {
+	content, err := json.Marshal(entry)
+
+	if err != nil {
+		return err
+	}
+
+	return t.writeFile(t.path(entry.Key), content)
+}
+
+// aliases loads the mapping between slugs and ids.
+func (t *cacheTransport) aliases() map[string]string {
+	result := make(map[string]string)
+	content, err := ioutil.ReadFile(filepath.Join(t.root(), "aliases.json"))
+
+	if err == nil {
+		json.Unmarshal(content, &result)
+	}
+
+	return result
+}
+
+// alias records the id and slug pairs in both directions.
+func (t *cacheTransport) alias(prefix string, pairs [][2]string) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	aliases := t.aliases()
+
+	for _, pair := range pairs {
+		aliases[prefix+"/"+pair[0]] = pair[1]
+		aliases[prefix+"/"+pair[1]] = pair[0]
+	}
+
+	content, err := json.Marshal(aliases)
+
+	if err != nil {
+		return err
+	}
+
+	return t.writeFile(filepath.Join(t.root(), "aliases.json"), content)
+}
+
+// writeFile writes the content via a temporary file and a rename.
+func (t *cacheTransport) writeFile(name string, content []byte) error {
+	if err := os.MkdirAll(t.root(), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(t.root(), strings.TrimSuffix(filepath.Base(name), ".json")+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheAllowed(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"/api/v1/users":              true,
+		"/api/v1/users/bob":          true,
+		"/api/v1/users/bob/teams":    true,
+		"/api/v1/teams":              true,
+		"/api/v1/teams/ops":          true,
+		"/api/v1/teams/ops/users":    true,
+		"/api/v1/profile/self":       false,
+		"/api/v1/profile/token":      false,
+		"/api/v1/users/bob/profile":  false,
+		"/api/v1/teams/ops/users/x":  false,
+		"/api/v1/users/bob/users":    false,
+		"/api/v1/teams/ops/teams":    false,
+		"/api/v1/users/bob/teams/xy": false,
+	} {
+		if cacheAllowed.MatchString(path) != expected {
+			t.Errorf("expected %s to be cacheable %v", path, expected)
+		}
+	}
+}
+
+func TestCacheTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/api/v1/profile/token":
+			w.Write([]byte(`{"token":"secret"}`))
+		default:
+			w.Write([]byte(`{"id":"1","slug":"` + r.Header.Get("X-API-Key") + `"}`))
+		}
+	}))
+
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "gomematic-cache")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	alice := testCacheTransport(dir, server.URL, "alice")
+	bob := testCacheTransport(dir, server.URL, "bob")
+
+	for _, path := range []string{"/api/v1/users/1", "/api/v1/profile/token"} {
+		testCacheGet(t, alice, server.URL+path, "alice")
+	}
+
+	if entry := alice.Lookup("/api/v1/users/1"); entry == nil || !strings.Contains(string(entry.Body), "alice") {
+		t.Errorf("expected cached user for the identity, got %v", entry)
+	}
+
+	if entry := bob.Lookup("/api/v1/users/1"); entry != nil {
+		t.Errorf("expected no cached user for another identity, got %s", entry.Body)
+	}
+
+	if entry := alice.Lookup("/api/v1/profile/token"); entry != nil {
+		t.Errorf("expected profile to be never cached, got %s", entry.Body)
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		content, err := ioutil.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		if strings.Contains(string(content), "secret") {
+			t.Errorf("expected no token within %s", path)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offline := testCacheTransport(dir, server.URL, "alice")
+	offline.cached = true
+	offline.offline = true
+
+	if body := testCacheGet(t, offline, server.URL+"/api/v1/users/1", "alice"); !strings.Contains(body, "alice") {
+		t.Errorf("expected offline read from cache, got %s", body)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/profile/self", nil)
+
+	if _, err := offline.RoundTrip(req); err == nil {
+		t.Errorf("expected offline profile read to fail")
+	}
+}
+
+// testCacheTransport initializes a cache transport for the token.
+func testCacheTransport(dir, server, token string) *cacheTransport {
+	identity := sha256.Sum256([]byte(token))
+
+	return &cacheTransport{
+		next:     http.DefaultTransport,
+		dir:      dir,
+		identity: hex.EncodeToString(identity[:]),
+		server:   server,
+		ttl:      time.Minute,
+	}
+}
+
+// testCacheGet requests the url via the transport and returns the body.
+func testCacheGet(t *testing.T, rt http.RoundTripper, url, token string) string {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-API-Key", token)
+	resp, err := rt.RoundTrip(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func TestCachePartial(t *testing.T) {
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/api/v1/teams":
+			w.Write([]byte(`[{"id":"1","slug":"ops"}]`))
+		default:
+			w.Write([]byte(`{"id":"1","slug":"ops","users":[]}`))
+		}
+	}))
+
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "gomematic-cache")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	testCacheGet(t, testCacheTransport(dir, server.URL, "alice"), server.URL+"/api/v1/teams", "alice")
+
+	offline := testCacheTransport(dir, server.URL, "alice")
+	offline.cached = true
+	offline.offline = true
+
+	if body := testCacheGet(t, offline, server.URL+"/api/v1/teams/ops", "alice"); body != `{"id":"1","slug":"ops"}` {
+		t.Errorf("expected partial record offline, got %s", body)
+	}
+
+	cached := testCacheTransport(dir, server.URL, "alice")
+	cached.cached = true
+
+	if body := testCacheGet(t, cached, server.URL+"/api/v1/teams/ops", "alice"); !strings.Contains(body, "users") {
+		t.Errorf("expected full record to be fetched, got %s", body)
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+
+	if body := testCacheGet(t, cached, server.URL+"/api/v1/teams/ops", "alice"); !strings.Contains(body, "users") || requests != 2 {
+		t.Errorf("expected full record from cache, got %s after %d requests", body, requests)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// Config represents the optional configuration file of the client.
+type Config struct {
+	Path     string
+	Context  string
+	Contexts map[string]*ConfigContext
+	Aliases  map[string]string
+	Password *PasswordPolicy
+}
+
+// ConfigContext represents a named server and token combination.
+type ConfigContext struct {
+	Server string
+	Token  string
+}
+
+// configDir returns the directory used for configuration and state, it
+// follows XDG_CONFIG_HOME and falls back to .config within the home.
+func configDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" && filepath.IsAbs(dir) {
+		return filepath.Join(dir, "gomematic")
+	}
+
+	if dir, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(dir, ".config", "gomematic")
+	}
+
+	return ".gomematic"
+}
+
+// configPath returns the path of the configuration file.
+func configPath() string {
+	if val := os.Getenv("GOMEMATIC_CONFIG"); val != "" {
+		return val
+	}
+
+	return filepath.Join(configDir(), "config")
+}
+
+// LoadConfig parses the configuration file, a missing file is not an error.
+// The file is using a git-config like syntax:
+//
+//	context = prod
+//
+//	[context "prod"]
+//	server = https://gomematic.example.com
+//	token = secret
+//
+//	[alias]
+//	onboard = "user team append --id $1 --team $2 --perm user"
+//
+//	[password]
+//	min-length = 12
+//	classes = 3
+//	deny = secret, company
+//	deny-file = /etc/gomematic/denied-passwords
+func LoadConfig(name string) (*Config, error) {
+	cfg := &Config{
+		Path:     name,
+		Contexts: make(map[string]*ConfigContext),
+		Aliases:  make(map[string]string),
+		Password: DefaultPasswordPolicy(),
+	}
+
+	file, err := os.Open(name)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+
+		return nil, err
+	}
+
+	defer file.Close()
+
+	section, sub := "", ""
+	scanner := bufio.NewScanner(file)
+
+	for num := 1; scanner.Scan(); num++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section, sub = parseConfigSection(line[1 : len(line)-1])
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected key = value", name, num)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		val, err := parseConfigValue(strings.TrimSpace(parts[1]))
+
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, num, err)
+		}
+
+		if err := cfg.set(section, sub, key, val); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, num, err)
+		}
+	}
+
+	return cfg, scanner.Err()
+}
+
+// set applies a single parsed value to the configuration.
+func (cfg *Config) set(section, sub, key, val string) error {
+	switch section {
+	case "":
+		switch key {
+		case "context":
+			cfg.Context = val
+		default:
+			return fmt.Errorf("unknown key %q", key)
+		}
+	case "context":
+		if sub == "" {
+			return fmt.Errorf("context section requires a name")
+		}
+
+		if _, ok := cfg.Contexts[sub]; !ok {
+			cfg.Contexts[sub] = &ConfigContext{}
+		}
+
+		switch key {
+		case "server":
+			cfg.Contexts[sub].Server = val
+		case "token":
+			cfg.Contexts[sub].Token = val
+		default:
+			return fmt.Errorf("unknown key %q in context", key)
+		}
+	case "alias":
+		cfg.Aliases[key] = val
+	case "password":
+		switch key {
+		case "min-length", "classes":
+			num, err := strconv.Atoi(val)
+
+			if err != nil || num < 0 {
+				return fmt.Errorf("%s must be a positive number", key)
+			}
+
+			if key == "classes" && num > 4 {
+				return fmt.Errorf("classes can be at most 4")
+			}
+
+			if key == "min-length" {
+				cfg.Password.MinLength = num
+			} else {
+				cfg.Password.Classes = num
+			}
+		case "deny":
+			for _, word := range strings.Split(val, ",") {
+				if word = strings.TrimSpace(word); word != "" {
+					cfg.Password.Deny = append(cfg.Password.Deny, word)
+				}
+			}
+		case "deny-file":
+			words, err := readDenyFile(val)
+
+			if err != nil {
+				return err
+			}
+
+			cfg.Password.Deny = append(cfg.Password.Deny, words...)
+		default:
+			return fmt.Errorf("unknown key %q in password", key)
+		}
+	default:
+		return fmt.Errorf("unknown section %q", section)
+	}
+
+	return nil
+}
+
+// Apply resolves the selected context and uses its server and token unless
+// they had been set by flags or environment variables.
+func (cfg *Config) Apply(c *cli.Context) error {
+	name := c.String("context")
+
+	if name == "" {
+		name = cfg.Context
+	}
+
+	if name == "" {
+		return nil
+	}
+
+	current, ok := cfg.Contexts[name]
+
+	if !ok {
+		return fmt.Errorf("context %q is not defined in %s", name, cfg.Path)
+	}
+
+	if err := c.Set("context", name); err != nil {
+		return err
+	}
+
+	if !c.IsSet("server") && current.Server != "" {
+		if err := c.Set("server", current.Server); err != nil {
+			return err
+		}
+	}
+
+	if !c.IsSet("token") && current.Token != "" {
+		if err := c.Set("token", current.Token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetConfig returns the configuration attached to the app by main.
+func GetConfig(c *cli.Context) *Config {
+	if cfg, ok := c.App.Metadata["config"].(*Config); ok {
+		return cfg
+	}
+
+	return &Config{
+		Contexts: make(map[string]*ConfigContext),
+		Aliases:  make(map[string]string),
+		Password: DefaultPasswordPolicy(),
+	}
+}
+
+// parseConfigSection splits a section header like `context "prod"`.
+func parseConfigSection(header string) (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	sub, err := strconv.Unquote(strings.TrimSpace(parts[1]))
+
+	if err != nil {
+		sub = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+	}
+
+	return parts[0], sub
+}
+
+// parseConfigValue unquotes a value if it is wrapped in double quotes.
+func parseConfigValue(val string) (string, error) {
+	if strings.HasPrefix(val, `"`) {
+		return strconv.Unquote(val)
+	}
+
+	return val, nil
+}
+
+// readDenyFile reads denied passwords from a file, one per line.
+func readDenyFile(name string) ([]string, error) {
+	file, err := os.Open(name)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deny file: %s", err)
+	}
+
+	defer file.Close()
+
+	result := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			result = append(result, line)
+		}
+	}
+
+	return result, scanner.Err()
+}
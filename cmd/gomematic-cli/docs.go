@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// docsEscapes matches the terminal colors used by the default templates.
+var docsEscapes = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// docsEnvironment defines the variables which are not bound to a flag.
+var docsEnvironment = [][2]string{
+	{"GOMEMATIC_ENV_FILE", "path to a dotenv file loaded before the flags get parsed"},
+	{"TRACEPARENT", "W3C trace context continued by the exported traces"},
+	{"OTEL_SERVICE_NAME", "service name of the exported traces, defaults to gomematic-cli"},
+}
+
+// docsExitCodes defines the exit codes shared by all commands.
+var docsExitCodes = []struct {
+	Code  int
+	Usage string
+	Batch bool
+}{
+	{0, "the command succeeded", false},
+	{1, "invalid arguments, flags or configuration", false},
+	{2, "the command failed", false},
+	{ExitPartial, "some of the given identifiers failed", true},
+	{ExitInterrupted, "the command had been interrupted", false},
+}
+
+// DocsPage represents a single command within the generated docs.
+type DocsPage struct {
+	Name     string
+	Path     []string
+	Usage    string
+	Args     string
+	Aliases  []string
+	Flags    []*DocsFlag
+	Commands []*DocsPage
+	Parent   *DocsPage
+	Batch    bool
+}
+
+// DocsFlag represents a single flag within the generated docs.
+type DocsFlag struct {
+	Names    []string
+	Usage    string
+	Value    string
+	Default  string
+	Template string
+	EnvVars  []string
+}
+
+// Docs provides the hidden sub-command to generate the reference docs.
+func Docs() *cli.Command {
+	return &cli.Command{
+		Name:      "docs",
+		Usage:     "generate man pages and markdown reference",
+		ArgsUsage: " ",
+		Hidden:    true,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "man-dir",
+				Value: "docs/man",
+				Usage: "directory for the man pages",
+			},
+			&cli.StringFlag{
+				Name:  "markdown-dir",
+				Value: "docs/reference",
+				Usage: "directory for the markdown reference",
+			},
+			&cli.BoolFlag{
+				Name:  "check",
+				Usage: "fail if the docs on disk are stale instead of writing them",
+			},
+		},
+		Action: DocsGenerate,
+	}
+}
+
+// DocsGenerate provides the sub-command to generate the reference docs.
+func DocsGenerate(c *cli.Context) error {
+	root := &DocsPage{
+		Name:  c.App.Name,
+		Path:  []string{c.App.Name},
+		Usage: c.App.Usage,
+		Args:  "<command> [options] [arguments...]",
+	}
+
+	for _, flag := range append(GlobalFlags(), cli.HelpFlag, cli.VersionFlag) {
+		root.Flags = append(root.Flags, docsFlag(flag))
+	}
+
+	for _, cmd := range Commands() {
+		if !cmd.Hidden {
+			root.Commands = append(root.Commands, docsPage(root, cmd))
+		}
+	}
+
+	files := make(map[string][]byte)
+
+	for _, page := range docsPages(root) {
+		files[filepath.Join(c.String("man-dir"), page.File()+".1")] = page.Man()
+		files[filepath.Join(c.String("markdown-dir"), page.File()+".md")] = page.Markdown()
+	}
+
+	if c.Bool("check") {
+		stale := docsStale(files, c.String("man-dir"), c.String("markdown-dir"))
+
+		if len(stale) > 0 {
+			logger.Errorf("generated docs are stale, run make docs:\n\n%s", strings.Join(stale, "\n"))
+			os.Exit(1)
+		}
+
+		logger.Info("generated docs are up to date")
+		return nil
+	}
+
+	for _, dir := range []string{c.String("man-dir"), c.String("markdown-dir")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			logger.Errorf("failed to create %s: %s", dir, err)
+			os.Exit(1)
+		}
+
+		for _, name := range docsExisting(dir) {
+			if _, ok := files[name]; !ok {
+				if err := os.Remove(name); err != nil {
+					logger.Errorf("failed to remove %s: %s", name, err)
+					os.Exit(1)
+				}
+			}
+		}
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, content, 0644); err != nil {
+			logger.Errorf("failed to write %s: %s", name, err)
+			os.Exit(1)
+		}
+	}
+
+	logger.Infof("successfully generated %d files", len(files))
+	return nil
+}
+
+// docsPage converts the command and all of its sub-commands.
+func docsPage(parent *DocsPage, cmd *cli.Command) *DocsPage {
+	page := &DocsPage{
+		Name:    cmd.Name,
+		Path:    append(append([]string{}, parent.Path...), cmd.Name),
+		Usage:   cmd.Usage,
+		Args:    strings.TrimSpace(cmd.ArgsUsage),
+		Aliases: cmd.Aliases,
+		Parent:  parent,
+	}
+
+	for _, flag := range cmd.Flags {
+		if _, ok := flag.(*cli.StringSliceFlag); ok && flag.Names()[0] == "id" {
+			page.Batch = true
+		}
+
+		page.Flags = append(page.Flags, docsFlag(flag))
+	}
+
+	for _, sub := range cmd.Subcommands {
+		if !sub.Hidden {
+			page.Commands = append(page.Commands, docsPage(page, sub))
+		}
+	}
+
+	if len(page.Commands) > 0 && page.Args == "" {
+		page.Args = "<command>"
+	}
+
+	return page
+}
+
+// docsFlag converts the flag including its default value.
+func docsFlag(flag cli.Flag) *DocsFlag {
+	result := &DocsFlag{
+		Names: flag.Names(),
+	}
+
+	switch val := flag.(type) {
+	case *cli.StringFlag:
+		result.Usage = val.Usage
+		result.Value = "value"
+		result.EnvVars = val.EnvVars
+
+		if strings.Contains(val.Value, "\n") {
+			lines := strings.Split(docsEscapes.ReplaceAllString(val.Value, ""), "\n")
+
+			for i, line := range lines {
+				lines[i] = strings.TrimRight(line, " ")
+			}
+
+			result.Template = strings.TrimRight(strings.Join(lines, "\n"), "\n")
+		} else {
+			result.Default = val.Value
+		}
+	case *cli.StringSliceFlag:
+		result.Usage = val.Usage
+		result.Value = "value"
+		result.EnvVars = val.EnvVars
+
+		if val.Value != nil {
+			result.Default = strings.Join(val.Value.Value(), ", ")
+		}
+	case *cli.IntFlag:
+		result.Usage = val.Usage
+		result.Value = "value"
+		result.Default = fmt.Sprintf("%d", val.Value)
+		result.EnvVars = val.EnvVars
+	case *cli.DurationFlag:
+		result.Usage = val.Usage
+		result.Value = "value"
+		result.Default = val.Value.String()
+		result.EnvVars = val.EnvVars
+	case *cli.BoolFlag:
+		result.Usage = val.Usage
+		result.EnvVars = val.EnvVars
+	case *CountFlag:
+		result.Usage = val.Usage
+		result.EnvVars = val.EnvVars
+	default:
+		result.Usage = flag.String()
+	}
+
+	return result
+}
+
+// docsPages flattens the tree of pages in order of the command tree.
+func docsPages(page *DocsPage) []*DocsPage {
+	result := []*DocsPage{page}
+
+	for _, sub := range page.Commands {
+		result = append(result, docsPages(sub)...)
+	}
+
+	return result
+}
+
+// docsExisting lists the generated files within the directory.
+func docsExisting(dir string) []string {
+	result := make([]string, 0)
+
+	for _, pattern := range []string{"*.1", "*.md"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		result = append(result, matches...)
+	}
+
+	return result
+}
+
+// docsStale compares the generated files with the files on disk.
+func docsStale(files map[string][]byte, dirs ...string) []string {
+	result := make([]string, 0)
+
+	for name, content := range files {
+		current, err := ioutil.ReadFile(name)
+
+		switch {
+		case os.IsNotExist(err):
+			result = append(result, "missing "+name)
+		case err != nil:
+			result = append(result, fmt.Sprintf("unreadable %s: %s", name, err))
+		case !bytes.Equal(current, content):
+			result = append(result, "outdated "+name)
+		}
+	}
+
+	for _, dir := range dirs {
+		for _, name := range docsExisting(dir) {
+			if _, ok := files[name]; !ok {
+				result = append(result, "obsolete "+name)
+			}
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
+
+// File returns the file name of the page without extension.
+func (p *DocsPage) File() string {
+	return strings.Join(p.Path, "-")
+}
+
+// Command returns the full command of the page.
+func (p *DocsPage) Command() string {
+	return strings.Join(p.Path, " ")
+}
+
+// Synopsis returns the usage line of the page.
+func (p *DocsPage) Synopsis() string {
+	if p.Parent == nil {
+		return strings.Join([]string{p.Name, "[global options]", p.Args}, " ")
+	}
+
+	parts := []string{p.Path[0], "[global options]", strings.Join(p.Path[1:], " ")}
+
+	if len(p.Flags) > 0 {
+		parts = append(parts, "[options]")
+	}
+
+	if p.Args != "" {
+		parts = append(parts, p.Args)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Environment collects the variables of all flags of the page.
+func (p *DocsPage) Environment() [][2]string {
+	result := make([][2]string, 0)
+
+	for _, flag := range p.Flags {
+		for _, env := range flag.EnvVars {
+			result = append(result, [2]string{env, "same as --" + flag.Names[0]})
+		}
+	}
+
+	if p.Parent == nil {
+		result = append(result, docsEnvironment...)
+	}
+
+	return result
+}
+
+// Markdown renders the page as markdown reference.
+func (p *DocsPage) Markdown() []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "# %s\n\n%s\n\n", p.Command(), p.Usage)
+	fmt.Fprintf(buf, "## Synopsis\n\n```\n%s\n```\n", p.Synopsis())
+
+	if len(p.Aliases) > 0 {
+		fmt.Fprintf(buf, "\n## Aliases\n\n")
+
+		for _, alias := range p.Aliases {
+			fmt.Fprintf(buf, "* `%s %s`\n", p.Parent.Command(), alias)
+		}
+	}
+
+	if len(p.Commands) > 0 {
+		fmt.Fprintf(buf, "\n## Commands\n\n| Command | Description |\n| --- | --- |\n")
+
+		for _, sub := range p.Commands {
+			fmt.Fprintf(buf, "| [%s](%s.md) | %s |\n", sub.Name, sub.File(), sub.Usage)
+		}
+	}
+
+	if len(p.Flags) > 0 {
+		if p.Parent == nil {
+			fmt.Fprintf(buf, "\n## Global options\n\n")
+		} else {
+			fmt.Fprintf(buf, "\n## Options\n\n")
+		}
+
+		for _, flag := range p.Flags {
+			fmt.Fprintf(buf, "* `%s`: %s", flag.Flag(), flag.Usage)
+
+			if flag.Default != "" {
+				fmt.Fprintf(buf, " (default: `%s`)", flag.Default)
+			}
+
+			if flag.Template != "" {
+				fmt.Fprintf(buf, " (default: see below)")
+			}
+
+			fmt.Fprintln(buf)
+		}
+
+		for _, flag := range p.Flags {
+			if flag.Template != "" {
+				fmt.Fprintf(buf, "\n### Default template of --%s\n\n```\n%s\n```\n", flag.Names[0], flag.Template)
+			}
+		}
+	}
+
+	if env := p.Environment(); len(env) > 0 {
+		fmt.Fprintf(buf, "\n## Environment\n\n")
+
+		for _, row := range env {
+			fmt.Fprintf(buf, "* `%s`: %s\n", row[0], row[1])
+		}
+	}
+
+	if len(p.Commands) == 0 || p.Parent == nil {
+		fmt.Fprintf(buf, "\n## Exit codes\n\n| Code | Description |\n| --- | --- |\n")
+
+		for _, code := range docsExitCodes {
+			if !code.Batch || p.Batch || p.Parent == nil {
+				fmt.Fprintf(buf, "| %d | %s |\n", code.Code, code.Usage)
+			}
+		}
+	}
+
+	if p.Parent != nil {
+		fmt.Fprintf(buf, "\n## See also\n\n")
+
+		if p.Parent.Parent != nil {
+			fmt.Fprintf(buf, "* [%s](%s.md)\n", p.Parent.Command(), p.Parent.File())
+		}
+
+		fmt.Fprintf(buf, "* [%s](%s.md) for global options\n", p.Path[0], p.Path[0])
+	}
+
+	return buf.Bytes()
+}
+
+// Man renders the page as man page of section 1.
+func (p *DocsPage) Man() []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, ".TH %s 1 \"\" \"%s\" \"User Commands\"\n", roffEscape(strings.ToUpper(p.File())), roffEscape(p.Path[0]))
+	fmt.Fprintf(buf, ".SH NAME\n%s \\- %s\n", roffEscape(p.File()), roffEscape(p.Usage))
+	fmt.Fprintf(buf, ".SH SYNOPSIS\n.B %s\n", roffEscape(p.Synopsis()))
+
+	if len(p.Aliases) > 0 {
+		fmt.Fprintf(buf, ".SH ALIASES\n")
+
+		for _, alias := range p.Aliases {
+			fmt.Fprintf(buf, ".B %s\n.br\n", roffEscape(p.Parent.Command()+" "+alias))
+		}
+	}
+
+	if len(p.Commands) > 0 {
+		fmt.Fprintf(buf, ".SH COMMANDS\n")
+
+		for _, sub := range p.Commands {
+			fmt.Fprintf(buf, ".TP\n.B %s\n%s\n", roffEscape(sub.Name), roffEscape(sub.Usage))
+		}
+	}
+
+	if len(p.Flags) > 0 {
+		if p.Parent == nil {
+			fmt.Fprintf(buf, ".SH GLOBAL OPTIONS\n")
+		} else {
+			fmt.Fprintf(buf, ".SH OPTIONS\n")
+		}
+
+		for _, flag := range p.Flags {
+			fmt.Fprintf(buf, ".TP\n.B %s\n%s", roffEscape(flag.Flag()), roffEscape(flag.Usage))
+
+			if flag.Default != "" {
+				fmt.Fprintf(buf, " (default: %s)", roffEscape(flag.Default))
+			}
+
+			if flag.Template != "" {
+				fmt.Fprintf(buf, " (default: see below)")
+			}
+
+			fmt.Fprintln(buf)
+		}
+
+		for _, flag := range p.Flags {
+			if flag.Template != "" {
+				fmt.Fprintf(buf, ".SS Default template of \\-\\-%s\n.nf\n.RS\n", roffEscape(flag.Names[0]))
+
+				for _, line := range strings.Split(flag.Template, "\n") {
+					fmt.Fprintln(buf, roffEscape(line))
+				}
+
+				fmt.Fprintf(buf, ".RE\n.fi\n")
+			}
+		}
+	}
+
+	if env := p.Environment(); len(env) > 0 {
+		fmt.Fprintf(buf, ".SH ENVIRONMENT\n")
+
+		for _, row := range env {
+			fmt.Fprintf(buf, ".TP\n.B %s\n%s\n", roffEscape(row[0]), roffEscape(row[1]))
+		}
+	}
+
+	if len(p.Commands) == 0 || p.Parent == nil {
+		fmt.Fprintf(buf, ".SH EXIT STATUS\n")
+
+		for _, code := range docsExitCodes {
+			if !code.Batch || p.Batch || p.Parent == nil {
+				fmt.Fprintf(buf, ".TP\n.B %d\n%s\n", code.Code, roffEscape(code.Usage))
+			}
+		}
+	}
+
+	if p.Parent != nil {
+		fmt.Fprintf(buf, ".SH SEE ALSO\n")
+
+		if p.Parent.Parent != nil {
+			fmt.Fprintf(buf, ".BR %s (1),\n", roffEscape(p.Parent.File()))
+		}
+
+		fmt.Fprintf(buf, ".BR %s (1)\n", roffEscape(p.Path[0]))
+	}
+
+	return buf.Bytes()
+}
+
+// Flag returns the names of the flag including the value placeholder.
+func (f *DocsFlag) Flag() string {
+	names := make([]string, 0, len(f.Names))
+
+	for i, name := range f.Names {
+		if i > 0 && len(name) <= 2 {
+			names = append(names, "-"+name)
+		} else {
+			names = append(names, "--"+name)
+		}
+	}
+
+	if f.Value != "" {
+		return strings.Join(names, ", ") + " <" + f.Value + ">"
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// roffEscape escapes the text for man pages, lines must not start with
+// control characters.
+func roffEscape(val string) string {
+	val = strings.Replace(val, "\\", "\\e", -1)
+	val = strings.Replace(val, "-", "\\-", -1)
+
+	if strings.HasPrefix(val, ".") || strings.HasPrefix(val, "'") {
+		val = "\\&" + val
+	}
+
+	return val
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDocsUpToDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomematic-docs")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	c := testContext(
+		t,
+		Docs().Flags,
+		"--man-dir", filepath.Join(dir, "man"),
+		"--markdown-dir", filepath.Join(dir, "reference"),
+	)
+
+	// the usage of the app gets rendered into the root pages, keep it in
+	// sync with main.
+	c.App.Usage = "lightweight and powerful homematic"
+
+	if err := DocsGenerate(c); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"man", "reference"} {
+		generated := filepath.Join(dir, name)
+		existing := filepath.Join("..", "..", "docs", name)
+
+		for _, file := range docsExisting(generated) {
+			expected, err := ioutil.ReadFile(file)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			current, err := ioutil.ReadFile(filepath.Join(existing, filepath.Base(file)))
+
+			switch {
+			case os.IsNotExist(err):
+				t.Errorf("missing docs/%s/%s, run make docs", name, filepath.Base(file))
+			case err != nil:
+				t.Fatal(err)
+			case !bytes.Equal(current, expected):
+				t.Errorf("outdated docs/%s/%s, run make docs", name, filepath.Base(file))
+			}
+		}
+
+		for _, file := range docsExisting(existing) {
+			if _, err := os.Stat(filepath.Join(generated, filepath.Base(file))); os.IsNotExist(err) {
+				t.Errorf("obsolete docs/%s/%s, run make docs", name, filepath.Base(file))
+			}
+		}
+	}
+}
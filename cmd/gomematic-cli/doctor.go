@@ -0,0 +1,741 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/gomematic/gomematic-cli/pkg/version"
+	"github.com/gomematic/gomematic-go/gomematic"
+	"github.com/gomematic/gomematic-go/gomematic/profile"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// tmplDoctorCheck represents a single check within the doctor checklist.
+var tmplDoctorCheck = `{{ if eq .Status "pass" }}` + "\x1b[32m[PASS]\x1b[0m" +
+	`{{ else if eq .Status "warn" }}` + "\x1b[33m[WARN]\x1b[0m" +
+	`{{ else if eq .Status "fail" }}` + "\x1b[31m[FAIL]\x1b[0m" +
+	`{{ else }}[SKIP]{{ end }} {{ .Name }}: {{ .Detail }}{{ with .Hint }}
+       hint: {{ . }}{{ end }}`
+
+// serverVersionHeader defines the header used by the API to report its version.
+const serverVersionHeader = "X-Gomematic-Version"
+
+// Possible results of a single doctor check.
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// DoctorCheck represents the result of a single diagnostic check.
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// DoctorReport represents the result of all diagnostic checks.
+type DoctorReport struct {
+	OK     bool           `json:"ok"`
+	Checks []*DoctorCheck `json:"checks"`
+}
+
+// add appends a new check result to the report.
+func (r *DoctorReport) add(name, status, detail, hint string) {
+	if status == checkFail {
+		r.OK = false
+	}
+
+	r.Checks = append(r.Checks, &DoctorCheck{
+		Name:   name,
+		Status: status,
+		Detail: detail,
+		Hint:   hint,
+	})
+}
+
+// Doctor provides the sub-command for connectivity diagnostics.
+func Doctor() *cli.Command {
+	return &cli.Command{
+		Name:      "doctor",
+		Usage:     "diagnose connectivity, auth and compatibility",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the checklist as json",
+			},
+			&cli.StringFlag{
+				Name:   "format",
+				Value:  tmplDoctorCheck,
+				Usage:  "custom output format",
+				Hidden: true,
+			},
+		},
+		Action: DoctorAction,
+	}
+}
+
+// DoctorAction runs the checks without the pre-checks of Handle, so a
+// missing or invalid server address gets reported as failed check.
+func DoctorAction(c *cli.Context) error {
+	ctx := RootContext(c)
+
+	if c.Duration("deadline") > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Duration("deadline"))
+		defer cancel()
+	}
+
+	var client *Client
+
+	if server, err := url.Parse(c.String("server")); err == nil && server.Host != "" {
+		client, _ = newClient(c, server)
+	}
+
+	err := DoctorRun(ctx, c, client)
+	tracer.Shutdown()
+
+	if err != nil {
+		exitError(c, err)
+	}
+
+	return nil
+}
+
+// DoctorRun provides the sub-command to run all diagnostic checks.
+func DoctorRun(ctx context.Context, c *cli.Context, client *Client) error {
+	report := &DoctorReport{
+		OK: true,
+	}
+
+	server, err := url.Parse(c.String("server"))
+
+	doctorConfig(c, report)
+
+	if err != nil {
+		report.add(
+			"server address",
+			checkFail,
+			fmt.Sprintf("invalid server address %q", c.String("server")),
+			"use a full address like https://gomematic.example.com",
+		)
+	} else if doctorServer(server, report) {
+		doctorNetwork(ctx, c, server, report)
+		doctorAuth(ctx, c, client, report)
+	}
+
+	if c.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		tmpl, err := template.New(
+			"_",
+		).Funcs(
+			globalFuncMap,
+		).Funcs(
+			sprigFuncMap,
+		).Parse(
+			fmt.Sprintln(c.String("format")),
+		)
+
+		if err != nil {
+			return err
+		}
+
+		for _, check := range report.Checks {
+			if err := tmpl.Execute(os.Stdout, check); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !report.OK {
+		return fmt.Errorf("some checks failed, see hints above")
+	}
+
+	return nil
+}
+
+// doctorConfig checks where the configuration has been resolved from.
+func doctorConfig(c *cli.Context, report *DoctorReport) {
+	if env := os.Getenv("GOMEMATIC_ENV_FILE"); env != "" {
+		if _, err := os.Stat(env); err != nil {
+			report.add(
+				"env file",
+				checkFail,
+				fmt.Sprintf("failed to read %s", env),
+				"fix or unset GOMEMATIC_ENV_FILE",
+			)
+		} else {
+			report.add(
+				"env file",
+				checkPass,
+				fmt.Sprintf("loaded from %s", env),
+				"",
+			)
+		}
+	} else {
+		report.add(
+			"env file",
+			checkSkip,
+			"GOMEMATIC_ENV_FILE is not set",
+			"",
+		)
+	}
+
+	cfg := GetConfig(c)
+
+	if _, err := os.Stat(cfg.Path); err != nil {
+		report.add(
+			"config file",
+			checkSkip,
+			fmt.Sprintf("%s does not exist", cfg.Path),
+			"",
+		)
+	} else if c.String("context") != "" {
+		report.add(
+			"config file",
+			checkPass,
+			fmt.Sprintf("using context %s from %s", c.String("context"), cfg.Path),
+			"",
+		)
+	} else {
+		report.add(
+			"config file",
+			checkPass,
+			fmt.Sprintf("loaded from %s without context", cfg.Path),
+			"",
+		)
+	}
+
+	report.add(
+		"server config",
+		checkPass,
+		fmt.Sprintf(
+			"%s from %s",
+			c.String("server"),
+			flagSource(c, "server", "GOMEMATIC_SERVER"),
+		),
+		"",
+	)
+
+	if c.String("token") == "" {
+		report.add(
+			"token config",
+			checkWarn,
+			"no token configured",
+			"run profile login and set GOMEMATIC_TOKEN or --token",
+		)
+	} else {
+		report.add(
+			"token config",
+			checkPass,
+			fmt.Sprintf(
+				"token from %s",
+				flagSource(c, "token", "GOMEMATIC_TOKEN"),
+			),
+			"",
+		)
+	}
+}
+
+// doctorServer checks if the server address is usable at all.
+func doctorServer(server *url.URL, report *DoctorReport) bool {
+	if server == nil || server.Host == "" {
+		report.add(
+			"server address",
+			checkFail,
+			"server address is missing a host",
+			"use a full address like https://gomematic.example.com",
+		)
+
+		return false
+	}
+
+	if server.Scheme != "http" && server.Scheme != "https" {
+		report.add(
+			"server address",
+			checkFail,
+			fmt.Sprintf("unsupported scheme %q", server.Scheme),
+			"use http or https as scheme",
+		)
+
+		return false
+	}
+
+	report.add(
+		"server address",
+		checkPass,
+		server.String(),
+		"",
+	)
+
+	return true
+}
+
+// doctorNetwork checks name resolution, connectivity, tls and the api itself.
+func doctorNetwork(ctx context.Context, c *cli.Context, server *url.URL, report *DoctorReport) {
+	timeout := c.Duration("timeout")
+	host := server.Hostname()
+	port := server.Port()
+
+	if port == "" {
+		port = "80"
+
+		if server.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	dnsCtx, cancel := timeoutContext(ctx, timeout)
+	addrs, err := net.DefaultResolver.LookupHost(dnsCtx, host)
+	cancel()
+
+	if err != nil {
+		report.add(
+			"dns",
+			checkFail,
+			fmt.Sprintf("failed to resolve %s", host),
+			"check the server hostname or your dns settings",
+		)
+
+		return
+	}
+
+	report.add(
+		"dns",
+		checkPass,
+		fmt.Sprintf("%s resolves to %s", host, strings.Join(addrs, ", ")),
+		"",
+	)
+
+	dialer := &net.Dialer{
+		Timeout: timeout,
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+
+	if err != nil {
+		report.add(
+			"tcp",
+			checkFail,
+			PrettyError(err).Error(),
+			fmt.Sprintf("check that the server listens on port %s and no firewall blocks it", port),
+		)
+
+		return
+	}
+
+	conn.Close()
+
+	report.add(
+		"tcp",
+		checkPass,
+		fmt.Sprintf("connected to %s", net.JoinHostPort(host, port)),
+		"",
+	)
+
+	if server.Scheme == "https" {
+		conn, err := doctorTLS(ctx, dialer, net.JoinHostPort(host, port), host)
+
+		if err != nil {
+			report.add(
+				"tls",
+				checkFail,
+				err.Error(),
+				"check the certificate of the server or your trusted certificate authorities",
+			)
+
+			return
+		}
+
+		expires := conn.ConnectionState().PeerCertificates[0].NotAfter
+		conn.Close()
+
+		if remaining := time.Until(expires); remaining < 14*24*time.Hour {
+			report.add(
+				"tls",
+				checkWarn,
+				fmt.Sprintf("certificate expires at %s", expires.Format(time.RFC3339)),
+				"renew the certificate of the server soon",
+			)
+		} else {
+			report.add(
+				"tls",
+				checkPass,
+				fmt.Sprintf("certificate valid until %s", expires.Format(time.RFC3339)),
+				"",
+			)
+		}
+	} else {
+		report.add(
+			"tls",
+			checkSkip,
+			"server uses plain http",
+			"",
+		)
+	}
+
+	doctorAPI(ctx, c, server, report)
+}
+
+// doctorTLS dials the address and performs the tls handshake, both are
+// aborted once the context gets canceled or the dialer timeout expires.
+func doctorTLS(ctx context.Context, dialer *net.Dialer, addr, host string) (*tls.Conn, error) {
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dialer.Timeout > 0 {
+		raw.SetDeadline(time.Now().Add(dialer.Timeout))
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		raw.SetDeadline(deadline)
+	}
+
+	conn := tls.Client(raw, &tls.Config{
+		ServerName: host,
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			raw.Close()
+		case <-done:
+		}
+	}()
+
+	if err := conn.Handshake(); err != nil {
+		raw.Close()
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, err
+	}
+
+	raw.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// doctorAPI checks the base path, clock skew and version of the server.
+func doctorAPI(ctx context.Context, c *cli.Context, server *url.URL, report *DoctorReport) {
+	endpoint := *server
+	endpoint.Path = path.Join(server.Path, gomematic.DefaultBasePath, "profile", "self")
+
+	reqCtx, cancel := timeoutContext(ctx, c.Duration("timeout"))
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, endpoint.String(), nil)
+
+	if err != nil {
+		report.add("api", checkFail, err.Error(), "")
+		return
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req.WithContext(reqCtx))
+
+	if err != nil {
+		report.add(
+			"api",
+			checkFail,
+			PrettyError(err).Error(),
+			"check that the server address points to gomematic-api",
+		)
+
+		return
+	}
+
+	resp.Body.Close()
+	latency := time.Since(start)
+
+	if resp.StatusCode == http.StatusNotFound || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		report.add(
+			"api",
+			checkFail,
+			fmt.Sprintf("no api found at %s, got status %d", endpoint.Path, resp.StatusCode),
+			"check the path of the server address, the api is served below "+gomematic.DefaultBasePath,
+		)
+	} else {
+		report.add(
+			"api",
+			checkPass,
+			fmt.Sprintf("api answered at %s within %s", endpoint.Path, latency.Round(time.Millisecond)),
+			"",
+		)
+	}
+
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		skew := time.Since(date) - latency/2
+
+		if skew < 0 {
+			skew = -skew
+		}
+
+		switch {
+		case skew > 5*time.Minute:
+			report.add(
+				"clock skew",
+				checkFail,
+				fmt.Sprintf("local clock differs by %s", skew.Round(time.Second)),
+				"synchronize your clock via ntp, tokens may be rejected",
+			)
+		case skew > 30*time.Second:
+			report.add(
+				"clock skew",
+				checkWarn,
+				fmt.Sprintf("local clock differs by %s", skew.Round(time.Second)),
+				"synchronize your clock via ntp",
+			)
+		default:
+			report.add(
+				"clock skew",
+				checkPass,
+				fmt.Sprintf("local clock differs by %s", skew.Round(time.Second)),
+				"",
+			)
+		}
+	} else {
+		report.add(
+			"clock skew",
+			checkSkip,
+			"server does not send a date header",
+			"",
+		)
+	}
+
+	doctorVersion(resp.Header.Get(serverVersionHeader), report)
+}
+
+// doctorVersion checks the compatibility of the server and client versions.
+func doctorVersion(remote string, report *DoctorReport) {
+	if remote == "" {
+		report.add(
+			"version",
+			checkSkip,
+			"server does not report its version",
+			"",
+		)
+
+		return
+	}
+
+	client, err := semver.NewVersion(version.String)
+
+	if err != nil || version.String == "0.0.0" {
+		report.add(
+			"version",
+			checkSkip,
+			fmt.Sprintf("server is %s, client is a development build", remote),
+			"",
+		)
+
+		return
+	}
+
+	server, err := semver.NewVersion(remote)
+
+	if err != nil {
+		report.add(
+			"version",
+			checkWarn,
+			fmt.Sprintf("server reports unknown version %q", remote),
+			"",
+		)
+
+		return
+	}
+
+	if server.Major() != client.Major() || (client.Major() == 0 && server.Minor() != client.Minor()) {
+		report.add(
+			"version",
+			checkFail,
+			fmt.Sprintf("server %s is incompatible with client %s", server, client),
+			"install a client release matching the server version",
+		)
+
+		return
+	}
+
+	report.add(
+		"version",
+		checkPass,
+		fmt.Sprintf("server %s is compatible with client %s", server, client),
+		"",
+	)
+}
+
+// doctorAuth checks if the token is valid and when it expires.
+func doctorAuth(ctx context.Context, c *cli.Context, client *Client, report *DoctorReport) {
+	if c.String("token") == "" {
+		report.add(
+			"token",
+			checkSkip,
+			"no token configured",
+			"",
+		)
+
+		return
+	}
+
+	resp, err := client.Profile.ShowProfile(
+		profile.NewShowProfileParams().WithContext(ctx),
+		client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *profile.ShowProfileForbidden:
+			report.add(
+				"token",
+				checkFail,
+				*val.Payload.Message,
+				"the token is invalid or expired, run profile login for a new one",
+			)
+		case *profile.ShowProfileDefault:
+			report.add(
+				"token",
+				checkFail,
+				*val.Payload.Message,
+				"",
+			)
+		default:
+			report.add(
+				"token",
+				checkFail,
+				PrettyError(err).Error(),
+				"",
+			)
+		}
+
+		return
+	}
+
+	report.add(
+		"token",
+		checkPass,
+		fmt.Sprintf("authenticated as %s", *resp.Payload.Username),
+		"",
+	)
+
+	expires, ok := tokenExpiry(c.String("token"))
+
+	if !ok {
+		token, err := client.Profile.TokenProfile(
+			profile.NewTokenProfileParams().WithContext(ctx),
+			client.AuthInfo,
+		)
+
+		if err != nil {
+			report.add(
+				"token expiry",
+				checkWarn,
+				"failed to fetch token details",
+				"",
+			)
+
+			return
+		}
+
+		if token.Payload.ExpiresAt == nil {
+			report.add(
+				"token expiry",
+				checkPass,
+				"token does not expire",
+				"",
+			)
+
+			return
+		}
+
+		expires = time.Time(*token.Payload.ExpiresAt)
+	}
+
+	if remaining := time.Until(expires); remaining < 24*time.Hour {
+		report.add(
+			"token expiry",
+			checkWarn,
+			fmt.Sprintf("token expires at %s", expires.Format(time.RFC3339)),
+			"create a permanent token with profile token",
+		)
+	} else {
+		report.add(
+			"token expiry",
+			checkPass,
+			fmt.Sprintf("token expires at %s", expires.Format(time.RFC3339)),
+			"",
+		)
+	}
+}
+
+// tokenExpiry extracts the expiry from the claims of a jwt token.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	claims := struct {
+		Exp int64 `json:"exp"`
+	}{}
+
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(claims.Exp, 0), true
+}
+
+// flagSource detects if a flag had been set by the command line, by the
+// environment, by the config context or if it uses its default value.
+func flagSource(c *cli.Context, name, env string) string {
+	if !c.IsSet(name) {
+		return "default"
+	}
+
+	if val, ok := os.LookupEnv(env); ok && val == c.String(name) {
+		return "environment"
+	}
+
+	if current, ok := GetConfig(c).Contexts[c.String("context")]; ok {
+		if (name == "server" && current.Server == c.String(name)) || (name == "token" && current.Token == c.String(name)) {
+			return fmt.Sprintf("context %s", c.String("context"))
+		}
+	}
+
+	return "flag"
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gomematic/gomematic-go/models"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// Event represents a single change detected between two polls.
+type Event struct {
+	Sequence int64       `json:"seq"`
+	Time     time.Time   `json:"time"`
+	Type     string      `json:"type"`
+	Server   string      `json:"server"`
+	Subject  string      `json:"subject"`
+	Before   interface{} `json:"before,omitempty"`
+	After    interface{} `json:"after,omitempty"`
+}
+
+// EventState represents the persisted state to resume polling.
+type EventState struct {
+	Server   string                  `json:"server"`
+	Time     time.Time               `json:"time"`
+	Sequence int64                   `json:"seq"`
+	Users    map[string]*EventUser   `json:"users"`
+	Teams    map[string]*EventTeam   `json:"teams"`
+	Members  map[string]*EventMember `json:"members"`
+}
+
+// EventUser represents the tracked attributes of a user.
+type EventUser struct {
+	ID       string `json:"id"`
+	Slug     string `json:"slug"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Active   bool   `json:"active"`
+	Admin    bool   `json:"admin"`
+}
+
+// EventTeam represents the tracked attributes of a team.
+type EventTeam struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// EventMember represents the tracked attributes of a membership.
+type EventMember struct {
+	TeamID   string `json:"team_id"`
+	TeamSlug string `json:"team_slug"`
+	UserID   string `json:"user_id"`
+	UserSlug string `json:"user_slug"`
+	Perm     string `json:"perm"`
+}
+
+// Events provides the sub-command for change events.
+func Events() *cli.Command {
+	return &cli.Command{
+		Name:  "events",
+		Usage: "change event commands",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "tail",
+				Usage:     "poll for changes and emit them as json lines",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "interval",
+						Value: 30 * time.Second,
+						Usage: "interval between polls",
+					},
+					&cli.StringFlag{
+						Name:  "state",
+						Value: "",
+						Usage: "path to the state file, defaults to events.json within the config dir",
+					},
+					&cli.BoolFlag{
+						Name:  "once",
+						Usage: "poll a single time and exit",
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Value: 8,
+						Usage: "number of parallel requests",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return Handle(c, EventsTail)
+				},
+			},
+		},
+	}
+}
+
+// EventsTail provides the sub-command to emit change events.
+func EventsTail(ctx context.Context, c *cli.Context, client *Client) error {
+	name := c.String("state")
+
+	if name == "" {
+		name = filepath.Join(configDir(), "events.json")
+	}
+
+	if c.Duration("interval") <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+
+	previous, err := readEventState(name)
+
+	if err != nil {
+		return err
+	}
+
+	if previous != nil && previous.Server != c.String("server") {
+		logger.Warnf("state belongs to %s, starting with a new snapshot", previous.Server)
+		previous = nil
+	}
+
+	ticker := time.NewTicker(c.Duration("interval"))
+	defer ticker.Stop()
+
+	encoder := json.NewEncoder(os.Stdout)
+
+	for {
+		current, err := fetchEventState(ctx, c, client)
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			if c.Bool("once") {
+				return err
+			}
+
+			logger.Error(err.Error())
+		} else {
+			if previous != nil {
+				current.Sequence = previous.Sequence
+
+				for _, event := range diffEventState(previous, current) {
+					if err := encoder.Encode(event); err != nil {
+						return err
+					}
+				}
+			}
+
+			if err := writeEventState(name, current); err != nil {
+				return err
+			}
+
+			previous = current
+		}
+
+		if c.Bool("once") {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetchEventState fetches all users, teams and memberships.
+func fetchEventState(ctx context.Context, c *cli.Context, client *Client) (*EventState, error) {
+	var (
+		users []*models.User
+		teams []*models.Team
+	)
+
+	if err := parallel(ctx, 2, 2, func(ctx context.Context, i int) error {
+		var err error
+
+		if i == 0 {
+			users, err = listUsers(ctx, client)
+		} else {
+			teams, err = listTeams(ctx, client)
+		}
+
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	members := make([][]*models.TeamUser, len(teams))
+
+	if err := parallel(ctx, c.Int("concurrency"), len(teams), func(ctx context.Context, i int) error {
+		records, err := teamUsers(ctx, client, teams[i].ID.String())
+
+		if err != nil {
+			return fmt.Errorf("failed to fetch users of %s: %s", stringValue(teams[i].Slug, teams[i].ID.String()), err)
+		}
+
+		members[i] = records
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	result := &EventState{
+		Server:  c.String("server"),
+		Time:    time.Now().UTC(),
+		Users:   make(map[string]*EventUser, len(users)),
+		Teams:   make(map[string]*EventTeam, len(teams)),
+		Members: make(map[string]*EventMember),
+	}
+
+	for _, record := range users {
+		result.Users[record.ID.String()] = &EventUser{
+			ID:       record.ID.String(),
+			Slug:     stringValue(record.Slug, ""),
+			Username: stringValue(record.Username, ""),
+			Email:    stringValue(record.Email, ""),
+			Active:   record.Active != nil && *record.Active,
+			Admin:    record.Admin != nil && *record.Admin,
+		}
+	}
+
+	for i, record := range teams {
+		result.Teams[record.ID.String()] = &EventTeam{
+			ID:   record.ID.String(),
+			Slug: stringValue(record.Slug, ""),
+			Name: stringValue(record.Name, ""),
+		}
+
+		for _, member := range members[i] {
+			entry := &EventMember{
+				TeamID:   record.ID.String(),
+				TeamSlug: stringValue(record.Slug, ""),
+				Perm:     stringValue(member.Perm, ""),
+			}
+
+			if member.User != nil {
+				entry.UserID = member.User.ID.String()
+				entry.UserSlug = stringValue(member.User.Slug, "")
+			} else if member.UserID != nil {
+				entry.UserID = member.UserID.String()
+			}
+
+			result.Members[entry.TeamID+"/"+entry.UserID] = entry
+		}
+	}
+
+	return result, nil
+}
+
+// diffEventState detects all changes between two states, the events are
+// numbered continuously based on the sequence of the state.
+func diffEventState(previous, current *EventState) []*Event {
+	result := make([]*Event, 0)
+
+	emit := func(kind, subject string, before, after interface{}) {
+		current.Sequence++
+
+		result = append(result, &Event{
+			Sequence: current.Sequence,
+			Time:     current.Time,
+			Type:     kind,
+			Server:   current.Server,
+			Subject:  subject,
+			Before:   before,
+			After:    after,
+		})
+	}
+
+	for _, id := range unionKeys(userKeys(previous.Users), userKeys(current.Users)) {
+		before, after := previous.Users[id], current.Users[id]
+
+		switch {
+		case before == nil:
+			emit("user.created", id, nil, after)
+		case after == nil:
+			emit("user.deleted", id, before, nil)
+		default:
+			if before.Slug != after.Slug || before.Username != after.Username || before.Email != after.Email {
+				emit("user.updated", id, before, after)
+			}
+
+			if !before.Admin && after.Admin {
+				emit("user.admin_granted", id, before, after)
+			}
+
+			if before.Admin && !after.Admin {
+				emit("user.admin_revoked", id, before, after)
+			}
+
+			if !before.Active && after.Active {
+				emit("user.activated", id, before, after)
+			}
+
+			if before.Active && !after.Active {
+				emit("user.deactivated", id, before, after)
+			}
+		}
+	}
+
+	for _, id := range unionKeys(teamKeys(previous.Teams), teamKeys(current.Teams)) {
+		before, after := previous.Teams[id], current.Teams[id]
+
+		switch {
+		case before == nil:
+			emit("team.created", id, nil, after)
+		case after == nil:
+			emit("team.deleted", id, before, nil)
+		case *before != *after:
+			emit("team.updated", id, before, after)
+		}
+	}
+
+	for _, id := range unionKeys(memberKeys(previous.Members), memberKeys(current.Members)) {
+		before, after := previous.Members[id], current.Members[id]
+
+		switch {
+		case before == nil:
+			emit("team.member_added", id, nil, after)
+		case after == nil:
+			emit("team.member_removed", id, before, nil)
+		case before.Perm != after.Perm:
+			emit("membership.perm_changed", id, before, after)
+		}
+	}
+
+	return result
+}
+
+// readEventState loads the persisted state, a missing file is not an error.
+func readEventState(name string) (*EventState, error) {
+	content, err := ioutil.ReadFile(name)
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to read state: %s", err)
+	}
+
+	result := &EventState{}
+
+	if err := json.Unmarshal(content, result); err != nil {
+		return nil, fmt.Errorf("failed to parse state %s: %s", name, err)
+	}
+
+	return result, nil
+}
+
+// writeEventState persists the state atomically to resume polling.
+func writeEventState(name string, state *EventState) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return fmt.Errorf("failed to write state: %s", err)
+	}
+
+	content, err := json.Marshal(state)
+
+	if err != nil {
+		return err
+	}
+
+	tmp := name + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return fmt.Errorf("failed to write state: %s", err)
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("failed to write state: %s", err)
+	}
+
+	return nil
+}
+
+// userKeys returns the ids of the users.
+func userKeys(records map[string]*EventUser) []string {
+	result := make([]string, 0, len(records))
+
+	for key := range records {
+		result = append(result, key)
+	}
+
+	return result
+}
+
+// teamKeys returns the ids of the teams.
+func teamKeys(records map[string]*EventTeam) []string {
+	result := make([]string, 0, len(records))
+
+	for key := range records {
+		result = append(result, key)
+	}
+
+	return result
+}
+
+// memberKeys returns the ids of the memberships.
+func memberKeys(records map[string]*EventMember) []string {
+	result := make([]string, 0, len(records))
+
+	for key := range records {
+		result = append(result, key)
+	}
+
+	return result
+}
+
+// unionKeys merges both lists into a sorted list without duplicates.
+func unionKeys(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	result := make([]string, 0, len(a)+len(b))
+
+	for _, key := range append(a, b...) {
+		if !seen[key] {
+			seen[key] = true
+			result = append(result, key)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
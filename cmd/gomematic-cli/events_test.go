@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEventsTailResume(t *testing.T) {
+	dir, cleanup := testConfigDir(t)
+	defer cleanup()
+
+	api := newFakeAPI()
+
+	admin := api.AddUser("admin", true, true)
+	ops := api.AddTeam("ops")
+	api.AddMember(admin, ops, "owner")
+
+	server, client := testServer(t, api)
+	defer server.Close()
+
+	state := filepath.Join(dir, "events.json")
+
+	tail := func() []*Event {
+		c := testContext(t, Events().Subcommands[0].Flags, "--server", server.URL, "--once", "--state", state)
+		output := testStdout(t, func() {
+			if err := EventsTail(context.Background(), c, client); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		result := make([]*Event, 0)
+
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+			if line == "" {
+				continue
+			}
+
+			event := &Event{}
+
+			if err := json.Unmarshal([]byte(line), event); err != nil {
+				t.Fatalf("failed to parse event %q: %s", line, err)
+			}
+
+			result = append(result, event)
+		}
+
+		return result
+	}
+
+	if events := tail(); len(events) != 0 {
+		t.Fatalf("expected no events for the initial state, got %d", len(events))
+	}
+
+	bob := api.AddUser("bob", false, true)
+	api.AddMember(bob, ops, "user")
+
+	events := tail()
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	for i, expected := range []struct {
+		seq  int64
+		kind string
+	}{
+		{1, "user.created"},
+		{2, "team.member_added"},
+	} {
+		if events[i].Sequence != expected.seq || events[i].Type != expected.kind {
+			t.Errorf("expected event %d to be %s, got %d %s", expected.seq, expected.kind, events[i].Sequence, events[i].Type)
+		}
+	}
+
+	if events := tail(); len(events) != 0 {
+		t.Errorf("expected no events after resuming without changes, got %d", len(events))
+	}
+
+	api.AddUser("carol", false, false)
+	events = tail()
+
+	if len(events) != 1 || events[0].Sequence != 3 || events[0].Type != "user.created" {
+		t.Errorf("expected a single continued event, got %+v", events)
+	}
+}
+
+// testStdout captures everything the function writes to stdout.
+func testStdout(t *testing.T, fn func()) string {
+	file, err := ioutil.TempFile("", "gomematic-stdout")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	stdout := os.Stdout
+	os.Stdout = file
+
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	fn()
+
+	content, err := ioutil.ReadFile(file.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
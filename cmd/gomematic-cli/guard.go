@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gomematic/gomematic-go/models"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// GuardBatchOwners refuses to continue if removing or demoting all users of
+// a batch would leave any of the teams without owner, the users are keyed by
+// the team. Checking the whole batch upfront prevents concurrent items from
+// removing every owner of a team, this can be skipped by the force flag.
+func GuardBatchOwners(ctx context.Context, c *cli.Context, client *Client, demoted map[string][]string) error {
+	if c.Bool("force") {
+		return nil
+	}
+
+	current := make(map[string][]*models.TeamUser, len(demoted))
+	plans := make(map[string][]*membershipChange, len(demoted))
+
+	for teamID, userIDs := range demoted {
+		members, err := teamUsers(ctx, client, teamID)
+
+		if err != nil {
+			return err
+		}
+
+		current[teamID] = members
+
+		for _, userID := range userIDs {
+			plans[teamID] = append(plans[teamID], &membershipChange{
+				Action: "remove",
+				Target: userID,
+			})
+		}
+	}
+
+	return GuardTeamOwners(c, current, plans)
+}
+
+// GuardTeamOwners refuses to apply membership changes which would leave any
+// of the teams without owner, current members and changes are keyed by the
+// team. This can be skipped by the force flag.
+func GuardTeamOwners(c *cli.Context, current map[string][]*models.TeamUser, plans map[string][]*membershipChange) error {
+	if c.Bool("force") {
+		return nil
+	}
+
+	affected := make([]string, 0)
+
+	for teamID, plan := range plans {
+		if leavesNoOwner(current[teamID], plan) {
+			affected = append(affected, teamID)
+		}
+	}
+
+	if len(affected) == 0 {
+		return nil
+	}
+
+	sort.Strings(affected)
+
+	msgs := []string{
+		"the changes would leave the following teams without owner:",
+		"",
+	}
+
+	for _, teamID := range affected {
+		msgs = append(
+			msgs,
+			fmt.Sprintf("- %s, transfer it first via team transfer --id %s --to <user>", teamID, teamID),
+		)
+	}
+
+	msgs = append(
+		msgs,
+		"",
+		"use --force if you really want to leave these teams without owner",
+	)
+
+	return fmt.Errorf(strings.Join(msgs, "\n"))
+}
+
+// leavesNoOwner checks if the membership changes would remove the last
+// owner of a team, teams without any owner are left alone.
+func leavesNoOwner(current []*models.TeamUser, plan []*membershipChange) bool {
+	before, after := ownersAfter(current, plan)
+	return before > 0 && after <= 0
+}
+
+// ownersAfter counts the owners of a team before and after applying the
+// membership changes, targets of the changes are user ids or slugs. Every
+// member is only counted once, even if multiple changes refer to it.
+func ownersAfter(current []*models.TeamUser, plan []*membershipChange) (int, int) {
+	before, after := 0, 0
+
+	for _, member := range current {
+		owner := member.Perm != nil && *member.Perm == "owner"
+
+		if owner {
+			before++
+		}
+
+		for _, change := range plan {
+			if !matchUser(member.User, change.Target) {
+				continue
+			}
+
+			switch change.Action {
+			case "append", "perm":
+				owner = change.To == "owner"
+			case "remove":
+				owner = false
+			}
+		}
+
+		if owner {
+			after++
+		}
+	}
+
+	for _, change := range plan {
+		if change.Action != "append" || change.To != "owner" {
+			continue
+		}
+
+		known := false
+
+		for _, member := range current {
+			if matchUser(member.User, change.Target) {
+				known = true
+			}
+		}
+
+		if !known {
+			after++
+		}
+	}
+
+	return before, after
+}
+
+// ownedTeams filters the teams where the assignment grants ownership.
+func ownedTeams(records []*models.TeamUser) []string {
+	result := make([]string, 0)
+
+	for _, record := range records {
+		if record.Perm == nil || *record.Perm != "owner" || record.Team == nil {
+			continue
+		}
+
+		if record.Team.Slug != nil {
+			result = append(result, *record.Team.Slug)
+		} else {
+			result = append(result, record.Team.ID.String())
+		}
+	}
+
+	return result
+}
+
+// matchUser checks if the user matches the given id or slug.
+func matchUser(record *models.User, userID string) bool {
+	if record == nil {
+		return false
+	}
+
+	return record.ID.String() == userID || (record.Slug != nil && *record.Slug == userID)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+func TestGuardBatchOwners(t *testing.T) {
+	api := newFakeAPI()
+
+	admin := api.AddUser("admin", true, true)
+	bob := api.AddUser("bob", false, true)
+	carol := api.AddUser("carol", false, true)
+
+	ops := api.AddTeam("ops")
+	dev := api.AddTeam("dev")
+
+	api.AddMember(admin, ops, "owner")
+	api.AddMember(bob, ops, "owner")
+	api.AddMember(carol, ops, "user")
+	api.AddMember(admin, dev, "owner")
+
+	server, client := testServer(t, api)
+	defer server.Close()
+
+	flags := []cli.Flag{
+		&cli.BoolFlag{
+			Name: "force",
+		},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		demoted  map[string][]string
+		args     []string
+		affected []string
+	}{
+		{
+			name:    "single owner of many",
+			demoted: map[string][]string{"ops": {"admin"}},
+		},
+		{
+			name:     "all owners of the batch",
+			demoted:  map[string][]string{"ops": {"admin", "bob"}},
+			affected: []string{"ops"},
+		},
+		{
+			name:     "only owner of a team",
+			demoted:  map[string][]string{"ops": {"admin"}, "dev": {"admin"}},
+			affected: []string{"dev"},
+		},
+		{
+			name:    "duplicates by id and slug",
+			demoted: map[string][]string{"ops": {"admin", admin}},
+		},
+		{
+			name:    "no owners affected",
+			demoted: map[string][]string{"ops": {"carol"}},
+		},
+		{
+			name:    "forced",
+			demoted: map[string][]string{"ops": {"admin", "bob"}},
+			args:    []string{"--force"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testContext(t, flags, tc.args...)
+			err := GuardBatchOwners(context.Background(), c, client, tc.demoted)
+
+			if len(tc.affected) == 0 {
+				if err != nil {
+					t.Errorf("expected no error, got %s", err)
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected %v to be guarded", tc.affected)
+			}
+
+			for _, teamID := range tc.affected {
+				if !strings.Contains(err.Error(), "- "+teamID+",") {
+					t.Errorf("expected %s to be affected, got:\n%s", teamID, err)
+				}
+			}
+		})
+	}
+
+	for _, req := range api.Requests() {
+		if !strings.HasPrefix(req, "GET ") {
+			t.Errorf("expected guard to only read, got %s", req)
+		}
+	}
+}
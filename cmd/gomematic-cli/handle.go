@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/url"
@@ -8,6 +9,7 @@ import (
 	"path"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/go-openapi/errors"
 	"github.com/go-openapi/runtime"
@@ -19,8 +21,11 @@ import (
 	transport "github.com/go-openapi/runtime/client"
 )
 
+// ExitInterrupted defines the exit code for commands aborted by a signal.
+const ExitInterrupted = 130
+
 // HandleFunc is the real handle implementation.
-type HandleFunc func(c *cli.Context, client *Client) error
+type HandleFunc func(ctx context.Context, c *cli.Context, client *Client) error
 
 // Client simply wraps the openapi client including authentication.
 type Client struct {
@@ -31,30 +36,130 @@ type Client struct {
 // Handle wraps the command function handler.
 func Handle(c *cli.Context, fn HandleFunc) error {
 	if c.String("server") == "" {
-		fmt.Fprintf(os.Stderr, "error: you must provide the server address.\n")
+		logger.Error("you must provide the server address.")
+		os.Exit(1)
+	}
+
+	if err := ResolveSecrets(c, "password", "bearer-token"); err != nil {
+		logger.Error(err.Error())
 		os.Exit(1)
 	}
 
 	server, err := url.Parse(c.String("server"))
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: invalid server address, bad format?.\n")
+		logger.Error("invalid server address, bad format?.")
 		os.Exit(1)
 	}
 
+	ctx := RootContext(c)
+
+	if c.Duration("deadline") > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Duration("deadline"))
+		defer cancel()
+	}
+
+	if c.Bool("offline") && c.Bool("no-cache") {
+		logger.Error("offline mode requires the cache.")
+		os.Exit(1)
+	}
+
+	if c.Bool("offline") && isMutation(commandPath(c)) {
+		logger.Error("you can not modify records in offline mode.")
+		os.Exit(1)
+	}
+
+	client, cache := newClient(c, server)
+
+	command := strings.Join(commandPath(c), " ")
+
+	ctx, span := StartSpan(ctx, "gomematic-cli "+command, SpanInternal)
+	span.SetAttribute("gomematic.command", command)
+	span.SetAttribute("gomematic.server", server.Host)
+	span.SetAttribute("gomematic.context", c.String("context"))
+
+	entry := auditBegin(ctx, c, client)
+	saveSnapshot(c, entry)
+
+	started := time.Now()
+	logger.Debug("executing command", "command", command, "server", c.String("server"), "context", c.String("context"))
+
+	err = fn(ctx, c, client)
+	auditFinish(c, client, entry, err)
+
+	logger.Debug("finished command", "command", command, "duration", time.Since(started).Round(time.Millisecond), "success", err == nil)
+
+	if cache != nil {
+		cache.Banner()
+	}
+
+	span.SetError(err)
+	span.Finish()
+	tracer.Shutdown()
+
+	if err != nil {
+		exitError(c, err)
+	}
+
+	return nil
+}
+
+// exitError prints the error of a failed command and exits with the
+// matching exit code.
+func exitError(c *cli.Context, err error) {
+	logger.Error(err.Error())
+
+	if RootContext(c).Err() != nil {
+		os.Exit(ExitInterrupted)
+	}
+
+	if val, ok := err.(*BatchError); ok && val.Partial() {
+		os.Exit(ExitPartial)
+	}
+
+	os.Exit(2)
+}
+
+// newClient initializes the api client including the transports for the
+// cache, logging, tracing and retries.
+func newClient(c *cli.Context, server *url.URL) (*Client, *cacheTransport) {
+	rt := transport.New(
+		server.Host,
+		path.Join(
+			server.Path,
+			gomematic.DefaultBasePath,
+		),
+		[]string{
+			server.Scheme,
+		},
+	)
+
+	var cache *cacheTransport
+
+	if !c.Bool("no-cache") {
+		cache = newCacheTransport(c, rt.Transport)
+		rt.Transport = cache
+	}
+
+	if logger.Enabled(LevelTrace) {
+		rt.Transport = &logTransport{next: rt.Transport}
+	}
+
+	if tracer != nil {
+		rt.Transport = &traceTransport{next: rt.Transport}
+	}
+
 	client := &Client{
-		GomematicOpen: gomematic.NewHTTPClientWithConfig(
-			strfmt.Default,
-			&gomematic.TransportConfig{
-				Host: server.Host,
-				BasePath: path.Join(
-					server.Path,
-					gomematic.DefaultBasePath,
-				),
-				Schemes: []string{
-					server.Scheme,
-				},
+		GomematicOpen: gomematic.New(
+			&retryTransport{
+				next:    rt,
+				timeout: c.Duration("timeout"),
+				retries: c.Int("retries"),
+				backoff: c.Duration("retry-backoff"),
+				unsafe:  c.Bool("retry-unsafe"),
 			},
+			strfmt.Default,
 		),
 	}
 
@@ -68,16 +173,54 @@ func Handle(c *cli.Context, fn HandleFunc) error {
 		client.AuthInfo = transport.PassThroughAuth
 	}
 
-	if err := fn(c, client); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %s\n", err.Error())
-		os.Exit(2)
+	return client, cache
+}
+
+// RootContext returns the cancellable context attached to the app by main.
+func RootContext(c *cli.Context) context.Context {
+	if ctx, ok := c.App.Metadata["context"].(context.Context); ok {
+		return ctx
+	}
+
+	return context.Background()
+}
+
+// NetworkError checks if the error is a networking error handled by PrettyError.
+func NetworkError(err error) bool {
+	if val, ok := err.(*url.Error); ok {
+		if _, ok := val.Err.(*OfflineError); ok {
+			return false
+		}
 	}
 
-	return nil
+	switch err.(type) {
+	case *net.OpError, syscall.Errno, net.Error:
+		return true
+	default:
+		return false
+	}
 }
 
 // PrettyError catches regular networking errors and prints it.
 func PrettyError(err error) error {
+	if val, ok := err.(*url.Error); ok && val.Err == context.Canceled {
+		return fmt.Errorf("request to server had been canceled")
+	}
+
+	if val, ok := err.(*url.Error); ok {
+		if inner, ok := val.Err.(*OfflineError); ok {
+			return inner
+		}
+	}
+
+	if val, ok := err.(*RetryError); ok {
+		return fmt.Errorf(
+			"%s, giving up after %d attempts",
+			PrettyError(val.Err),
+			val.Attempts,
+		)
+	}
+
 	if val, ok := err.(net.Error); ok && val.Timeout() {
 		return fmt.Errorf("connection to server timed out")
 	}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"text/template"
 
 	"github.com/Masterminds/sprig"
@@ -20,19 +22,90 @@ func GetIdentifierParam(c *cli.Context) string {
 	val := c.String("id")
 
 	if val == "" {
-		fmt.Println("error: you must provide an id or a slug.")
+		logger.Error("you must provide an id or a slug.")
 		os.Exit(1)
 	}
 
 	return val
 }
 
+// GetIdentifierParams checks and returns all record id/slug parameters,
+// they can be passed as repeated flag, as arguments or via - on stdin.
+func GetIdentifierParams(c *cli.Context) []string {
+	result, err := identifierParams(c)
+
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if len(result) == 0 {
+		logger.Error("you must provide an id or a slug.")
+		os.Exit(1)
+	}
+
+	return result
+}
+
+// identifierParams collects the identifiers once, stdin can only be read a
+// single time and the audit journal requires them before the command.
+func identifierParams(c *cli.Context) ([]string, error) {
+	if val, ok := c.App.Metadata["identifiers"].([]string); ok {
+		return val, nil
+	}
+
+	values := make([]string, 0)
+
+	for _, flag := range c.Command.Flags {
+		if flag.Names()[0] != "id" {
+			continue
+		}
+
+		if _, ok := flag.(*cli.StringSliceFlag); ok {
+			values = append(values, c.StringSlice("id")...)
+			values = append(values, c.Args().Slice()...)
+		} else if val := c.String("id"); val != "" {
+			values = append(values, val)
+		}
+	}
+
+	result := make([]string, 0, len(values))
+
+	for _, val := range values {
+		lines := []string{val}
+
+		if val == "-" {
+			if secretStdin != "" {
+				return nil, fmt.Errorf("stdin is already used by %s", secretStdin)
+			}
+
+			secretStdin = "id"
+			content, err := ioutil.ReadAll(os.Stdin)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ids from stdin: %s", err)
+			}
+
+			lines = strings.Split(string(content), "\n")
+		}
+
+		for _, line := range lines {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") && !containsString(result, line) {
+				result = append(result, line)
+			}
+		}
+	}
+
+	c.App.Metadata["identifiers"] = result
+	return result, nil
+}
+
 // GetUserParam checks and returns the user id/slug parameter.
 func GetUserParam(c *cli.Context) string {
 	val := c.String("user")
 
 	if val == "" {
-		fmt.Println("error: you must provide a user id or slug.")
+		logger.Error("you must provide a user id or slug.")
 		os.Exit(1)
 	}
 
@@ -44,7 +117,7 @@ func GetTeamParam(c *cli.Context) string {
 	val := c.String("team")
 
 	if val == "" {
-		fmt.Println("error: you must provide a team id or slug.")
+		logger.Error("you must provide a team id or slug.")
 		os.Exit(1)
 	}
 
@@ -56,18 +129,27 @@ func GetPermParam(c *cli.Context) string {
 	val := c.String("perm")
 
 	if val == "" {
-		fmt.Println("error: you must provide a permission.")
+		logger.Error("you must provide a permission.")
 		os.Exit(1)
 	}
 
-	for _, perm := range []string{"user", "admin", "owner"} {
-		if perm == val {
-			return val
-		}
+	if validPerm(val) {
+		return val
 	}
 
-	fmt.Println("error: invalid permission, can be user, admin or owner.")
+	logger.Error("invalid permission, can be user, admin or owner.")
 	os.Exit(1)
 
 	return ""
 }
+
+// validPerm checks if the permission is one of user, admin or owner.
+func validPerm(val string) bool {
+	for _, perm := range []string{"user", "admin", "owner"} {
+		if perm == val {
+			return true
+		}
+	}
+
+	return false
+}
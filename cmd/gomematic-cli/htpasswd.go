@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// htpasswdCrypt matches the traditional 13 character crypt hashes.
+var htpasswdCrypt = regexp.MustCompile(`^[./0-9A-Za-z]{13}$`)
+
+// credentialFlags defines the flags shared by the importers of files
+// without usable email addresses and passwords.
+func credentialFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "group",
+			Value: "",
+			Usage: "path to the group file mapped to teams",
+		},
+		&cli.StringFlag{
+			Name:  "email-domain",
+			Value: "",
+			Usage: "domain to build email addresses like user@domain",
+		},
+		&cli.StringFlag{
+			Name:  "passwords",
+			Value: "generate",
+			Usage: "generate or require passwords for new users, hashes can not be reused",
+		},
+	}
+}
+
+// passwdImportFlags defines the flags of the passwd import.
+func passwdImportFlags() []cli.Flag {
+	return append(
+		credentialFlags(),
+		&cli.IntFlag{
+			Name:  "min-uid",
+			Value: 1000,
+			Usage: "lowest uid to import, lower ones are system accounts",
+		},
+		&cli.IntFlag{
+			Name:  "max-uid",
+			Value: 60000,
+			Usage: "highest uid to import",
+		},
+		&cli.IntFlag{
+			Name:  "min-gid",
+			Value: 1000,
+			Usage: "lowest gid to import, lower ones are system groups",
+		},
+	)
+}
+
+// ImportHtpasswd provides the sub-command to import users from htpasswd.
+func ImportHtpasswd(ctx context.Context, c *cli.Context, client *Client) error {
+	if err := checkCredentialFlags(c); err != nil {
+		return err
+	}
+
+	name := c.Args().First()
+	lines, err := readImportLines(name)
+
+	if err != nil {
+		return err
+	}
+
+	set := &ImportSet{}
+	imported := make([]string, 0)
+
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("%s:%d: invalid entry, expected user:hash", name, i+1)
+		}
+
+		row := &ImportUser{
+			Username: parts[0],
+			Email:    importEmail(c, parts[0], ""),
+			Source:   fmt.Sprintf("%s:%d", name, i+1),
+		}
+
+		if row.Email == "" {
+			return fmt.Errorf("%s: no email for %s, you must provide an email domain", row.Source, row.Username)
+		}
+
+		if !hashedPassword(parts[1]) {
+			row.Password = parts[1]
+		}
+
+		set.Users = append(set.Users, row)
+		imported = append(imported, row.Username)
+	}
+
+	if group := c.String("group"); group != "" {
+		lines, err := readImportLines(group)
+
+		if err != nil {
+			return err
+		}
+
+		for i, line := range lines {
+			line = strings.TrimSpace(line)
+
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			parts := strings.SplitN(line, ":", 2)
+
+			if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+				return fmt.Errorf("%s:%d: invalid entry, expected group: user user", group, i+1)
+			}
+
+			row := &ImportTeam{
+				Name:    strings.TrimSpace(parts[0]),
+				Members: make([]string, 0),
+				Source:  fmt.Sprintf("%s:%d", group, i+1),
+			}
+
+			for _, username := range strings.Fields(parts[1]) {
+				if !containsString(imported, username) {
+					set.Skipped = append(set.Skipped, fmt.Sprintf("%s: skip member %s of %s, user not imported", row.Source, username, row.Name))
+					continue
+				}
+
+				if !containsString(row.Members, username) {
+					row.Members = append(row.Members, username)
+				}
+			}
+
+			set.Teams = append(set.Teams, row)
+		}
+	}
+
+	if len(set.Users) == 0 {
+		return fmt.Errorf("no users found in %s", name)
+	}
+
+	printImportMapping(set)
+	return applyImport(ctx, c, client, set)
+}
+
+// ImportPasswd provides the sub-command to import users from passwd.
+func ImportPasswd(ctx context.Context, c *cli.Context, client *Client) error {
+	if err := checkCredentialFlags(c); err != nil {
+		return err
+	}
+
+	name := c.Args().First()
+	lines, err := readImportLines(name)
+
+	if err != nil {
+		return err
+	}
+
+	set := &ImportSet{}
+	imported := make([]string, 0)
+	primary := make(map[string][]string)
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		source := fmt.Sprintf("%s:%d", name, i+1)
+		parts := strings.Split(line, ":")
+
+		if len(parts) != 7 || parts[0] == "" {
+			return fmt.Errorf("%s: invalid entry, expected 7 fields", source)
+		}
+
+		uid, err := strconv.Atoi(parts[2])
+
+		if err != nil {
+			return fmt.Errorf("%s: invalid uid %q", source, parts[2])
+		}
+
+		if uid < c.Int("min-uid") || uid > c.Int("max-uid") {
+			set.Skipped = append(set.Skipped, fmt.Sprintf("%s: skip %s, uid %d outside of %d-%d", source, parts[0], uid, c.Int("min-uid"), c.Int("max-uid")))
+			continue
+		}
+
+		candidate := ""
+
+		for _, field := range strings.Split(parts[4], ",") {
+			if strings.Contains(field, "@") {
+				candidate = strings.TrimSpace(field)
+			}
+		}
+
+		row := &ImportUser{
+			Username: parts[0],
+			Email:    importEmail(c, parts[0], candidate),
+			Source:   source,
+		}
+
+		if row.Email == "" {
+			return fmt.Errorf("%s: no email for %s, you must provide an email domain", source, row.Username)
+		}
+
+		set.Users = append(set.Users, row)
+		imported = append(imported, row.Username)
+		primary[parts[3]] = append(primary[parts[3]], row.Username)
+	}
+
+	if group := c.String("group"); group != "" {
+		lines, err := readImportLines(group)
+
+		if err != nil {
+			return err
+		}
+
+		for i, line := range lines {
+			if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			source := fmt.Sprintf("%s:%d", group, i+1)
+			parts := strings.Split(line, ":")
+
+			if len(parts) != 4 || parts[0] == "" {
+				return fmt.Errorf("%s: invalid entry, expected 4 fields", source)
+			}
+
+			gid, err := strconv.Atoi(parts[2])
+
+			if err != nil {
+				return fmt.Errorf("%s: invalid gid %q", source, parts[2])
+			}
+
+			if gid < c.Int("min-gid") {
+				set.Skipped = append(set.Skipped, fmt.Sprintf("%s: skip %s, gid %d below %d", source, parts[0], gid, c.Int("min-gid")))
+				continue
+			}
+
+			members := append([]string{}, primary[parts[2]]...)
+
+			for _, username := range strings.Split(parts[3], ",") {
+				if username = strings.TrimSpace(username); username != "" && !containsString(members, username) {
+					members = append(members, username)
+				}
+			}
+
+			row := &ImportTeam{
+				Name:    parts[0],
+				Members: make([]string, 0),
+				Source:  source,
+			}
+
+			for _, username := range members {
+				if !containsString(imported, username) {
+					set.Skipped = append(set.Skipped, fmt.Sprintf("%s: skip member %s of %s, user not imported", source, username, row.Name))
+					continue
+				}
+
+				row.Members = append(row.Members, username)
+			}
+
+			switch {
+			case len(row.Members) == 0:
+				set.Skipped = append(set.Skipped, fmt.Sprintf("%s: skip %s, no imported members", source, row.Name))
+			case len(row.Members) == 1 && row.Members[0] == row.Name:
+				set.Skipped = append(set.Skipped, fmt.Sprintf("%s: skip %s, user private group", source, row.Name))
+			default:
+				set.Teams = append(set.Teams, row)
+			}
+		}
+	}
+
+	if len(set.Users) == 0 {
+		return fmt.Errorf("no users found in %s", name)
+	}
+
+	printImportMapping(set)
+	return applyImport(ctx, c, client, set)
+}
+
+// checkCredentialFlags validates the arguments shared by the importers.
+func checkCredentialFlags(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("you must provide a single file, or - for stdin")
+	}
+
+	if val := c.String("passwords"); val != "generate" && val != "require" {
+		return fmt.Errorf("invalid passwords mode %s, can be generate or require", val)
+	}
+
+	return nil
+}
+
+// readImportLines reads all lines of the file, - reads from stdin.
+func readImportLines(name string) ([]string, error) {
+	input, err := openImport(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer input.Close()
+
+	result := make([]string, 0)
+	scanner := bufio.NewScanner(input)
+
+	for scanner.Scan() {
+		result = append(result, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", name, err)
+	}
+
+	return result, nil
+}
+
+// importEmail prefers the given candidate and falls back to an address
+// built from the email domain.
+func importEmail(c *cli.Context, username, candidate string) string {
+	if candidate != "" {
+		return candidate
+	}
+
+	if domain := strings.TrimPrefix(c.String("email-domain"), "@"); domain != "" {
+		return username + "@" + domain
+	}
+
+	return ""
+}
+
+// hashedPassword detects the hash formats supported by htpasswd, only
+// other values are treated as clear text.
+func hashedPassword(val string) bool {
+	if val == "" || strings.HasPrefix(val, "$") || strings.HasPrefix(val, "{") {
+		return true
+	}
+
+	return htpasswdCrypt.MatchString(val)
+}
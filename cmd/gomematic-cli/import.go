@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/gomematic/gomematic-go/models"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// ImportSet represents the users and teams read from an external source.
+type ImportSet struct {
+	Users   []*ImportUser
+	Teams   []*ImportTeam
+	Skipped []string
+}
+
+// ImportUser represents a single user to import.
+type ImportUser struct {
+	Username string
+	Email    string
+	Active   *bool
+	Password string
+	Source   string
+}
+
+// ImportTeam represents a single team to import, members are usernames.
+type ImportTeam struct {
+	Name    string
+	Members []string
+	Source  string
+}
+
+// importFlags defines the flags shared by all importers.
+func importFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "keep-extra",
+			Usage: "keep team members which are not listed in the source",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "only show the plan without applying it",
+		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "allow to leave teams without owner",
+		},
+		&cli.IntFlag{
+			Name:  "length",
+			Value: 20,
+			Usage: "length of generated passwords",
+		},
+		&cli.StringFlag{
+			Name:  "credentials",
+			Value: "",
+			Usage: "write generated passwords to this file instead of stdout",
+		},
+		&cli.IntFlag{
+			Name:  "concurrency",
+			Value: 8,
+			Usage: "number of parallel requests",
+		},
+	}
+}
+
+// Export provides the sub-command to export records.
+func Export() *cli.Command {
+	return &cli.Command{
+		Name:  "export",
+		Usage: "export users and teams",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "ldif",
+				Usage:     "export users and teams as ldif",
+				ArgsUsage: " ",
+				Flags:     ldifExportFlags(),
+				Action: func(c *cli.Context) error {
+					return Handle(c, ExportLDIF)
+				},
+			},
+		},
+	}
+}
+
+// Import provides the sub-command to import records.
+func Import() *cli.Command {
+	return &cli.Command{
+		Name:  "import",
+		Usage: "import users and teams",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "ldif",
+				Usage:     "import users, teams and memberships from ldif",
+				ArgsUsage: "<file>",
+				Flags:     append(ldifMappingFlags(), importFlags()...),
+				Action: func(c *cli.Context) error {
+					return Handle(c, ImportLDIF)
+				},
+			},
+			{
+				Name:      "htpasswd",
+				Usage:     "import users from htpasswd and teams from an apache group file",
+				ArgsUsage: "<file>",
+				Flags:     append(credentialFlags(), importFlags()...),
+				Action: func(c *cli.Context) error {
+					return Handle(c, ImportHtpasswd)
+				},
+			},
+			{
+				Name:      "passwd",
+				Usage:     "import users from passwd and teams from a group file",
+				ArgsUsage: "<file>",
+				Flags:     append(passwdImportFlags(), importFlags()...),
+				Action: func(c *cli.Context) error {
+					return Handle(c, ImportPasswd)
+				},
+			},
+		},
+	}
+}
+
+// importChange represents a single step of an import.
+type importChange struct {
+	Action string
+	User   *ImportUser
+	Team   *ImportTeam
+	Change *membershipChange
+	Record *models.User
+	Member string
+}
+
+// String implements the fmt.Stringer interface.
+func (i *importChange) String() string {
+	switch i.Action {
+	case "create-user":
+		return fmt.Sprintf("create user %s", i.User.Username)
+	case "update-user":
+		return fmt.Sprintf("update user %s", i.User.Username)
+	case "create-team":
+		return fmt.Sprintf("create team %s", i.Team.Name)
+	default:
+		change := *i.Change
+
+		if i.Member != "" {
+			change.Target = i.Member
+		}
+
+		return fmt.Sprintf("team %s: %s", i.Team.Name, &change)
+	}
+}
+
+// applyImport creates and updates users, teams and memberships to match the
+// import set. Single failures do not abort the import, they get counted
+// and reported at the end.
+func applyImport(ctx context.Context, c *cli.Context, client *Client, set *ImportSet) error {
+	users, err := listUsers(ctx, client)
+
+	if err != nil {
+		return err
+	}
+
+	teams, err := listTeams(ctx, client)
+
+	if err != nil {
+		return err
+	}
+
+	existingUsers := make(map[string]*models.User, len(users))
+
+	for _, record := range users {
+		existingUsers[strings.ToLower(stringValue(record.Username, ""))] = record
+		existingUsers[strings.ToLower(stringValue(record.Slug, ""))] = record
+	}
+
+	existingTeams := make(map[string]*models.Team, len(teams))
+
+	for _, record := range teams {
+		existingTeams[strings.ToLower(stringValue(record.Name, ""))] = record
+		existingTeams[strings.ToLower(stringValue(record.Slug, ""))] = record
+	}
+
+	plan := make([]*importChange, 0)
+	ids := make(map[string]string)
+
+	for _, row := range set.Users {
+		record, ok := existingUsers[strings.ToLower(row.Username)]
+
+		if !ok {
+			plan = append(plan, &importChange{Action: "create-user", User: row})
+			continue
+		}
+
+		ids[strings.ToLower(row.Username)] = record.ID.String()
+
+		if (row.Email != "" && !strings.EqualFold(row.Email, stringValue(record.Email, ""))) ||
+			(row.Active != nil && (record.Active == nil || *record.Active != *row.Active)) ||
+			row.Password != "" {
+			plan = append(plan, &importChange{Action: "update-user", User: row, Record: record})
+		}
+	}
+
+	members := make([][]*models.TeamUser, len(set.Teams))
+
+	if err := parallel(ctx, c.Int("concurrency"), len(set.Teams), func(ctx context.Context, i int) error {
+		record, ok := existingTeams[strings.ToLower(set.Teams[i].Name)]
+
+		if !ok {
+			return nil
+		}
+
+		result, err := teamUsers(ctx, client, record.ID.String())
+
+		if err != nil {
+			return fmt.Errorf("failed to fetch users of %s: %s", set.Teams[i].Name, err)
+		}
+
+		members[i] = result
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	current := make(map[string][]*models.TeamUser, len(set.Teams))
+	memberPlans := make(map[string][]*membershipChange, len(set.Teams))
+
+	for i, row := range set.Teams {
+		if _, ok := existingTeams[strings.ToLower(row.Name)]; !ok {
+			plan = append(plan, &importChange{Action: "create-team", Team: row})
+		}
+
+		desired := make([][2]string, 0, len(row.Members))
+
+		for _, username := range row.Members {
+			target := username
+
+			if id, ok := ids[strings.ToLower(username)]; ok {
+				target = id
+			} else if record, ok := existingUsers[strings.ToLower(username)]; ok {
+				target = record.ID.String()
+			}
+
+			perm := "user"
+
+			for _, member := range members[i] {
+				if matchUser(member.User, target) && member.Perm != nil {
+					perm = *member.Perm
+				}
+			}
+
+			desired = append(desired, [2]string{target, perm})
+		}
+
+		changes := planTeamUserSync(members[i], desired, c.Bool("keep-extra"))
+
+		current[row.Name] = members[i]
+		memberPlans[row.Name] = changes
+
+		for _, change := range changes {
+			member := change.Target
+
+			for _, record := range users {
+				if matchUser(record, change.Target) {
+					member = stringValue(record.Username, member)
+				}
+			}
+
+			plan = append(plan, &importChange{Action: "membership", Team: row, Change: change, Member: member})
+		}
+	}
+
+	if len(plan) == 0 {
+		logger.Info("nothing to import...")
+		return nil
+	}
+
+	if err := GuardTeamOwners(c, current, memberPlans); err != nil {
+		return err
+	}
+
+	if c.String("passwords") == "require" {
+		missing := make([]string, 0)
+
+		for _, change := range plan {
+			if change.Action == "create-user" && change.User.Password == "" {
+				missing = append(missing, change.User.Username)
+			}
+		}
+
+		if len(missing) > 0 {
+			return fmt.Errorf("passwords are required, but missing for %s", strings.Join(missing, ", "))
+		}
+	}
+
+	for _, change := range plan {
+		fmt.Fprintln(os.Stdout, change)
+	}
+
+	if c.Bool("dry-run") {
+		return nil
+	}
+
+	policy := GetConfig(c).Password
+	credentials := make([][2]string, 0)
+	teamIDs := make(map[string]string)
+	failed := 0
+
+	for _, record := range teams {
+		teamIDs[strings.ToLower(stringValue(record.Name, ""))] = record.ID.String()
+		teamIDs[strings.ToLower(stringValue(record.Slug, ""))] = record.ID.String()
+	}
+
+	for i, change := range plan {
+		if ctx.Err() != nil {
+			if err := writeCredentials(c, credentials); err != nil {
+				logger.Error(err.Error())
+			}
+
+			return fmt.Errorf("interrupted after %d of %d changes", i, len(plan))
+		}
+
+		var err error
+
+		switch change.Action {
+		case "create-user":
+			var generated string
+			generated, err = importCreateUser(ctx, client, policy, c.Int("length"), change.User, ids)
+
+			if generated != "" {
+				credentials = append(credentials, [2]string{change.User.Username, generated})
+			}
+		case "update-user":
+			err = importUpdateUser(ctx, client, policy, change.User, change.Record)
+		case "create-team":
+			var record *models.Team
+			record, err = teamCreate(ctx, client, &models.Team{Name: &change.Team.Name})
+
+			if err == nil {
+				teamIDs[strings.ToLower(change.Team.Name)] = record.ID.String()
+			}
+		case "membership":
+			teamID, ok := teamIDs[strings.ToLower(change.Team.Name)]
+
+			if !ok {
+				err = fmt.Errorf("team %s does not exist", change.Team.Name)
+				break
+			}
+
+			target := change.Change.Target
+
+			if id, ok := ids[strings.ToLower(target)]; ok {
+				target = id
+			}
+
+			switch change.Change.Action {
+			case "append":
+				_, err = teamUserAppend(ctx, client, teamID, target, change.Change.To)
+			case "perm":
+				_, err = teamUserPerm(ctx, client, teamID, target, change.Change.To)
+			case "remove":
+				_, err = teamUserRemove(ctx, client, teamID, target)
+			}
+		}
+
+		if err != nil {
+			logger.Errorf("failed to %s: %s", change, err)
+			failed++
+		}
+	}
+
+	if err := writeCredentials(c, credentials); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d import changes failed", failed, len(plan))
+	}
+
+	logger.Infof("successfully imported %d changes", len(plan))
+	return nil
+}
+
+// printImportMapping prints which source entries map to which users and
+// teams and which entries got skipped.
+func printImportMapping(set *ImportSet) {
+	for _, row := range set.Users {
+		password := "generated"
+
+		if row.Password != "" {
+			password = "provided"
+		}
+
+		fmt.Fprintf(os.Stdout, "%s: user %s <%s>, password %s\n", row.Source, row.Username, row.Email, password)
+	}
+
+	for _, row := range set.Teams {
+		members := "no members"
+
+		if len(row.Members) > 0 {
+			members = "members " + strings.Join(row.Members, ", ")
+		}
+
+		fmt.Fprintf(os.Stdout, "%s: team %s, %s\n", row.Source, row.Name, members)
+	}
+
+	for _, msg := range set.Skipped {
+		fmt.Fprintf(os.Stdout, "%s\n", msg)
+	}
+}
+
+// importCreateUser creates the user with the provided or a generated
+// password, the generated password gets returned for the handout.
+func importCreateUser(ctx context.Context, client *Client, policy *PasswordPolicy, length int, row *ImportUser, ids map[string]string) (string, error) {
+	if row.Email == "" {
+		return "", fmt.Errorf("an email is required")
+	}
+
+	password, generated := row.Password, ""
+
+	if password == "" {
+		val, err := policy.Generate(length, row.Username, row.Email)
+
+		if err != nil {
+			return "", err
+		}
+
+		password, generated = val, val
+	} else if err := policy.Check(password, row.Username, row.Email); err != nil {
+		return "", err
+	}
+
+	active := true
+
+	if row.Active != nil {
+		active = *row.Active
+	}
+
+	secret := strfmt.Password(password)
+
+	record, err := userCreate(ctx, client, &models.User{
+		Username: &row.Username,
+		Email:    &row.Email,
+		Active:   &active,
+		Password: &secret,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	ids[strings.ToLower(row.Username)] = record.ID.String()
+	return generated, nil
+}
+
+// importUpdateUser updates email, active state and password of the user.
+func importUpdateUser(ctx context.Context, client *Client, policy *PasswordPolicy, row *ImportUser, record *models.User) error {
+	if row.Email != "" {
+		record.Email = &row.Email
+	}
+
+	if row.Active != nil {
+		record.Active = row.Active
+	}
+
+	if row.Password != "" {
+		if err := policy.Check(row.Password, row.Username, stringValue(record.Email, "")); err != nil {
+			return err
+		}
+
+		secret := strfmt.Password(row.Password)
+		record.Password = &secret
+	}
+
+	record.Teams = nil
+	return userUpdate(ctx, client, record)
+}
+
+// writeCredentials hands out the generated passwords, either to the
+// credentials file or to stdout.
+func writeCredentials(c *cli.Context, credentials [][2]string) error {
+	if len(credentials) == 0 {
+		return nil
+	}
+
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i][0] < credentials[j][0]
+	})
+
+	name := c.String("credentials")
+
+	if name == "" {
+		for _, row := range credentials {
+			fmt.Fprintf(os.Stdout, "%s: %s\n", row[0], row[1])
+		}
+
+		return nil
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+
+	if err != nil {
+		return fmt.Errorf("failed to write credentials: %s", err)
+	}
+
+	defer file.Close()
+
+	if err := file.Chmod(0600); err != nil {
+		return fmt.Errorf("failed to protect credentials: %s", err)
+	}
+
+	for _, row := range credentials {
+		if _, err := fmt.Fprintf(file, "%s: %s\n", row[0], row[1]); err != nil {
+			return fmt.Errorf("failed to write credentials: %s", err)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write credentials: %s", err)
+	}
+
+	logger.Infof("credentials written to %s", name)
+	return nil
+}
@@ -0,0 +1,752 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	// ldifUserFields defines the user fields available for the mapping.
+	ldifUserFields = []string{"id", "slug", "username", "email", "active"}
+
+	// ldifTeamFields defines the team fields available for the mapping.
+	ldifTeamFields = []string{"id", "slug", "name"}
+
+	// ldifUserClasses defines the object classes treated as users.
+	ldifUserClasses = []string{"inetorgperson", "organizationalperson", "person", "posixaccount", "account"}
+
+	// ldifTeamClasses defines the object classes treated as teams.
+	ldifTeamClasses = []string{"groupofnames", "groupofuniquenames", "posixgroup"}
+)
+
+// ldifRecord represents a single entry of a ldif file.
+type ldifRecord struct {
+	Line  int
+	DN    string
+	Attrs map[string][]string
+}
+
+// First returns the first value of the attribute.
+func (r *ldifRecord) First(name string) string {
+	if values := r.Attrs[strings.ToLower(name)]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// ldifMapping represents the mapping between ldap attributes and fields,
+// the first attribute is used as rdn.
+type ldifMapping [][2]string
+
+// ldifMappingFlags defines the flags to configure the attribute mapping.
+func ldifMappingFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "user-attr",
+			Value: cli.NewStringSlice("uid=username", "cn=username", "sn=username", "mail=email"),
+			Usage: "mapping of user attributes like mail=email, the first one is the rdn",
+		},
+		&cli.StringSliceFlag{
+			Name:  "team-attr",
+			Value: cli.NewStringSlice("cn=name"),
+			Usage: "mapping of team attributes like cn=name, the first one is the rdn",
+		},
+	}
+}
+
+// ldifExportFlags defines the flags of the ldif export.
+func ldifExportFlags() []cli.Flag {
+	return append(
+		ldifMappingFlags(),
+		&cli.StringFlag{
+			Name:    "base-dn",
+			Value:   "",
+			Usage:   "base dn of the directory, like dc=example,dc=org",
+			EnvVars: []string{"GOMEMATIC_BASE_DN"},
+		},
+		&cli.StringFlag{
+			Name:  "users-ou",
+			Value: "ou=people",
+			Usage: "relative dn of the users below the base dn",
+		},
+		&cli.StringFlag{
+			Name:  "teams-ou",
+			Value: "ou=groups",
+			Usage: "relative dn of the teams below the base dn",
+		},
+		&cli.BoolFlag{
+			Name:  "include-ous",
+			Usage: "include entries for the organizational units",
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Value: "",
+			Usage: "write the ldif to this file instead of stdout",
+		},
+		&cli.IntFlag{
+			Name:  "concurrency",
+			Value: 8,
+			Usage: "number of parallel requests",
+		},
+	)
+}
+
+// ExportLDIF provides the sub-command to export users and teams as ldif.
+func ExportLDIF(ctx context.Context, c *cli.Context, client *Client) error {
+	if c.String("base-dn") == "" {
+		return fmt.Errorf("you must provide a base dn")
+	}
+
+	users, err := parseLDIFMapping(c.StringSlice("user-attr"), ldifUserFields)
+
+	if err != nil {
+		return err
+	}
+
+	teams, err := parseLDIFMapping(c.StringSlice("team-attr"), ldifTeamFields)
+
+	if err != nil {
+		return err
+	}
+
+	state, err := fetchEventState(ctx, c, client)
+
+	if err != nil {
+		return err
+	}
+
+	output := io.Writer(os.Stdout)
+
+	if name := c.String("output"); name != "" {
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+
+		if err != nil {
+			return fmt.Errorf("failed to create output: %s", err)
+		}
+
+		defer file.Close()
+
+		if err := file.Chmod(0600); err != nil {
+			return fmt.Errorf("failed to protect output: %s", err)
+		}
+
+		output = file
+	}
+
+	w := bufio.NewWriter(output)
+	base := c.String("base-dn")
+	usersBase := joinDN(c.String("users-ou"), base)
+	teamsBase := joinDN(c.String("teams-ou"), base)
+
+	fmt.Fprintln(w, "version: 1")
+
+	if c.Bool("include-ous") {
+		for _, dn := range []string{usersBase, teamsBase} {
+			rdn, _ := parseDN(dn)
+
+			if len(rdn) == 0 {
+				continue
+			}
+
+			fmt.Fprintln(w)
+			writeLDIFAttr(w, "dn", dn)
+			writeLDIFAttr(w, "objectClass", "top")
+			writeLDIFAttr(w, "objectClass", "organizationalUnit")
+			writeLDIFAttr(w, rdn[0][0], rdn[0][1])
+		}
+	}
+
+	userDNs := make(map[string]string, len(state.Users))
+	userIDs := make([]string, 0, len(state.Users))
+
+	for id, record := range state.Users {
+		userDNs[id] = joinDN(users[0][0]+"="+escapeDN(ldifUserValues(record)[users[0][1]]), usersBase)
+		userIDs = append(userIDs, id)
+	}
+
+	sort.Slice(userIDs, func(i, j int) bool {
+		return state.Users[userIDs[i]].Username < state.Users[userIDs[j]].Username
+	})
+
+	for _, id := range userIDs {
+		fields := ldifUserValues(state.Users[id])
+
+		fmt.Fprintln(w)
+		writeLDIFAttr(w, "dn", userDNs[id])
+
+		for _, class := range []string{"top", "person", "organizationalPerson", "inetOrgPerson"} {
+			writeLDIFAttr(w, "objectClass", class)
+		}
+
+		for _, row := range users {
+			if val := fields[row[1]]; val != "" {
+				writeLDIFAttr(w, row[0], val)
+			}
+		}
+	}
+
+	teamIDs := make([]string, 0, len(state.Teams))
+
+	for id := range state.Teams {
+		teamIDs = append(teamIDs, id)
+	}
+
+	sort.Slice(teamIDs, func(i, j int) bool {
+		return state.Teams[teamIDs[i]].Name < state.Teams[teamIDs[j]].Name
+	})
+
+	for _, id := range teamIDs {
+		record := state.Teams[id]
+
+		fields := map[string]string{
+			"id":   record.ID,
+			"slug": record.Slug,
+			"name": record.Name,
+		}
+
+		fmt.Fprintln(w)
+		writeLDIFAttr(w, "dn", joinDN(teams[0][0]+"="+escapeDN(fields[teams[0][1]]), teamsBase))
+		writeLDIFAttr(w, "objectClass", "top")
+		writeLDIFAttr(w, "objectClass", "groupOfNames")
+
+		for _, row := range teams {
+			if val := fields[row[1]]; val != "" {
+				writeLDIFAttr(w, row[0], val)
+			}
+		}
+
+		members := make([]string, 0)
+
+		for _, member := range state.Members {
+			if dn, ok := userDNs[member.UserID]; ok && member.TeamID == id {
+				members = append(members, dn)
+			}
+		}
+
+		sort.Strings(members)
+
+		// groupOfNames requires at least one member, an empty dn keeps
+		// empty teams valid and gets ignored by the import.
+		if len(members) == 0 {
+			members = append(members, "")
+		}
+
+		for _, dn := range members {
+			writeLDIFAttr(w, "member", dn)
+		}
+	}
+
+	return w.Flush()
+}
+
+// ImportLDIF provides the sub-command to import users and teams from ldif.
+func ImportLDIF(ctx context.Context, c *cli.Context, client *Client) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("you must provide a single ldif file, or - for stdin")
+	}
+
+	users, err := parseLDIFMapping(c.StringSlice("user-attr"), ldifUserFields)
+
+	if err != nil {
+		return err
+	}
+
+	teams, err := parseLDIFMapping(c.StringSlice("team-attr"), ldifTeamFields)
+
+	if err != nil {
+		return err
+	}
+
+	input, err := openImport(c.Args().First())
+
+	if err != nil {
+		return err
+	}
+
+	defer input.Close()
+
+	records, err := parseLDIF(input)
+
+	if err != nil {
+		return err
+	}
+
+	set, err := ldifImportSet(records, users, teams)
+
+	if err != nil {
+		return err
+	}
+
+	return applyImport(ctx, c, client, set)
+}
+
+// openImport opens the source of an import, - reads from stdin.
+func openImport(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		if secretStdin != "" {
+			return nil, fmt.Errorf("stdin is already used by %s", secretStdin)
+		}
+
+		return os.Stdin, nil
+	}
+
+	file, err := os.Open(name)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %s", name, err)
+	}
+
+	return file, nil
+}
+
+// ldifImportSet converts the parsed records to users and teams, members
+// are resolved by the dn of imported users or the rdn value.
+func ldifImportSet(records []*ldifRecord, users, teams ldifMapping) (*ImportSet, error) {
+	result := &ImportSet{}
+	usernames := make(map[string]string)
+
+	for _, record := range records {
+		if !ldifHasClass(record, ldifUserClasses) {
+			continue
+		}
+
+		row := &ImportUser{
+			Username: users.Value(record, "username"),
+			Email:    users.Value(record, "email"),
+			Source:   fmt.Sprintf("line %d", record.Line),
+		}
+
+		if row.Username == "" {
+			return nil, fmt.Errorf("user %s at line %d has no username", record.DN, record.Line)
+		}
+
+		if val := users.Value(record, "active"); val != "" {
+			active, err := strconv.ParseBool(strings.ToLower(val))
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid active state %q at line %d", val, record.Line)
+			}
+
+			row.Active = &active
+		}
+
+		// hashed passwords like {SSHA} can not be reused, only clear
+		// text passwords get imported.
+		if val := record.First("userPassword"); val != "" && !strings.HasPrefix(val, "{") {
+			row.Password = val
+		}
+
+		usernames[normalizeDN(record.DN)] = row.Username
+		result.Users = append(result.Users, row)
+	}
+
+	for _, record := range records {
+		if !ldifHasClass(record, ldifTeamClasses) {
+			continue
+		}
+
+		row := &ImportTeam{
+			Name:    teams.Value(record, "name"),
+			Members: make([]string, 0),
+			Source:  fmt.Sprintf("line %d", record.Line),
+		}
+
+		if row.Name == "" {
+			return nil, fmt.Errorf("team %s at line %d has no name", record.DN, record.Line)
+		}
+
+		for _, dn := range append(record.Attrs["member"], record.Attrs["uniquemember"]...) {
+			if dn == "" {
+				continue
+			}
+
+			username, ok := usernames[normalizeDN(dn)]
+
+			if !ok {
+				rdn, err := parseDN(dn)
+
+				if err != nil || len(rdn) == 0 {
+					return nil, fmt.Errorf("invalid member %q at line %d", dn, record.Line)
+				}
+
+				username = rdn[0][1]
+			}
+
+			if !containsString(row.Members, username) {
+				row.Members = append(row.Members, username)
+			}
+		}
+
+		for _, username := range record.Attrs["memberuid"] {
+			if !containsString(row.Members, username) {
+				row.Members = append(row.Members, username)
+			}
+		}
+
+		result.Teams = append(result.Teams, row)
+	}
+
+	if len(result.Users) == 0 && len(result.Teams) == 0 {
+		return nil, fmt.Errorf("no users or teams found")
+	}
+
+	return result, nil
+}
+
+// ldifUserValues returns the mappable fields of the user.
+func ldifUserValues(record *EventUser) map[string]string {
+	return map[string]string{
+		"id":       record.ID,
+		"slug":     record.Slug,
+		"username": record.Username,
+		"email":    record.Email,
+		"active":   strings.ToUpper(strconv.FormatBool(record.Active)),
+	}
+}
+
+// Value returns the first value of the attributes mapped to the field.
+func (m ldifMapping) Value(record *ldifRecord, field string) string {
+	for _, row := range m {
+		if row[1] != field {
+			continue
+		}
+
+		if val := record.First(row[0]); val != "" {
+			return val
+		}
+	}
+
+	return ""
+}
+
+// parseLDIFMapping parses mappings like mail=email and validates the fields.
+func parseLDIFMapping(values []string, fields []string) (ldifMapping, error) {
+	result := make(ldifMapping, 0, len(values))
+
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid attribute mapping %q, expected attr=field", value)
+		}
+
+		if !containsString(fields, parts[1]) {
+			return nil, fmt.Errorf("invalid field %s, can be %s", parts[1], strings.Join(fields, ", "))
+		}
+
+		result = append(result, [2]string{parts[0], parts[1]})
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("the attribute mapping must not be empty")
+	}
+
+	return result, nil
+}
+
+// parseLDIF reads all content records, change records other than add are
+// skipped with a warning.
+func parseLDIF(r io.Reader) ([]*ldifRecord, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	result := make([]*ldifRecord, 0)
+	lines := make([]string, 0)
+	starts := make([]int, 0)
+	number := 0
+
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+
+		record := &ldifRecord{
+			Line:  starts[0],
+			Attrs: make(map[string][]string),
+		}
+
+		for i, line := range lines {
+			name, val, err := parseLDIFLine(line)
+
+			if err != nil {
+				return fmt.Errorf("line %d: %s", starts[i], err)
+			}
+
+			switch {
+			case name == "version" && record.DN == "":
+			case name == "dn" && record.DN == "":
+				record.DN = val
+			case name == "changetype":
+				if val != "add" {
+					logger.Warnf("skipping %s record %s at line %d", val, record.DN, record.Line)
+					record = nil
+				}
+			default:
+				if record.DN == "" {
+					return fmt.Errorf("line %d: record without dn", starts[i])
+				}
+
+				record.Attrs[name] = append(record.Attrs[name], val)
+			}
+
+			if record == nil {
+				break
+			}
+		}
+
+		if record != nil && record.DN != "" {
+			result = append(result, record)
+		}
+
+		lines, starts = lines[:0], starts[:0]
+		return nil
+	}
+
+	comment := false
+
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		switch {
+		case line == "":
+			comment = false
+
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, " "):
+			if comment {
+				continue
+			}
+
+			if len(lines) == 0 {
+				return nil, fmt.Errorf("line %d: unexpected continuation", number)
+			}
+
+			lines[len(lines)-1] += line[1:]
+		case strings.HasPrefix(line, "#"):
+			comment = true
+		default:
+			comment = false
+			lines = append(lines, line)
+			starts = append(starts, number)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ldif: %s", err)
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// parseLDIFLine parses a single unfolded line like attr: value or the base64
+// encoded variant attr:: dmFsdWU=, the attribute gets lower cased.
+func parseLDIFLine(line string) (string, string, error) {
+	pos := strings.Index(line, ":")
+
+	if pos <= 0 {
+		return "", "", fmt.Errorf("invalid line %q", line)
+	}
+
+	name, rest := strings.ToLower(strings.TrimSpace(line[:pos])), line[pos+1:]
+
+	if idx := strings.Index(name, ";"); idx > 0 {
+		name = name[:idx]
+	}
+
+	switch {
+	case strings.HasPrefix(rest, ":"):
+		val, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rest[1:]))
+
+		if err != nil {
+			return "", "", fmt.Errorf("invalid base64 value of %s", name)
+		}
+
+		return name, string(val), nil
+	case strings.HasPrefix(rest, "<"):
+		return "", "", fmt.Errorf("url values of %s are not supported", name)
+	default:
+		return name, strings.TrimLeft(rest, " "), nil
+	}
+}
+
+// writeLDIFAttr writes an attribute, unsafe values get base64 encoded and
+// long lines get folded after 76 characters.
+func writeLDIFAttr(w io.Writer, name, val string) {
+	line := name + ": " + val
+
+	if !safeLDIFValue(val) {
+		line = name + ":: " + base64.StdEncoding.EncodeToString([]byte(val))
+	}
+
+	for len(line) > 76 {
+		fmt.Fprintln(w, line[:76])
+		line = " " + line[76:]
+	}
+
+	fmt.Fprintln(w, line)
+}
+
+// safeLDIFValue checks if the value can be written without base64.
+func safeLDIFValue(val string) bool {
+	if val == "" {
+		return true
+	}
+
+	if val[0] == ' ' || val[0] == ':' || val[0] == '<' || val[len(val)-1] == ' ' {
+		return false
+	}
+
+	for i := 0; i < len(val); i++ {
+		if val[i] == 0 || val[i] == '\n' || val[i] == '\r' || val[i] > 127 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ldifHasClass checks if the record has one of the object classes.
+func ldifHasClass(record *ldifRecord, classes []string) bool {
+	for _, class := range record.Attrs["objectclass"] {
+		if containsString(classes, strings.ToLower(class)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// joinDN appends the parent to the relative dn, empty parts are skipped.
+func joinDN(parts ...string) string {
+	result := make([]string, 0, len(parts))
+
+	for _, part := range parts {
+		if part = strings.Trim(part, ", "); part != "" {
+			result = append(result, part)
+		}
+	}
+
+	return strings.Join(result, ",")
+}
+
+// escapeDN escapes a rdn value according to rfc 4514.
+func escapeDN(val string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(val); i++ {
+		ch := val[i]
+
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, ch) >= 0:
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case (i == 0 && (ch == ' ' || ch == '#')) || (i == len(val)-1 && ch == ' '):
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	return b.String()
+}
+
+// parseDN splits a dn into attribute and unescaped value pairs.
+func parseDN(dn string) ([][2]string, error) {
+	result := make([][2]string, 0)
+
+	if strings.TrimSpace(dn) == "" {
+		return result, nil
+	}
+
+	var (
+		attr, val strings.Builder
+		inValue   bool
+	)
+
+	flush := func() error {
+		name := strings.TrimSpace(attr.String())
+
+		if name == "" || !inValue {
+			return fmt.Errorf("invalid dn %q", dn)
+		}
+
+		result = append(result, [2]string{name, strings.TrimSpace(val.String())})
+		attr.Reset()
+		val.Reset()
+		inValue = false
+
+		return nil
+	}
+
+	for i := 0; i < len(dn); i++ {
+		ch := dn[i]
+
+		switch {
+		case ch == '\\' && i+1 < len(dn):
+			if i+2 < len(dn) {
+				if decoded, err := hex.DecodeString(dn[i+1 : i+3]); err == nil {
+					val.Write(decoded)
+					i += 2
+					continue
+				}
+			}
+
+			val.WriteByte(dn[i+1])
+			i++
+		case (ch == ',' || ch == '+') && inValue:
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case ch == '=' && !inValue:
+			inValue = true
+		case inValue:
+			val.WriteByte(ch)
+		default:
+			attr.WriteByte(ch)
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// normalizeDN converts the dn to a comparable form.
+func normalizeDN(dn string) string {
+	parts, err := parseDN(dn)
+
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+
+	result := make([]string, len(parts))
+
+	for i, part := range parts {
+		result[i] = strings.ToLower(part[0]) + "=" + strings.ToLower(part[1])
+	}
+
+	return strings.Join(result, ",")
+}
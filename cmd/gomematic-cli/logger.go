@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// LogLevel defines the severity of a log message.
+type LogLevel int
+
+const (
+	// LevelError defines messages about failed operations.
+	LevelError LogLevel = iota
+
+	// LevelWarn defines messages about recoverable problems.
+	LevelWarn
+
+	// LevelInfo defines informational status messages.
+	LevelInfo
+
+	// LevelDebug defines details about the executed command.
+	LevelDebug
+
+	// LevelTrace defines details about every single api request.
+	LevelTrace
+)
+
+// String implements the fmt.Stringer interface.
+func (l LogLevel) String() string {
+	switch l {
+	case LevelError:
+		return "error"
+	case LevelWarn:
+		return "warning"
+	case LevelInfo:
+		return "info"
+	case LevelDebug:
+		return "debug"
+	default:
+		return "trace"
+	}
+}
+
+// logger is the global logger, it gets configured by the global flags.
+var logger = NewLogger(os.Stderr, LevelInfo, "text")
+
+// Logger writes leveled messages with key value fields as text or json.
+type Logger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  LogLevel
+	format string
+	prefix string
+}
+
+// NewLogger initializes a logger writing to the given output.
+func NewLogger(out io.Writer, level LogLevel, format string) *Logger {
+	return &Logger{
+		mu:     &sync.Mutex{},
+		out:    out,
+		level:  level,
+		format: format,
+	}
+}
+
+// SetupLogger configures the global logger by the global flags.
+func SetupLogger(c *cli.Context) error {
+	format := c.String("log-format")
+
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid log format %s, can be text or json", format)
+	}
+
+	level := LevelInfo
+
+	switch {
+	case c.Bool("quiet"):
+		level = LevelWarn
+	case c.Int("verbose") > 1:
+		level = LevelTrace
+	case c.Int("verbose") > 0:
+		level = LevelDebug
+	}
+
+	logger = NewLogger(os.Stderr, level, format)
+	return nil
+}
+
+// CountFlag represents a boolean flag which counts its occurrences, short
+// names can be repeated like -vv. The count gets read via the context by
+// the int getter.
+type CountFlag struct {
+	Name    string
+	Aliases []string
+	Usage   string
+	EnvVars []string
+}
+
+// String implements the fmt.Stringer interface.
+func (f *CountFlag) String() string {
+	names := make([]string, 0, len(f.Names()))
+
+	for _, name := range f.Names() {
+		if len(name) == 1 {
+			names = append(names, "-"+name)
+		} else {
+			names = append(names, "--"+name)
+		}
+	}
+
+	result := fmt.Sprintf("%s\t%s", strings.Join(names, ", "), f.Usage)
+
+	if len(f.EnvVars) > 0 {
+		result = fmt.Sprintf("%s [$%s]", result, strings.Join(f.EnvVars, ", $"))
+	}
+
+	return result
+}
+
+// Names returns the name and the aliases of the flag.
+func (f *CountFlag) Names() []string {
+	return append([]string{f.Name}, f.Aliases...)
+}
+
+// Apply registers the flag on the flag set, short names are additionally
+// registered repeated up to three times to count every letter.
+func (f *CountFlag) Apply(set *flag.FlagSet) {
+	count := &flagCount{}
+
+	for _, name := range f.EnvVars {
+		if val, ok := os.LookupEnv(name); ok {
+			(&flagCounter{count: count, step: 1}).Set(val)
+			break
+		}
+	}
+
+	for _, name := range f.Names() {
+		set.Var(&flagCounter{count: count, step: 1}, name, f.Usage)
+
+		if len(name) == 1 {
+			set.Var(&flagCounter{count: count, step: 2}, name+name, f.Usage)
+			set.Var(&flagCounter{count: count, step: 3}, name+name+name, f.Usage)
+		}
+	}
+}
+
+// flagCount represents the shared count of all names of a count flag.
+type flagCount struct {
+	val int
+}
+
+// flagCounter increments the shared count by the step for every occurrence.
+type flagCounter struct {
+	count *flagCount
+	step  int
+}
+
+// Set implements the flag.Value interface, numbers replace the count as
+// they are used by environment variables and to sync the aliases.
+func (c *flagCounter) Set(val string) error {
+	if num, err := strconv.Atoi(val); err == nil {
+		c.count.val = num
+		return nil
+	}
+
+	enabled, err := strconv.ParseBool(val)
+
+	if err != nil {
+		return fmt.Errorf("invalid count %s", val)
+	}
+
+	if enabled {
+		c.count.val += c.step
+	} else {
+		c.count.val = 0
+	}
+
+	return nil
+}
+
+// String implements the flag.Value interface.
+func (c *flagCounter) String() string {
+	if c.count == nil {
+		return "0"
+	}
+
+	return strconv.Itoa(c.count.val)
+}
+
+// IsBoolFlag allows to use the flag without a value.
+func (c *flagCounter) IsBoolFlag() bool {
+	return true
+}
+
+// Item returns a logger for a single identifier of a batch, messages get
+// written to the given output and carry the identifier.
+func (l *Logger) Item(out io.Writer, id string) *Logger {
+	return &Logger{
+		mu:     &sync.Mutex{},
+		out:    out,
+		level:  l.level,
+		format: l.format,
+		prefix: id,
+	}
+}
+
+// Enabled checks if messages of the level get written.
+func (l *Logger) Enabled(level LogLevel) bool {
+	return level <= l.level
+}
+
+// Error writes a message about a failed operation.
+func (l *Logger) Error(msg string, fields ...interface{}) {
+	l.write(LevelError, msg, fields)
+}
+
+// Warn writes a message about a recoverable problem.
+func (l *Logger) Warn(msg string, fields ...interface{}) {
+	l.write(LevelWarn, msg, fields)
+}
+
+// Info writes an informational status message.
+func (l *Logger) Info(msg string, fields ...interface{}) {
+	l.write(LevelInfo, msg, fields)
+}
+
+// Debug writes details about the executed command.
+func (l *Logger) Debug(msg string, fields ...interface{}) {
+	l.write(LevelDebug, msg, fields)
+}
+
+// Trace writes details about single api requests.
+func (l *Logger) Trace(msg string, fields ...interface{}) {
+	l.write(LevelTrace, msg, fields)
+}
+
+// Errorf writes a formatted message about a failed operation.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.write(LevelError, fmt.Sprintf(format, args...), nil)
+}
+
+// Warnf writes a formatted message about a recoverable problem.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.write(LevelWarn, fmt.Sprintf(format, args...), nil)
+}
+
+// Infof writes a formatted informational status message.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.write(LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+
+// write formats and writes a single message, fields are alternating keys
+// and values. Messages and values get redacted as they could contain
+// secrets of failed requests.
+func (l *Logger) write(level LogLevel, msg string, fields []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+
+	if l.format == "json" {
+		buf.WriteString(`{"time":`)
+		writeJSON(buf, time.Now().UTC().Format(time.RFC3339Nano))
+		buf.WriteString(`,"level":`)
+		writeJSON(buf, level.String())
+
+		if l.prefix != "" {
+			buf.WriteString(`,"id":`)
+			writeJSON(buf, l.prefix)
+		}
+
+		buf.WriteString(`,"msg":`)
+		writeJSON(buf, Redact(msg))
+
+		for i := 0; i < len(fields); i += 2 {
+			buf.WriteString(",")
+			writeJSON(buf, fmt.Sprint(fields[i]))
+			buf.WriteString(":")
+
+			if i+1 < len(fields) {
+				writeJSON(buf, logValue(fields[i+1]))
+			} else {
+				buf.WriteString("null")
+			}
+		}
+
+		buf.WriteString("}\n")
+	} else {
+		if level != LevelInfo {
+			buf.WriteString(level.String() + ": ")
+		}
+
+		if l.prefix != "" {
+			buf.WriteString(l.prefix + ": ")
+		}
+
+		buf.WriteString(Redact(msg))
+
+		for i := 0; i < len(fields); i += 2 {
+			val := ""
+
+			if i+1 < len(fields) {
+				val = fmt.Sprint(logValue(fields[i+1]))
+			}
+
+			if strings.ContainsAny(val, " \"=") || val == "" {
+				val = fmt.Sprintf("%q", val)
+			}
+
+			fmt.Fprintf(buf, " %s=%s", fields[i], val)
+		}
+
+		buf.WriteString("\n")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.out.Write(buf.Bytes())
+}
+
+// logValue converts the value of a field, errors and strings get redacted.
+func logValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case error:
+		return Redact(v.Error())
+	case string:
+		return Redact(v)
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return Redact(v.String())
+	default:
+		return v
+	}
+}
+
+// writeJSON appends the json encoding of the value, values which can not
+// be encoded are written as strings.
+func writeJSON(buf *bytes.Buffer, val interface{}) {
+	content, err := json.Marshal(val)
+
+	if err != nil {
+		content, _ = json.Marshal(fmt.Sprint(val))
+	}
+
+	buf.Write(content)
+}
+
+// logTransport writes every api request with its status and duration.
+type logTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *logTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	if err != nil {
+		logger.Trace("api request failed", "method", req.Method, "path", req.URL.Path, "duration", time.Since(started).Round(time.Millisecond), "err", err)
+		return resp, err
+	}
+
+	logger.Trace("api request", "method", req.Method, "path", req.URL.Path, "status", resp.StatusCode, "duration", time.Since(started).Round(time.Millisecond))
+	return resp, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCountFlag(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		env      string
+		expected int
+	}{
+		{args: []string{}, expected: 0},
+		{args: []string{"-v"}, expected: 1},
+		{args: []string{"-vv"}, expected: 2},
+		{args: []string{"-v", "-v"}, expected: 2},
+		{args: []string{"-vvv"}, expected: 3},
+		{args: []string{"--verbose", "-vv"}, expected: 3},
+		{args: []string{"--verbose=2"}, expected: 2},
+		{args: []string{}, env: "true", expected: 1},
+		{args: []string{}, env: "2", expected: 2},
+		{args: []string{"-v"}, env: "1", expected: 2},
+	} {
+		if tc.env != "" {
+			os.Setenv("GOMEMATIC_VERBOSE", tc.env)
+		}
+
+		c := testContext(t, nil, tc.args...)
+		os.Unsetenv("GOMEMATIC_VERBOSE")
+
+		if val := c.Int("verbose"); val != tc.expected {
+			t.Errorf("expected %v with %q to count %d, got %d", tc.args, tc.env, tc.expected, val)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gomematic/gomematic-cli/pkg/version"
@@ -9,17 +12,68 @@ import (
 	"gopkg.in/urfave/cli.v2"
 )
 
+// init replaces the help and version flags of the cli library, they are
+// part of the generated docs as well.
+func init() {
+	cli.HelpFlag = &cli.BoolFlag{
+		Name:    "help",
+		Aliases: []string{"h"},
+		Usage:   "show the help, so what you see now",
+	}
+
+	cli.VersionFlag = &cli.BoolFlag{
+		Name:  "version",
+		Usage: "print the current version of that tool",
+	}
+}
+
 func main() {
 	if env := os.Getenv("GOMEMATIC_ENV_FILE"); env != "" {
 		godotenv.Load(env)
 	}
 
+	cfg, err := LoadConfig(configPath())
+
+	if err != nil {
+		logger.Errorf("failed to load config: %s", err)
+		os.Exit(1)
+	}
+
+	commands := Commands()
+
+	plugins := DiscoverPlugins(commands)
+	commands = append(commands, PluginCommands(plugins)...)
+
+	aliases := FilterAliases(cfg.Aliases, commands)
+	commands = append(commands, AliasCommands(aliases)...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		logger.Warn("interrupted, aborting, press again to force")
+		cancel()
+
+		<-signals
+		os.Exit(ExitInterrupted)
+	}()
+
 	app := &cli.App{
 		Name:     "gomematic-cli",
 		Version:  version.String,
 		Usage:    "lightweight and powerful homematic",
 		Compiled: time.Now(),
 
+		Metadata: map[string]interface{}{
+			"context": ctx,
+			"config":  cfg,
+			"plugins": plugins,
+		},
+
 		Authors: []*cli.Author{
 			{
 				Name:  "Thomas Boerger",
@@ -27,41 +81,192 @@ func main() {
 			},
 		},
 
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:    "server, s",
-				Value:   "http://localhost:8080",
-				Usage:   "api server",
-				EnvVars: []string{"GOMEMATIC_SERVER"},
-			},
-			&cli.StringFlag{
-				Name:    "token, t",
-				Value:   "",
-				Usage:   "api token",
-				EnvVars: []string{"GOMEMATIC_TOKEN"},
-			},
-		},
+		Flags: GlobalFlags(),
 
-		Commands: []*cli.Command{
-			User(),
-			Team(),
-			Profile(),
+		Before: func(c *cli.Context) error {
+			if err := SetupLogger(c); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			if err := SetupTracer(c); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			if err := cfg.Apply(c); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			if err := ResolveSecrets(c, "token"); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			return nil
 		},
-	}
 
-	cli.HelpFlag = &cli.BoolFlag{
-		Name:    "help",
-		Aliases: []string{"h"},
-		Usage:   "show the help, so what you see now",
+		Commands: commands,
 	}
 
-	cli.VersionFlag = &cli.BoolFlag{
-		Name:    "version",
-		Aliases: []string{"v"},
-		Usage:   "print the current version of that tool",
+	args, err := ExpandAlias(os.Args, aliases, app.Flags)
+
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
 
-	if err := app.Run(os.Args); err != nil {
+	app.Metadata["args"] = args
+
+	if err := app.Run(args); err != nil {
 		os.Exit(1)
 	}
+
+	if ctx.Err() != nil {
+		os.Exit(ExitInterrupted)
+	}
+}
+
+// Commands defines all builtin commands, plugins and aliases get appended
+// at runtime and are not part of the generated docs.
+func Commands() []*cli.Command {
+	result := []*cli.Command{
+		User(),
+		Team(),
+		Profile(),
+		Report(),
+		Doctor(),
+		Audit(),
+		Events(),
+		Serve(),
+		Export(),
+		Import(),
+		Cache(),
+		Plugins(),
+		Docs(),
+	}
+
+	return append(result, Snapshots()...)
+}
+
+// GlobalFlags defines the flags shared by all commands.
+func GlobalFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "server, s",
+			Value:   "http://localhost:8080",
+			Usage:   "api server",
+			EnvVars: []string{"GOMEMATIC_SERVER"},
+		},
+		&cli.StringFlag{
+			Name:    "token, t",
+			Value:   "",
+			Usage:   "api token, accepts env:VAR, file:path, exec:command, literal:value or - for stdin",
+			EnvVars: []string{"GOMEMATIC_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "context",
+			Value:   "",
+			Usage:   "context defined within the config file",
+			EnvVars: []string{"GOMEMATIC_CONTEXT"},
+		},
+		&cli.DurationFlag{
+			Name:    "timeout",
+			Value:   30 * time.Second,
+			Usage:   "timeout for a single request",
+			EnvVars: []string{"GOMEMATIC_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:    "deadline",
+			Value:   0,
+			Usage:   "deadline for the whole command, disabled by zero",
+			EnvVars: []string{"GOMEMATIC_DEADLINE"},
+		},
+		&cli.IntFlag{
+			Name:    "retries",
+			Value:   3,
+			Usage:   "retries for idempotent requests on network errors",
+			EnvVars: []string{"GOMEMATIC_RETRIES"},
+		},
+		&cli.DurationFlag{
+			Name:    "retry-backoff",
+			Value:   500 * time.Millisecond,
+			Usage:   "initial backoff between retries, doubled per attempt",
+			EnvVars: []string{"GOMEMATIC_RETRY_BACKOFF"},
+		},
+		&cli.BoolFlag{
+			Name:    "retry-unsafe",
+			Usage:   "retry non-idempotent requests like creates as well",
+			EnvVars: []string{"GOMEMATIC_RETRY_UNSAFE"},
+		},
+		&cli.StringFlag{
+			Name:    "audit-log",
+			Value:   "",
+			Usage:   "path to the audit journal, defaults to audit.jsonl within the config dir",
+			EnvVars: []string{"GOMEMATIC_AUDIT_LOG"},
+		},
+		&cli.DurationFlag{
+			Name:    "snapshot-retention",
+			Value:   30 * 24 * time.Hour,
+			Usage:   "retention of local snapshots used by undo, disabled by zero",
+			EnvVars: []string{"GOMEMATIC_SNAPSHOT_RETENTION"},
+		},
+		&cli.BoolFlag{
+			Name:    "cached",
+			Usage:   "serve reads from the cache if it is younger than the cache ttl",
+			EnvVars: []string{"GOMEMATIC_CACHED"},
+		},
+		&cli.BoolFlag{
+			Name:    "offline",
+			Usage:   "serve reads only from the cache, regardless of its age",
+			EnvVars: []string{"GOMEMATIC_OFFLINE"},
+		},
+		&cli.DurationFlag{
+			Name:    "cache-ttl",
+			Value:   5 * time.Minute,
+			Usage:   "maximum age of cached responses used by --cached",
+			EnvVars: []string{"GOMEMATIC_CACHE_TTL"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-cache",
+			Usage:   "neither read nor write the response cache",
+			EnvVars: []string{"GOMEMATIC_NO_CACHE"},
+		},
+		&cli.BoolFlag{
+			Name:    "quiet",
+			Aliases: []string{"q"},
+			Usage:   "only print warnings and errors",
+			EnvVars: []string{"GOMEMATIC_QUIET"},
+		},
+		&CountFlag{
+			Name:    "verbose",
+			Aliases: []string{"v"},
+			Usage:   "print debug messages about the command, use -vv to include every api request",
+			EnvVars: []string{"GOMEMATIC_VERBOSE"},
+		},
+		&cli.StringFlag{
+			Name:    "log-format",
+			Value:   "text",
+			Usage:   "format of log messages, can be text or json",
+			EnvVars: []string{"GOMEMATIC_LOG_FORMAT"},
+		},
+		&cli.StringFlag{
+			Name:    "trace-endpoint",
+			Value:   "",
+			Usage:   "otlp http endpoint to export traces to, like http://localhost:4318",
+			EnvVars: []string{"GOMEMATIC_TRACE_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "trace-header",
+			Usage:   "header sent to the trace endpoint as key=value, can be repeated",
+			EnvVars: []string{"GOMEMATIC_TRACE_HEADERS", "OTEL_EXPORTER_OTLP_HEADERS"},
+		},
+		&cli.StringFlag{
+			Name:    "trace-file",
+			Value:   "",
+			Usage:   "path to append traces to as otlp json lines",
+			EnvVars: []string{"GOMEMATIC_TRACE_FILE"},
+		},
+	}
 }
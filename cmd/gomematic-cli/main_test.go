@@ -0,0 +1,616 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/gomematic/gomematic-go/gomematic"
+	"github.com/gomematic/gomematic-go/models"
+	"gopkg.in/urfave/cli.v2"
+
+	transport "github.com/go-openapi/runtime/client"
+)
+
+// fakeRoute matches the user and team endpoints of the fake api.
+var fakeRoute = regexp.MustCompile(`^/(users|teams)(?:/([^/]+))?(?:/(teams|users))?$`)
+
+// fakeMember represents a single membership within the fake api.
+type fakeMember struct {
+	UserID string
+	TeamID string
+	Perm   string
+}
+
+// fakeAPI emulates the user and team endpoints of the gomematic api, it
+// keeps all records in memory.
+type fakeAPI struct {
+	mu       sync.Mutex
+	users    map[string]*models.User
+	teams    map[string]*models.Team
+	members  []*fakeMember
+	requests []string
+}
+
+// newFakeAPI initializes an empty fake api.
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{
+		users:   make(map[string]*models.User),
+		teams:   make(map[string]*models.Team),
+		members: make([]*fakeMember, 0),
+	}
+}
+
+// AddUser creates a user and returns its id.
+func (a *fakeAPI) AddUser(slug string, admin, active bool) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.addUser(slug, admin, active)
+}
+
+// AddTeam creates a team and returns its id.
+func (a *fakeAPI) AddTeam(slug string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.addTeam(slug)
+}
+
+// AddMember assigns a user to a team with the given permission.
+func (a *fakeAPI) AddMember(userID, teamID, perm string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.members = append(a.members, &fakeMember{
+		UserID: userID,
+		TeamID: teamID,
+		Perm:   perm,
+	})
+}
+
+// Perm returns the permission of the user within the team, an empty string
+// if the user is not a member.
+func (a *fakeAPI) Perm(userSlug, teamSlug string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	user := a.findUser(userSlug)
+	team := a.findTeam(teamSlug)
+
+	if user == nil || team == nil {
+		return ""
+	}
+
+	if member := a.findMember(user.ID.String(), team.ID.String()); member != nil {
+		return member.Perm
+	}
+
+	return ""
+}
+
+// User returns the user with the given id or slug.
+func (a *fakeAPI) User(key string) *models.User {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.findUser(key)
+}
+
+// Team returns the team with the given id or slug.
+func (a *fakeAPI) Team(key string) *models.Team {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.findTeam(key)
+}
+
+// Requests returns all received requests as method and path.
+func (a *fakeAPI) Requests() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]string{}, a.requests...)
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.requests = append(a.requests, r.Method+" "+r.URL.Path)
+
+	if r.Header.Get("X-API-Key") == "" {
+		fakeMessage(w, http.StatusForbidden, "unauthorized")
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, gomematic.DefaultBasePath+"/") {
+		fakeMessage(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	match := fakeRoute.FindStringSubmatch(strings.TrimPrefix(r.URL.Path, gomematic.DefaultBasePath))
+
+	if match == nil {
+		fakeMessage(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	kind, key, sub := match[1], match[2], match[3]
+
+	switch {
+	case key == "":
+		a.serveCollection(w, r, kind)
+	case sub == "":
+		a.serveRecord(w, r, kind, key)
+	default:
+		a.serveMembers(w, r, kind, key)
+	}
+}
+
+// serveCollection lists or creates users and teams.
+func (a *fakeAPI) serveCollection(w http.ResponseWriter, r *http.Request, kind string) {
+	switch r.Method {
+	case http.MethodGet:
+		if kind == "users" {
+			result := make([]*models.User, 0, len(a.users))
+
+			for _, record := range a.users {
+				result = append(result, record)
+			}
+
+			fakeJSON(w, http.StatusOK, result)
+		} else {
+			result := make([]*models.Team, 0, len(a.teams))
+
+			for _, record := range a.teams {
+				result = append(result, record)
+			}
+
+			fakeJSON(w, http.StatusOK, result)
+		}
+	case http.MethodPost:
+		if kind == "users" {
+			body := &models.User{}
+			json.NewDecoder(r.Body).Decode(body)
+
+			slug := stringValue(body.Slug, strings.ToLower(stringValue(body.Username, "")))
+
+			if a.findUser(slug) != nil {
+				fakeValidation(w, "slug", "is already taken")
+				return
+			}
+
+			record := a.users[a.addUser(slug, false, true)]
+			record.Username = body.Username
+			record.Email = body.Email
+
+			if body.Admin != nil {
+				record.Admin = body.Admin
+			}
+
+			if body.Active != nil {
+				record.Active = body.Active
+			}
+
+			fakeJSON(w, http.StatusOK, record)
+		} else {
+			body := &models.Team{}
+			json.NewDecoder(r.Body).Decode(body)
+
+			slug := stringValue(body.Slug, strings.ToLower(stringValue(body.Name, "")))
+
+			if a.findTeam(slug) != nil {
+				fakeValidation(w, "slug", "is already taken")
+				return
+			}
+
+			record := a.teams[a.addTeam(slug)]
+			record.Name = body.Name
+
+			fakeJSON(w, http.StatusOK, record)
+		}
+	default:
+		fakeMessage(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// serveRecord shows, updates or deletes a single user or team.
+func (a *fakeAPI) serveRecord(w http.ResponseWriter, r *http.Request, kind, key string) {
+	var (
+		id     string
+		record interface{}
+	)
+
+	if kind == "users" {
+		if user := a.findUser(key); user != nil {
+			id, record = user.ID.String(), user
+		}
+	} else {
+		if team := a.findTeam(key); team != nil {
+			id, record = team.ID.String(), team
+		}
+	}
+
+	if record == nil {
+		fakeMessage(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		fakeJSON(w, http.StatusOK, record)
+	case http.MethodPut:
+		if kind == "users" {
+			body := &models.User{}
+			json.NewDecoder(r.Body).Decode(body)
+
+			user := record.(*models.User)
+
+			for _, val := range []struct{ from, to **string }{
+				{&body.Slug, &user.Slug},
+				{&body.Username, &user.Username},
+				{&body.Email, &user.Email},
+			} {
+				if *val.from != nil {
+					*val.to = *val.from
+				}
+			}
+
+			if body.Admin != nil {
+				user.Admin = body.Admin
+			}
+
+			if body.Active != nil {
+				user.Active = body.Active
+			}
+		} else {
+			body := &models.Team{}
+			json.NewDecoder(r.Body).Decode(body)
+
+			team := record.(*models.Team)
+
+			if body.Slug != nil {
+				team.Slug = body.Slug
+			}
+
+			if body.Name != nil {
+				team.Name = body.Name
+			}
+		}
+
+		fakeJSON(w, http.StatusOK, record)
+	case http.MethodDelete:
+		delete(a.users, id)
+		delete(a.teams, id)
+
+		members := make([]*fakeMember, 0, len(a.members))
+
+		for _, member := range a.members {
+			if member.UserID != id && member.TeamID != id {
+				members = append(members, member)
+			}
+		}
+
+		a.members = members
+		fakeMessage(w, http.StatusOK, "successfully deleted")
+	default:
+		fakeMessage(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// serveMembers lists and manages the memberships of a user or team.
+func (a *fakeAPI) serveMembers(w http.ResponseWriter, r *http.Request, kind, key string) {
+	var (
+		userID string
+		teamID string
+	)
+
+	if kind == "users" {
+		if user := a.findUser(key); user != nil {
+			userID = user.ID.String()
+		}
+	} else {
+		if team := a.findTeam(key); team != nil {
+			teamID = team.ID.String()
+		}
+	}
+
+	if userID == "" && teamID == "" {
+		fakeMessage(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		result := make([]*models.TeamUser, 0)
+
+		for _, member := range a.members {
+			if member.UserID == userID || member.TeamID == teamID {
+				result = append(result, a.teamUser(member, kind == "teams", kind == "users"))
+			}
+		}
+
+		fakeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	body := struct {
+		User string `json:"user"`
+		Team string `json:"team"`
+		Perm string `json:"perm"`
+	}{}
+
+	json.NewDecoder(r.Body).Decode(&body)
+
+	if kind == "users" {
+		if team := a.findTeam(body.Team); team != nil {
+			teamID = team.ID.String()
+		}
+	} else {
+		if user := a.findUser(body.User); user != nil {
+			userID = user.ID.String()
+		}
+	}
+
+	if userID == "" || teamID == "" {
+		fakeMessage(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	member := a.findMember(userID, teamID)
+
+	switch {
+	case r.Method == http.MethodPost && member != nil:
+		fakeMessage(w, http.StatusPreconditionFailed, "already assigned")
+	case r.Method == http.MethodPost:
+		a.members = append(a.members, &fakeMember{
+			UserID: userID,
+			TeamID: teamID,
+			Perm:   body.Perm,
+		})
+
+		fakeMessage(w, http.StatusOK, "successfully assigned")
+	case member == nil:
+		fakeMessage(w, http.StatusPreconditionFailed, "not assigned")
+	case r.Method == http.MethodPut:
+		member.Perm = body.Perm
+		fakeMessage(w, http.StatusOK, "successfully updated permission")
+	case r.Method == http.MethodDelete:
+		members := make([]*fakeMember, 0, len(a.members))
+
+		for _, row := range a.members {
+			if row != member {
+				members = append(members, row)
+			}
+		}
+
+		a.members = members
+		fakeMessage(w, http.StatusOK, "successfully unlinked")
+	default:
+		fakeMessage(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// addUser creates a user, the caller must hold the lock.
+func (a *fakeAPI) addUser(slug string, admin, active bool) string {
+	id := fakeUUID()
+	username := slug
+	email := slug + "@example.com"
+
+	a.users[id] = &models.User{
+		ID:        strfmt.UUID(id),
+		Slug:      &slug,
+		Username:  &username,
+		Email:     &email,
+		Admin:     &admin,
+		Active:    &active,
+		CreatedAt: strfmt.DateTime(time.Now().UTC()),
+		UpdatedAt: strfmt.DateTime(time.Now().UTC()),
+	}
+
+	return id
+}
+
+// addTeam creates a team, the caller must hold the lock.
+func (a *fakeAPI) addTeam(slug string) string {
+	id := fakeUUID()
+	name := strings.Title(slug)
+
+	a.teams[id] = &models.Team{
+		ID:        strfmt.UUID(id),
+		Slug:      &slug,
+		Name:      &name,
+		CreatedAt: strfmt.DateTime(time.Now().UTC()),
+		UpdatedAt: strfmt.DateTime(time.Now().UTC()),
+	}
+
+	return id
+}
+
+// findUser looks up a user by id or slug, the caller must hold the lock.
+func (a *fakeAPI) findUser(key string) *models.User {
+	for id, record := range a.users {
+		if id == key || stringValue(record.Slug, "") == key {
+			return record
+		}
+	}
+
+	return nil
+}
+
+// findTeam looks up a team by id or slug, the caller must hold the lock.
+func (a *fakeAPI) findTeam(key string) *models.Team {
+	for id, record := range a.teams {
+		if id == key || stringValue(record.Slug, "") == key {
+			return record
+		}
+	}
+
+	return nil
+}
+
+// findMember looks up a membership, the caller must hold the lock.
+func (a *fakeAPI) findMember(userID, teamID string) *fakeMember {
+	for _, member := range a.members {
+		if member.UserID == userID && member.TeamID == teamID {
+			return member
+		}
+	}
+
+	return nil
+}
+
+// teamUser converts a membership to the api model, the caller must hold
+// the lock.
+func (a *fakeAPI) teamUser(member *fakeMember, withUser, withTeam bool) *models.TeamUser {
+	userID := strfmt.UUID(member.UserID)
+	teamID := strfmt.UUID(member.TeamID)
+	perm := member.Perm
+
+	result := &models.TeamUser{
+		UserID: &userID,
+		TeamID: &teamID,
+		Perm:   &perm,
+	}
+
+	if withUser {
+		result.User = a.users[member.UserID]
+	}
+
+	if withTeam {
+		result.Team = a.teams[member.TeamID]
+	}
+
+	return result
+}
+
+// fakeJSON writes the value as json response.
+func fakeJSON(w http.ResponseWriter, status int, val interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(val)
+}
+
+// fakeMessage writes a general error response.
+func fakeMessage(w http.ResponseWriter, status int, msg string) {
+	code := int64(status)
+
+	fakeJSON(w, status, &models.GeneralError{
+		Status:  &code,
+		Message: &msg,
+	})
+}
+
+// fakeValidation writes a validation error response.
+func fakeValidation(w http.ResponseWriter, field, msg string) {
+	code := int64(http.StatusUnprocessableEntity)
+	message := "failed to validate"
+
+	fakeJSON(w, http.StatusUnprocessableEntity, &models.ValidationError{
+		Status:  &code,
+		Message: &message,
+		Errors: []*models.ValidationErrorErrorsItems0{
+			{
+				Field:   field,
+				Message: msg,
+			},
+		},
+	})
+}
+
+// fakeUUID generates a random uuid for fake records.
+func fakeUUID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+
+	buf[6] = (buf[6] & 0x0f) | 0x40
+	buf[8] = (buf[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:])
+}
+
+// testServer starts the fake api and returns a client connected to it, the
+// caller has to close the server.
+func testServer(t *testing.T, api *fakeAPI) (*httptest.Server, *Client) {
+	server := httptest.NewServer(api)
+	addr, err := url.Parse(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{
+		GomematicOpen: gomematic.New(
+			transport.New(
+				addr.Host,
+				path.Join(addr.Path, gomematic.DefaultBasePath),
+				[]string{addr.Scheme},
+			),
+			strfmt.Default,
+		),
+		AuthInfo: transport.APIKeyAuth("X-API-Key", "header", "secret"),
+	}
+
+	return server, client
+}
+
+// testContext builds a command context with the global and the given flags
+// parsed from the arguments.
+func testContext(t *testing.T, flags []cli.Flag, args ...string) *cli.Context {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	for _, f := range append(GlobalFlags(), flags...) {
+		f.Apply(set)
+	}
+
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &cli.App{
+		Name:     "gomematic-cli",
+		Metadata: map[string]interface{}{},
+	}
+
+	return cli.NewContext(app, set, nil)
+}
+
+// testConfigDir points the config dir to a temporary directory, the returned
+// function restores the environment and removes the directory.
+func testConfigDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "gomematic-config")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := make(map[string]string)
+
+	for _, name := range []string{"HOME", "XDG_CONFIG_HOME"} {
+		env[name] = os.Getenv(name)
+		os.Setenv(name, dir)
+	}
+
+	return dir, func() {
+		for name, val := range env {
+			os.Setenv(name, val)
+		}
+
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/runtime"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// metricsBuckets defines the histogram buckets for api latencies in seconds.
+var metricsBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics collects access gauges and api request statistics.
+type Metrics struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	gauges    map[string]float64
+	members   map[string]float64
+	requests  map[string]*requestStats
+	scraped   time.Time
+	duration  time.Duration
+	succeeded bool
+	lastError string
+}
+
+// requestStats represents the statistics of a single api endpoint.
+type requestStats struct {
+	count   float64
+	errors  float64
+	sum     float64
+	buckets []float64
+}
+
+// NewMetrics initializes the metrics for the given scrape interval.
+func NewMetrics(interval time.Duration) *Metrics {
+	return &Metrics{
+		interval: interval,
+		gauges:   make(map[string]float64),
+		members:  make(map[string]float64),
+		requests: make(map[string]*requestStats),
+	}
+}
+
+// ServeMetrics provides the sub-command to expose access metrics.
+func ServeMetrics(ctx context.Context, c *cli.Context, client *Client) error {
+	if c.Duration("interval") <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+
+	metrics := NewMetrics(c.Duration("interval"))
+
+	client.SetTransport(&metricsTransport{
+		next:    client.Transport,
+		metrics: metrics,
+	})
+
+	go func() {
+		ticker := time.NewTicker(c.Duration("interval"))
+		defer ticker.Stop()
+
+		for {
+			metrics.Scrape(ctx, c, client)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	mux.HandleFunc("/healthz", metrics.Healthz)
+
+	if err := listenAndServe(ctx, c.String("listen"), mux); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// Scrape fetches all users, teams and memberships and updates the gauges.
+func (m *Metrics) Scrape(ctx context.Context, c *cli.Context, client *Client) {
+	started := time.Now()
+	state, err := fetchEventState(ctx, c, client)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scraped = time.Now()
+	m.duration = time.Since(started)
+
+	if err != nil {
+		m.succeeded = false
+		m.lastError = err.Error()
+		return
+	}
+
+	m.Update(state)
+	m.succeeded = true
+	m.lastError = ""
+}
+
+// Update calculates the gauges from the given state, the caller must hold
+// the lock.
+func (m *Metrics) Update(state *EventState) {
+	var admins, inactive float64
+
+	for _, record := range state.Users {
+		if record.Admin {
+			admins++
+		}
+
+		if !record.Active {
+			inactive++
+		}
+	}
+
+	m.gauges = map[string]float64{
+		"users":          float64(len(state.Users)),
+		"admins":         admins,
+		"inactive_users": inactive,
+		"teams":          float64(len(state.Teams)),
+	}
+
+	m.members = map[string]float64{
+		"user":  0,
+		"admin": 0,
+		"owner": 0,
+	}
+
+	for _, record := range state.Members {
+		m.members[record.Perm]++
+	}
+}
+
+// Observe records a single api request of an endpoint.
+func (m *Metrics) Observe(endpoint string, duration time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.requests[endpoint]
+
+	if !ok {
+		stats = &requestStats{
+			buckets: make([]float64, len(metricsBuckets)),
+		}
+
+		m.requests[endpoint] = stats
+	}
+
+	seconds := duration.Seconds()
+
+	stats.count++
+	stats.sum += seconds
+
+	if failed {
+		stats.errors++
+	}
+
+	for i, bound := range metricsBuckets {
+		if seconds <= bound {
+			stats.buckets[i]++
+		}
+	}
+}
+
+// ServeHTTP implements the http.Handler interface, it renders the
+// prometheus text format or openmetrics if the client accepts it.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openmetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+
+	if openmetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Write(w, openmetrics)
+}
+
+// Write renders all metrics in the exposition format, the caller must hold
+// the lock.
+func (m *Metrics) Write(w io.Writer, openmetrics bool) {
+	gauge := func(name, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+
+	counter := func(name, help string) {
+		family := name
+
+		if openmetrics {
+			family = strings.TrimSuffix(name, "_total")
+		}
+
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", family, help, family)
+	}
+
+	if m.succeeded {
+		for _, row := range [][2]string{
+			{"users", "Number of users."},
+			{"admins", "Number of users with admin privileges."},
+			{"inactive_users", "Number of inactive users."},
+			{"teams", "Number of teams."},
+		} {
+			gauge("gomematic_"+row[0], row[1])
+			fmt.Fprintf(w, "gomematic_%s %s\n", row[0], formatMetric(m.gauges[row[0]]))
+		}
+
+		gauge("gomematic_memberships", "Number of team memberships per permission.")
+
+		for _, perm := range sortedKeys(m.members) {
+			fmt.Fprintf(w, "gomematic_memberships{perm=%q} %s\n", perm, formatMetric(m.members[perm]))
+		}
+	}
+
+	success := 0.0
+
+	if m.succeeded {
+		success = 1
+	}
+
+	gauge("gomematic_scrape_success", "Whether the last scrape of the api succeeded.")
+	fmt.Fprintf(w, "gomematic_scrape_success %s\n", formatMetric(success))
+
+	if !m.scraped.IsZero() {
+		gauge("gomematic_scrape_timestamp_seconds", "Unix time of the last scrape.")
+		fmt.Fprintf(w, "gomematic_scrape_timestamp_seconds %d\n", m.scraped.Unix())
+
+		gauge("gomematic_scrape_duration_seconds", "Duration of the last scrape.")
+		fmt.Fprintf(w, "gomematic_scrape_duration_seconds %s\n", formatMetric(m.duration.Seconds()))
+	}
+
+	endpoints := make([]string, 0, len(m.requests))
+
+	for endpoint := range m.requests {
+		endpoints = append(endpoints, endpoint)
+	}
+
+	sort.Strings(endpoints)
+
+	counter("gomematic_api_requests_total", "Number of api requests per endpoint.")
+
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(w, "gomematic_api_requests_total{endpoint=%q} %s\n", endpoint, formatMetric(m.requests[endpoint].count))
+	}
+
+	counter("gomematic_api_errors_total", "Number of failed api requests per endpoint.")
+
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(w, "gomematic_api_errors_total{endpoint=%q} %s\n", endpoint, formatMetric(m.requests[endpoint].errors))
+	}
+
+	fmt.Fprintf(
+		w,
+		"# HELP %s %s\n# TYPE %s histogram\n",
+		"gomematic_api_request_duration_seconds",
+		"Latency of api requests per endpoint.",
+		"gomematic_api_request_duration_seconds",
+	)
+
+	for _, endpoint := range endpoints {
+		stats := m.requests[endpoint]
+
+		for i, bound := range metricsBuckets {
+			fmt.Fprintf(w, "gomematic_api_request_duration_seconds_bucket{endpoint=%q,le=%q} %s\n", endpoint, formatMetric(bound), formatMetric(stats.buckets[i]))
+		}
+
+		fmt.Fprintf(w, "gomematic_api_request_duration_seconds_bucket{endpoint=%q,le=\"+Inf\"} %s\n", endpoint, formatMetric(stats.count))
+		fmt.Fprintf(w, "gomematic_api_request_duration_seconds_sum{endpoint=%q} %s\n", endpoint, formatMetric(stats.sum))
+		fmt.Fprintf(w, "gomematic_api_request_duration_seconds_count{endpoint=%q} %s\n", endpoint, formatMetric(stats.count))
+	}
+
+	if openmetrics {
+		fmt.Fprintln(w, "# EOF")
+	}
+}
+
+// Healthz reports if the last scrape succeeded and is recent enough.
+func (m *Metrics) Healthz(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	switch {
+	case m.scraped.IsZero():
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "waiting for first scrape")
+	case !m.succeeded:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "last scrape failed: %s\n", m.lastError)
+	case time.Since(m.scraped) > 3*m.interval:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "last scrape is older than %s\n", 3*m.interval)
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// metricsTransport records the latency and errors of all api requests.
+type metricsTransport struct {
+	next    runtime.ClientTransport
+	metrics *Metrics
+}
+
+// Submit implements the runtime.ClientTransport interface.
+func (t *metricsTransport) Submit(op *runtime.ClientOperation) (interface{}, error) {
+	started := time.Now()
+	result, err := t.next.Submit(op)
+
+	t.metrics.Observe(op.ID, time.Since(started), err != nil)
+	return result, err
+}
+
+// formatMetric formats a sample value without unnecessary precision.
+func formatMetric(val float64) string {
+	return fmt.Sprintf("%g", val)
+}
+
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys(values map[string]float64) []string {
+	result := make([]string, 0, len(values))
+
+	for key := range values {
+		result = append(result, key)
+	}
+
+	sort.Strings(result)
+	return result
+}
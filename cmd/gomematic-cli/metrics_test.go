@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsScrape(t *testing.T) {
+	api := newFakeAPI()
+
+	admin := api.AddUser("admin", true, true)
+	bob := api.AddUser("bob", false, true)
+	api.AddUser("carol", false, false)
+
+	ops := api.AddTeam("ops")
+	dev := api.AddTeam("dev")
+
+	api.AddMember(admin, ops, "owner")
+	api.AddMember(bob, ops, "user")
+	api.AddMember(bob, dev, "admin")
+
+	server, client := testServer(t, api)
+	defer server.Close()
+
+	metrics := NewMetrics(time.Minute)
+
+	client.SetTransport(&metricsTransport{
+		next:    client.Transport,
+		metrics: metrics,
+	})
+
+	c := testContext(t, Serve().Subcommands[0].Flags, "--server", server.URL)
+	metrics.Scrape(context.Background(), c, client)
+
+	exporter := testMetricsServer(metrics)
+	defer exporter.Close()
+
+	status, body := testGet(t, exporter.URL+"/metrics", "")
+
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+
+	for _, line := range []string{
+		"gomematic_users 3",
+		"gomematic_admins 1",
+		"gomematic_inactive_users 1",
+		"gomematic_teams 2",
+		`gomematic_memberships{perm="owner"} 1`,
+		`gomematic_memberships{perm="admin"} 1`,
+		`gomematic_memberships{perm="user"} 1`,
+		"gomematic_scrape_success 1",
+		`gomematic_api_requests_total{endpoint="ListUsers"} 1`,
+		`gomematic_api_requests_total{endpoint="ListTeamUsers"} 2`,
+		`gomematic_api_errors_total{endpoint="ListTeams"} 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+
+	if strings.Contains(body, "# EOF") {
+		t.Errorf("expected prometheus format without eof marker")
+	}
+
+	_, body = testGet(t, exporter.URL+"/metrics", "application/openmetrics-text")
+
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("expected openmetrics format to end with eof marker, got:\n%s", body)
+	}
+
+	if !strings.Contains(body, "# TYPE gomematic_api_requests counter\n") {
+		t.Errorf("expected openmetrics counter family without total suffix, got:\n%s", body)
+	}
+
+	status, body = testGet(t, exporter.URL+"/healthz", "")
+
+	if status != http.StatusOK || body != "ok\n" {
+		t.Errorf("expected healthy status, got %d: %s", status, body)
+	}
+}
+
+func TestMetricsScrapeFailure(t *testing.T) {
+	api := newFakeAPI()
+
+	server, client := testServer(t, api)
+	server.Close()
+
+	metrics := NewMetrics(time.Minute)
+	exporter := testMetricsServer(metrics)
+	defer exporter.Close()
+
+	status, body := testGet(t, exporter.URL+"/healthz", "")
+
+	if status != http.StatusServiceUnavailable || body != "waiting for first scrape\n" {
+		t.Errorf("expected waiting status, got %d: %s", status, body)
+	}
+
+	c := testContext(t, Serve().Subcommands[0].Flags, "--server", server.URL)
+	metrics.Scrape(context.Background(), c, client)
+
+	status, body = testGet(t, exporter.URL+"/healthz", "")
+
+	if status != http.StatusServiceUnavailable || !strings.HasPrefix(body, "last scrape failed: ") {
+		t.Errorf("expected failed status, got %d: %s", status, body)
+	}
+
+	_, body = testGet(t, exporter.URL+"/metrics", "")
+
+	if !strings.Contains(body, "gomematic_scrape_success 0\n") {
+		t.Errorf("expected failed scrape within metrics, got:\n%s", body)
+	}
+
+	if strings.Contains(body, "gomematic_users ") {
+		t.Errorf("expected no gauges after failed scrape, got:\n%s", body)
+	}
+}
+
+// testMetricsServer exposes the metrics like the serve metrics command.
+func testMetricsServer(metrics *Metrics) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	mux.HandleFunc("/healthz", metrics.Healthz)
+
+	return httptest.NewServer(mux)
+}
+
+// testGet requests the url and returns the status and body.
+func testGet(t *testing.T, url, accept string) (int, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(body)
+}
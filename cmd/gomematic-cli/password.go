@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"unicode"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// passwordAlphabet defines the characters used for generated passwords.
+const passwordAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.!@#%+="
+
+// PasswordPolicy represents the local requirements for passwords.
+type PasswordPolicy struct {
+	MinLength int
+	Classes   int
+	Deny      []string
+}
+
+// DefaultPasswordPolicy returns the policy used without configuration.
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength: 8,
+		Classes:   2,
+		Deny: []string{
+			"password",
+			"password1",
+			"12345678",
+			"123456789",
+			"1234567890",
+			"qwertyuiop",
+			"iloveyou",
+			"sunshine",
+			"welcome1",
+			"changeme",
+			"gomematic",
+			"homematic",
+		},
+	}
+}
+
+// Check validates the password against the policy, the username and email
+// must not be part of the password.
+func (p *PasswordPolicy) Check(password, username, email string) error {
+	msgs := make([]string, 0)
+
+	if len(password) < p.MinLength {
+		msgs = append(msgs, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+
+	if classes := passwordClasses(password); classes < p.Classes {
+		msgs = append(msgs, fmt.Sprintf("must contain %d of lower, upper, digit and symbol characters", p.Classes))
+	}
+
+	lower := strings.ToLower(password)
+
+	for _, denied := range p.Deny {
+		if lower == strings.ToLower(denied) {
+			msgs = append(msgs, "is part of the deny list")
+			break
+		}
+	}
+
+	if local := strings.SplitN(email, "@", 2)[0]; len(local) >= 3 && strings.Contains(lower, strings.ToLower(local)) {
+		msgs = append(msgs, "must not contain the email")
+	}
+
+	if len(username) >= 3 && strings.Contains(lower, strings.ToLower(username)) {
+		msgs = append(msgs, "must not contain the username")
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	result := []string{
+		"password violates the policy:",
+		"",
+	}
+
+	for _, msg := range msgs {
+		result = append(result, fmt.Sprintf("password: %s", msg))
+	}
+
+	return fmt.Errorf(strings.Join(result, "\n"))
+}
+
+// Generate creates a random password with the given length which
+// satisfies the policy.
+func (p *PasswordPolicy) Generate(length int, username, email string) (string, error) {
+	if length < p.MinLength {
+		return "", fmt.Errorf("length must be at least %d", p.MinLength)
+	}
+
+	max := big.NewInt(int64(len(passwordAlphabet)))
+
+	for attempt := 0; attempt < 100; attempt++ {
+		buf := make([]byte, length)
+
+		for i := range buf {
+			n, err := rand.Int(rand.Reader, max)
+
+			if err != nil {
+				return "", fmt.Errorf("failed to generate password: %s", err)
+			}
+
+			buf[i] = passwordAlphabet[n.Int64()]
+		}
+
+		if p.Check(string(buf), username, email) == nil {
+			return string(buf), nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to generate a password matching the policy, increase the length")
+}
+
+// resolvePassword returns either the provided or a generated password, both
+// get checked against the policy. It returns an empty string if the
+// password should not be changed.
+func resolvePassword(c *cli.Context, username, email string) (string, bool, error) {
+	policy := GetConfig(c).Password
+
+	if c.Bool("generate-password") {
+		if c.String("password") != "" {
+			return "", false, fmt.Errorf("you can not provide a password and generate one")
+		}
+
+		// the password file gets validated before the request is sent, a
+		// generated password would be lost if it can not be written later.
+		if err := checkPasswordFile(c); err != nil {
+			return "", false, err
+		}
+
+		password, err := policy.Generate(c.Int("length"), username, email)
+
+		if err != nil {
+			return "", false, err
+		}
+
+		resolvedSecrets = append(resolvedSecrets, password)
+		return password, true, nil
+	}
+
+	if password := c.String("password"); password != "" {
+		return password, false, policy.Check(password, username, email)
+	}
+
+	return "", false, nil
+}
+
+// checkPasswordFile ensures that the password file can be written, it gets
+// created if missing but existing content is kept until the handout.
+func checkPasswordFile(c *cli.Context) error {
+	name := c.String("password-file")
+
+	if name == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0600)
+
+	if err != nil {
+		return fmt.Errorf("failed to open password file: %s", err)
+	}
+
+	defer file.Close()
+
+	if err := file.Chmod(0600); err != nil {
+		return fmt.Errorf("failed to protect password file: %s", err)
+	}
+
+	return file.Close()
+}
+
+// handoutPassword prints a generated password once or writes it to the
+// password file which is only readable by the owner.
+func handoutPassword(c *cli.Context, password string) error {
+	name := c.String("password-file")
+
+	if name == "" {
+		fmt.Fprintf(os.Stdout, "Password: %s\n", password)
+		return nil
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+
+	if err != nil {
+		return fmt.Errorf("failed to write password file: %s", err)
+	}
+
+	defer file.Close()
+
+	if err := file.Chmod(0600); err != nil {
+		return fmt.Errorf("failed to protect password file: %s", err)
+	}
+
+	if _, err := fmt.Fprintln(file, password); err != nil {
+		return fmt.Errorf("failed to write password file: %s", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write password file: %s", err)
+	}
+
+	logger.Infof("password written to %s", name)
+	return nil
+}
+
+// passwordClasses counts the different character classes of a password.
+func passwordClasses(password string) int {
+	var lower, upper, digit, symbol int
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// pluginPrefix defines the prefix of executables detected as plugins.
+const pluginPrefix = "gomematic-cli-"
+
+// tmplPluginList represents a row within plugin listing.
+var tmplPluginList = "Name: \x1b[33m{{ .Name }} \x1b[0m" + `
+Path: {{ .Path }}
+`
+
+// Plugin represents an external executable extending the command tree.
+type Plugin struct {
+	Name string
+	Path string
+}
+
+// pluginDirs returns the directories searched for plugins, the plugin
+// directory always takes precedence over the PATH.
+func pluginDirs() []string {
+	dir := os.Getenv("GOMEMATIC_PLUGIN_DIR")
+
+	if dir == "" {
+		dir = filepath.Join(configDir(), "plugins")
+	}
+
+	return append(
+		[]string{dir},
+		filepath.SplitList(os.Getenv("PATH"))...,
+	)
+}
+
+// DiscoverPlugins searches for executables named gomematic-cli-<name>, the
+// first match of a name wins and names of builtin commands are skipped.
+func DiscoverPlugins(builtin []*cli.Command) []*Plugin {
+	seen := make(map[string]bool)
+
+	for _, cmd := range builtin {
+		for _, name := range cmd.Names() {
+			seen[name] = true
+		}
+	}
+
+	seen["help"] = true
+	seen["h"] = true
+
+	result := make([]*Plugin, 0)
+
+	for _, dir := range pluginDirs() {
+		files, err := ioutil.ReadDir(dir)
+
+		if err != nil {
+			continue
+		}
+
+		for _, file := range files {
+			name := strings.TrimPrefix(file.Name(), pluginPrefix)
+
+			if name == file.Name() || name == "" || seen[name] {
+				continue
+			}
+
+			if file.IsDir() || file.Mode()&0111 == 0 {
+				continue
+			}
+
+			seen[name] = true
+
+			result = append(result, &Plugin{
+				Name: name,
+				Path: filepath.Join(dir, file.Name()),
+			})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// PluginCommands wraps the discovered plugins into executable commands.
+func PluginCommands(plugins []*Plugin) []*cli.Command {
+	result := make([]*cli.Command, 0, len(plugins))
+
+	for _, plugin := range plugins {
+		plugin := plugin
+
+		result = append(result, &cli.Command{
+			Name:            plugin.Name,
+			Usage:           fmt.Sprintf("plugin provided by %s", plugin.Path),
+			Category:        "Plugins",
+			SkipFlagParsing: true,
+			HideHelp:        true,
+			Action: func(c *cli.Context) error {
+				return RunPlugin(c, plugin)
+			},
+		})
+	}
+
+	return result
+}
+
+// Plugins provides the sub-command to manage plugins.
+func Plugins() *cli.Command {
+	return &cli.Command{
+		Name:  "plugin",
+		Usage: "plugin commands",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "list",
+				Aliases:   []string{"ls"},
+				Usage:     "list all plugins",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:   "format",
+						Value:  tmplPluginList,
+						Usage:  "custom output format",
+						Hidden: true,
+					},
+				},
+				Action: PluginList,
+			},
+		},
+	}
+}
+
+// PluginList provides the sub-command to list all plugins.
+func PluginList(c *cli.Context) error {
+	plugins, _ := c.App.Metadata["plugins"].([]*Plugin)
+
+	if len(plugins) == 0 {
+		logger.Info("empty result")
+		return nil
+	}
+
+	tmpl, err := template.New(
+		"_",
+	).Funcs(
+		globalFuncMap,
+	).Funcs(
+		sprigFuncMap,
+	).Parse(
+		fmt.Sprintln(c.String("format")),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	for _, record := range plugins {
+		if err := tmpl.Execute(os.Stdout, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunPlugin executes the plugin with the resolved connection settings
+// exported as environment variables.
+func RunPlugin(c *cli.Context, plugin *Plugin) error {
+	self, err := os.Executable()
+
+	if err != nil {
+		self = os.Args[0]
+	}
+
+	cmd := exec.CommandContext(
+		RootContext(c),
+		plugin.Path,
+		c.Args().Slice()...,
+	)
+
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	cmd.Env = append(
+		os.Environ(),
+		"GOMEMATIC_SERVER="+c.String("server"),
+		"GOMEMATIC_TOKEN="+c.String("token"),
+		"GOMEMATIC_CONTEXT="+c.String("context"),
+		"GOMEMATIC_CONFIG="+GetConfig(c).Path,
+		"GOMEMATIC_CLI="+self,
+	)
+
+	if err := cmd.Run(); err != nil {
+		if RootContext(c).Err() != nil {
+			os.Exit(ExitInterrupted)
+		}
+
+		if exit, ok := err.(*exec.ExitError); ok {
+			os.Exit(exit.ExitCode())
+		}
+
+		logger.Errorf("failed to execute plugin: %s", err)
+		os.Exit(2)
+	}
+
+	return nil
+}
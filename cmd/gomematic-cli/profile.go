@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"text/template"
+	"time"
 
 	"github.com/go-openapi/strfmt"
 	"github.com/gomematic/gomematic-go/gomematic/auth"
@@ -88,6 +90,15 @@ func Profile() *cli.Command {
 				Name:  "show",
 				Usage: "show profile details",
 				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "watch",
+						Usage: "refresh periodically and highlight changes",
+					},
+					&cli.DurationFlag{
+						Name:  "interval",
+						Value: 5 * time.Second,
+						Usage: "interval between refreshes while watching",
+					},
 					&cli.StringFlag{
 						Name:   "format",
 						Value:  tmplProfileShow,
@@ -121,7 +132,21 @@ func Profile() *cli.Command {
 					&cli.StringFlag{
 						Name:  "password",
 						Value: "",
-						Usage: "provide a password",
+						Usage: "provide a password, accepts env:VAR, file:path, exec:command, literal:value or -",
+					},
+					&cli.BoolFlag{
+						Name:  "generate-password",
+						Usage: "generate a random password",
+					},
+					&cli.IntFlag{
+						Name:  "length",
+						Value: 20,
+						Usage: "length of the generated password",
+					},
+					&cli.StringFlag{
+						Name:  "password-file",
+						Value: "",
+						Usage: "write the generated password to this file",
 					},
 				},
 				Action: func(c *cli.Context) error {
@@ -133,7 +158,7 @@ func Profile() *cli.Command {
 }
 
 // ProfileLogin provides the sub-command to login by credentials.
-func ProfileLogin(c *cli.Context, client *Client) error {
+func ProfileLogin(ctx context.Context, c *cli.Context, client *Client) error {
 	if !c.IsSet("username") {
 		return fmt.Errorf("please provide a username")
 	}
@@ -146,7 +171,7 @@ func ProfileLogin(c *cli.Context, client *Client) error {
 	password := strfmt.Password(c.String("password"))
 
 	resp, err := client.Auth.LoginUser(
-		auth.NewLoginUserParams().WithAuthLogin(&models.AuthLogin{
+		auth.NewLoginUserParams().WithContext(ctx).WithAuthLogin(&models.AuthLogin{
 			Username: &username,
 			Password: &password,
 		}),
@@ -181,9 +206,9 @@ func ProfileLogin(c *cli.Context, client *Client) error {
 }
 
 // ProfileToken provides the sub-command to show your token.
-func ProfileToken(c *cli.Context, client *Client) error {
+func ProfileToken(ctx context.Context, c *cli.Context, client *Client) error {
 	resp, err := client.Profile.TokenProfile(
-		profile.NewTokenProfileParams(),
+		profile.NewTokenProfileParams().WithContext(ctx),
 		client.AuthInfo,
 	)
 
@@ -218,59 +243,26 @@ func ProfileToken(c *cli.Context, client *Client) error {
 }
 
 // ProfileShow provides the sub-command to show profile details.
-func ProfileShow(c *cli.Context, client *Client) error {
-	resp, err := client.Profile.ShowProfile(
-		profile.NewShowProfileParams(),
-		client.AuthInfo,
-	)
+func ProfileShow(ctx context.Context, c *cli.Context, client *Client) error {
+	return renderRecords(ctx, c, func(ctx context.Context) ([]interface{}, error) {
+		record, err := showProfile(ctx, client)
 
-	if err != nil {
-		switch val := err.(type) {
-		case *profile.ShowProfileForbidden:
-			return fmt.Errorf(*val.Payload.Message)
-		case *profile.ShowProfileDefault:
-			return fmt.Errorf(*val.Payload.Message)
-		default:
-			return PrettyError(err)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	tmpl, err := template.New(
-		"_",
-	).Funcs(
-		globalFuncMap,
-	).Funcs(
-		sprigFuncMap,
-	).Parse(
-		fmt.Sprintln(c.String("format")),
-	)
-
-	if err != nil {
-		return err
-	}
 
-	return tmpl.Execute(os.Stdout, resp.Payload)
+		return []interface{}{record}, nil
+	})
 }
 
 // ProfileUpdate provides the sub-command to update the profile.
-func ProfileUpdate(c *cli.Context, client *Client) error {
-	resp, err := client.Profile.ShowProfile(
-		profile.NewShowProfileParams(),
-		client.AuthInfo,
-	)
+func ProfileUpdate(ctx context.Context, c *cli.Context, client *Client) error {
+	record, err := showProfile(ctx, client)
 
 	if err != nil {
-		switch val := err.(type) {
-		case *profile.ShowProfileForbidden:
-			return fmt.Errorf(*val.Payload.Message)
-		case *profile.ShowProfileDefault:
-			return fmt.Errorf(*val.Payload.Message)
-		default:
-			return PrettyError(err)
-		}
+		return err
 	}
 
-	record := resp.Payload
 	changed := false
 
 	if val := c.String("slug"); c.IsSet("slug") && val != *record.Slug {
@@ -288,9 +280,15 @@ func ProfileUpdate(c *cli.Context, client *Client) error {
 		changed = true
 	}
 
-	if val := c.String("password"); c.IsSet("password") {
-		password := strfmt.Password(val)
-		record.Password = &password
+	password, generated, err := resolvePassword(c, *record.Username, *record.Email)
+
+	if err != nil {
+		return err
+	}
+
+	if password != "" {
+		val := strfmt.Password(password)
+		record.Password = &val
 		changed = true
 	}
 
@@ -300,7 +298,7 @@ func ProfileUpdate(c *cli.Context, client *Client) error {
 		}
 
 		_, err := client.Profile.UpdateProfile(
-			profile.NewUpdateProfileParams().WithProfile(record),
+			profile.NewUpdateProfileParams().WithContext(ctx).WithProfile(record),
 			client.AuthInfo,
 		)
 
@@ -317,10 +315,35 @@ func ProfileUpdate(c *cli.Context, client *Client) error {
 			}
 		}
 
-		fmt.Fprintln(os.Stderr, "successfully update")
+		logger.Info("successfully update")
+
+		if generated {
+			return handoutPassword(c, password)
+		}
 	} else {
-		fmt.Fprintln(os.Stderr, "nothing to update...")
+		logger.Info("nothing to update...")
 	}
 
 	return nil
 }
+
+// showProfile fetches the profile of the authenticated user.
+func showProfile(ctx context.Context, client *Client) (*models.Profile, error) {
+	resp, err := client.Profile.ShowProfile(
+		profile.NewShowProfileParams().WithContext(ctx),
+		client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *profile.ShowProfileForbidden:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *profile.ShowProfileDefault:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		default:
+			return nil, PrettyError(err)
+		}
+	}
+
+	return resp.Payload, nil
+}
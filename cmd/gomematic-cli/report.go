@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/gomematic/gomematic-go/models"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// tmplReportMatrixHTML represents the matrix as a standalone html page.
+var tmplReportMatrixHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Membership matrix</title>
+<style>
+table { border-collapse: collapse; font-family: sans-serif; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: center; }
+td.owner { background: #f8d7da; }
+td.admin { background: #fff3cd; }
+td.user { background: #d4edda; }
+</style>
+</head>
+<body>
+<table>
+<thead>
+<tr>{{ range .Header }}<th>{{ . }}</th>{{ end }}</tr>
+</thead>
+<tbody>
+{{- range .Rows }}
+<tr>{{ range $i, $cell := . }}<td{{ if gt $i 1 }} class="{{ $cell }}"{{ end }}>{{ $cell }}</td>{{ end }}</tr>
+{{- end }}
+</tbody>
+</table>
+</body>
+</html>
+`
+
+// MembershipMatrix represents users by teams including their permissions.
+type MembershipMatrix struct {
+	Header []string
+	Rows   [][]string
+}
+
+// Report provides the sub-command for reports.
+func Report() *cli.Command {
+	return &cli.Command{
+		Name:  "report",
+		Usage: "report commands",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "matrix",
+				Usage:     "users by teams membership matrix",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Value:   "table",
+						Usage:   "output format, can be table, csv, markdown or html",
+					},
+					&cli.StringSliceFlag{
+						Name:    "team",
+						Aliases: []string{"t"},
+						Usage:   "limit to team id or slug",
+					},
+					&cli.BoolFlag{
+						Name:  "privileged",
+						Usage: "only show users with admin or owner permissions",
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Value: 8,
+						Usage: "number of parallel requests",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return Handle(c, ReportMatrix)
+				},
+			},
+		},
+	}
+}
+
+// ReportMatrix provides the sub-command to render the membership matrix.
+func ReportMatrix(ctx context.Context, c *cli.Context, client *Client) error {
+	var (
+		users []*models.User
+		teams []*models.Team
+	)
+
+	if err := parallel(ctx, 2, 2, func(ctx context.Context, i int) error {
+		var err error
+
+		if i == 0 {
+			users, err = listUsers(ctx, client)
+		} else {
+			teams, err = listTeams(ctx, client)
+		}
+
+		return err
+	}); err != nil {
+		return err
+	}
+
+	teams = filterTeams(teams, c.StringSlice("team"))
+
+	if len(users) == 0 || len(teams) == 0 {
+		logger.Info("empty result")
+		return nil
+	}
+
+	members := make([][]*models.TeamUser, len(teams))
+
+	if err := parallel(ctx, c.Int("concurrency"), len(teams), func(ctx context.Context, i int) error {
+		records, err := teamUsers(ctx, client, teams[i].ID.String())
+
+		if err != nil {
+			return fmt.Errorf("failed to fetch users of %s: %s", stringValue(teams[i].Slug, teams[i].ID.String()), err)
+		}
+
+		members[i] = records
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	matrix := buildMatrix(users, teams, members, c.Bool("privileged"))
+
+	switch c.String("output") {
+	case "table":
+		return matrix.Table(os.Stdout)
+	case "csv":
+		return matrix.CSV(os.Stdout)
+	case "markdown", "md":
+		return matrix.Markdown(os.Stdout)
+	case "html":
+		return matrix.HTML(os.Stdout)
+	default:
+		return fmt.Errorf("invalid output, can be table, csv, markdown or html")
+	}
+}
+
+// buildMatrix combines the users, teams and memberships to a matrix.
+func buildMatrix(users []*models.User, teams []*models.Team, members [][]*models.TeamUser, privileged bool) *MembershipMatrix {
+	matrix := &MembershipMatrix{
+		Header: []string{"User", "Admin"},
+		Rows:   make([][]string, 0, len(users)),
+	}
+
+	for _, record := range teams {
+		matrix.Header = append(matrix.Header, stringValue(record.Slug, record.ID.String()))
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return stringValue(users[i].Slug, users[i].ID.String()) < stringValue(users[j].Slug, users[j].ID.String())
+	})
+
+	for _, record := range users {
+		admin := record.Admin != nil && *record.Admin
+		row := []string{stringValue(record.Slug, record.ID.String()), fmt.Sprintf("%t", admin)}
+		elevated := admin
+
+		for i := range teams {
+			perm := ""
+
+			for _, member := range members[i] {
+				if member.Perm == nil {
+					continue
+				}
+
+				if (member.UserID != nil && *member.UserID == record.ID) || matchUser(member.User, record.ID.String()) {
+					perm = *member.Perm
+					break
+				}
+			}
+
+			if perm == "admin" || perm == "owner" {
+				elevated = true
+			}
+
+			row = append(row, perm)
+		}
+
+		if privileged && !elevated {
+			continue
+		}
+
+		matrix.Rows = append(matrix.Rows, row)
+	}
+
+	return matrix
+}
+
+// Table renders the matrix as aligned terminal table.
+func (m *MembershipMatrix) Table(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(m.Header, "\t"))
+
+	for _, row := range m.Rows {
+		cells := make([]string, len(row))
+
+		for i, cell := range row {
+			if cell == "" {
+				cell = "-"
+			}
+
+			cells[i] = cell
+		}
+
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// CSV renders the matrix as comma separated values.
+func (m *MembershipMatrix) CSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write(m.Header); err != nil {
+		return err
+	}
+
+	if err := cw.WriteAll(m.Rows); err != nil {
+		return err
+	}
+
+	return cw.Error()
+}
+
+// Markdown renders the matrix as markdown table.
+func (m *MembershipMatrix) Markdown(w io.Writer) error {
+	escape := strings.NewReplacer("|", "\\|")
+	row := func(cells []string) string {
+		escaped := make([]string, len(cells))
+
+		for i, cell := range cells {
+			escaped[i] = escape.Replace(cell)
+		}
+
+		return "| " + strings.Join(escaped, " | ") + " |"
+	}
+
+	separator := make([]string, len(m.Header))
+
+	for i := range separator {
+		separator[i] = "---"
+	}
+
+	fmt.Fprintln(w, row(m.Header))
+	fmt.Fprintln(w, row(separator))
+
+	for _, cells := range m.Rows {
+		if _, err := fmt.Fprintln(w, row(cells)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HTML renders the matrix as standalone html page.
+func (m *MembershipMatrix) HTML(w io.Writer) error {
+	tmpl, err := template.New("_").Parse(tmplReportMatrixHTML)
+
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(w, m)
+}
+
+// filterTeams limits the teams to the given ids or slugs.
+func filterTeams(teams []*models.Team, filter []string) []*models.Team {
+	if len(filter) == 0 {
+		return teams
+	}
+
+	result := make([]*models.Team, 0, len(filter))
+
+	for _, record := range teams {
+		for _, val := range filter {
+			if record.ID.String() == val || stringValue(record.Slug, "") == val {
+				result = append(result, record)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// parallel executes the function for all indices with limited concurrency,
+// it stops scheduling new work on the first error or if the context is done.
+func parallel(ctx context.Context, concurrency, count int, fn func(context.Context, int) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+
+	sem := make(chan struct{}, concurrency)
+
+	for i := 0; i < count; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := fn(ctx, i); err != nil {
+				once.Do(func() {
+					first = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if first == nil && ctx.Err() != nil {
+		return fmt.Errorf("interrupted")
+	}
+
+	return first
+}
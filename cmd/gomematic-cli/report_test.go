@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/gomematic/gomematic-go/models"
+)
+
+func TestBuildMatrix(t *testing.T) {
+	slug := func(val string) *string {
+		return &val
+	}
+
+	admin := true
+	owner := "owner"
+
+	users := []*models.User{
+		{ID: strfmt.UUID("00000000-0000-0000-0000-000000000002"), Slug: slug("bob")},
+		{ID: strfmt.UUID("00000000-0000-0000-0000-000000000001"), Admin: &admin},
+	}
+
+	teams := []*models.Team{
+		{ID: strfmt.UUID("00000000-0000-0000-0000-00000000000a"), Slug: slug("ops")},
+		{ID: strfmt.UUID("00000000-0000-0000-0000-00000000000b")},
+	}
+
+	members := [][]*models.TeamUser{
+		{
+			{UserID: &users[0].ID, Perm: &owner},
+			{UserID: &users[1].ID},
+		},
+		{
+			{User: users[1], Perm: &owner},
+		},
+	}
+
+	matrix := buildMatrix(users, teams, members, false)
+
+	expected := &MembershipMatrix{
+		Header: []string{"User", "Admin", "ops", "00000000-0000-0000-0000-00000000000b"},
+		Rows: [][]string{
+			{"00000000-0000-0000-0000-000000000001", "true", "", "owner"},
+			{"bob", "false", "owner", ""},
+		},
+	}
+
+	if !reflect.DeepEqual(matrix, expected) {
+		t.Errorf("expected %v, got %v", expected, matrix)
+	}
+}
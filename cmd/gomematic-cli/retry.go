@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime"
+)
+
+// maxRetryBackoff defines the upper limit for a single backoff delay.
+const maxRetryBackoff = 30 * time.Second
+
+// RetryError wraps a network error of an operation that had been attempted
+// multiple times before giving up.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+// Error implements the error interface.
+func (e *RetryError) Error() string {
+	return e.Err.Error()
+}
+
+// retryTransport wraps the API transport to apply request timeouts and to
+// retry operations which failed because of network errors.
+type retryTransport struct {
+	next    runtime.ClientTransport
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	unsafe  bool
+}
+
+// Submit implements the runtime.ClientTransport interface.
+func (t *retryTransport) Submit(op *runtime.ClientOperation) (interface{}, error) {
+	parent := op.Context
+
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	parent, span := StartSpan(parent, op.ID, SpanInternal)
+	span.SetAttribute("gomematic.operation", op.ID)
+	span.SetAttribute("http.method", op.Method)
+	span.SetAttribute("http.route", op.PathPattern)
+
+	attempts := 0
+	result, err := t.submit(parent, op, &attempts)
+
+	span.SetAttribute("retry.count", attempts-1)
+	span.SetError(err)
+	span.Finish()
+
+	return result, err
+}
+
+// submit executes the operation until it succeeds or the retries are
+// exhausted, it records the number of attempts.
+func (t *retryTransport) submit(parent context.Context, op *runtime.ClientOperation, attempts *int) (interface{}, error) {
+	for attempt := 1; ; attempt++ {
+		*attempts = attempt
+		result, err := t.attempt(parent, op)
+
+		if err == nil {
+			return result, nil
+		}
+
+		if !NetworkError(err) {
+			return nil, err
+		}
+
+		if attempt > t.retries || !t.idempotent(op) || parent.Err() != nil {
+			if attempt > 1 {
+				return nil, &RetryError{
+					Attempts: attempt,
+					Err:      err,
+				}
+			}
+
+			return nil, err
+		}
+
+		wait := t.delay(attempt)
+		logger.Debug("retrying request", "operation", op.ID, "attempt", attempt, "delay", wait, "err", err)
+
+		select {
+		case <-time.After(wait):
+		case <-parent.Done():
+			return nil, &RetryError{
+				Attempts: attempt,
+				Err:      err,
+			}
+		}
+	}
+}
+
+// attempt submits the operation once, limited by the request timeout.
+func (t *retryTransport) attempt(parent context.Context, op *runtime.ClientOperation) (interface{}, error) {
+	ctx, cancel := timeoutContext(parent, t.timeout)
+	defer cancel()
+
+	op.Context = ctx
+	return t.next.Submit(op)
+}
+
+// timeoutContext derives a context limited by the timeout, a timeout of
+// zero disables the limit.
+func timeoutContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+
+	return context.WithCancel(parent)
+}
+
+// idempotent checks if the operation can be safely repeated.
+func (t *retryTransport) idempotent(op *runtime.ClientOperation) bool {
+	if t.unsafe {
+		return true
+	}
+
+	switch op.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	default:
+		return false
+	}
+}
+
+// delay calculates an exponential backoff including some jitter.
+func (t *retryTransport) delay(attempt int) time.Duration {
+	if t.backoff <= 0 {
+		return 0
+	}
+
+	wait := t.backoff << uint(attempt-1)
+
+	if wait <= 0 || wait > maxRetryBackoff {
+		wait = maxRetryBackoff
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
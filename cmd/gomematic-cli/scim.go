@@ -0,0 +1,1344 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/gomematic/gomematic-go/gomematic/team"
+	"github.com/gomematic/gomematic-go/gomematic/user"
+	"github.com/gomematic/gomematic-go/models"
+	"gopkg.in/urfave/cli.v2"
+)
+
+const (
+	scimUserSchema     = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema    = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema     = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimPatchSchema    = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimErrorSchema    = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimProviderSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimContentType    = "application/scim+json"
+)
+
+var (
+	// scimFilterPattern matches the supported filters like userName eq "bob".
+	scimFilterPattern = regexp.MustCompile(`(?i)^\s*([a-z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+	// scimMemberPathPattern matches member paths like members[value eq "id"].
+	scimMemberPathPattern = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]*)"\s*\]$`)
+)
+
+// SCIMUser represents a user resource of SCIM.
+type SCIMUser struct {
+	Schemas  []string     `json:"schemas"`
+	ID       string       `json:"id,omitempty"`
+	UserName string       `json:"userName"`
+	Active   *bool        `json:"active,omitempty"`
+	Password string       `json:"password,omitempty"`
+	Emails   []SCIMValue  `json:"emails,omitempty"`
+	Groups   []SCIMMember `json:"groups,omitempty"`
+	Meta     *SCIMMeta    `json:"meta,omitempty"`
+}
+
+// SCIMGroup represents a group resource of SCIM.
+type SCIMGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []SCIMMember `json:"members,omitempty"`
+	Meta        *SCIMMeta    `json:"meta,omitempty"`
+}
+
+// SCIMValue represents a multi-valued attribute like emails.
+type SCIMValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMMember represents a reference to a user or group.
+type SCIMMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+// SCIMMeta represents the meta attributes of a resource.
+type SCIMMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+// SCIMList represents a list response of SCIM.
+type SCIMList struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// SCIMPatch represents a patch request of SCIM.
+type SCIMPatch struct {
+	Schemas    []string        `json:"schemas"`
+	Operations []SCIMOperation `json:"Operations"`
+}
+
+// SCIMOperation represents a single operation within a patch request.
+type SCIMOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// SCIMError represents an error response of SCIM.
+type SCIMError struct {
+	Status   int
+	SCIMType string
+	Detail   string
+}
+
+// Error implements the error interface.
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+// SCIMServer translates SCIM requests into calls of the gomematic api, all
+// mutations get recorded within the audit journal.
+type SCIMServer struct {
+	c           *cli.Context
+	client      *Client
+	token       string
+	base        string
+	external    string
+	trustProxy  bool
+	policy      *PasswordPolicy
+	concurrency int
+}
+
+// ServeSCIM provides the sub-command to serve the SCIM provisioning bridge.
+func ServeSCIM(ctx context.Context, c *cli.Context, client *Client) error {
+	if c.String("bearer-token") == "" {
+		return fmt.Errorf("you must provide a bearer token")
+	}
+
+	external := strings.TrimRight(c.String("external-url"), "/")
+
+	if external != "" {
+		val, err := url.Parse(external)
+
+		if err != nil || val.Scheme == "" || val.Host == "" {
+			return fmt.Errorf("invalid external url %q, use a full address like https://scim.example.com/scim/v2", external)
+		}
+	}
+
+	server := &SCIMServer{
+		c:           c,
+		client:      client,
+		token:       c.String("bearer-token"),
+		base:        "/" + strings.Trim(c.String("base-path"), "/"),
+		external:    external,
+		trustProxy:  c.Bool("trust-proxy"),
+		policy:      GetConfig(c).Password,
+		concurrency: c.Int("concurrency"),
+	}
+
+	if err := listenAndServe(ctx, c.String("listen"), server); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *SCIMServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	header := r.Header.Get("Authorization")
+
+	if !strings.HasPrefix(header, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(s.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="gomematic"`)
+		s.fail(w, &SCIMError{Status: http.StatusUnauthorized, Detail: "invalid or missing bearer token"})
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, s.base+"/") {
+		s.fail(w, &SCIMError{Status: http.StatusNotFound, Detail: "endpoint not found"})
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, s.base), "/"), "/")
+	ctx := r.Context()
+
+	var (
+		status = http.StatusOK
+		result interface{}
+		err    error
+	)
+
+	switch {
+	case len(parts) == 1 && parts[0] == "ServiceProviderConfig" && r.Method == http.MethodGet:
+		result = s.providerConfig()
+	case len(parts) == 1 && parts[0] == "Users" && r.Method == http.MethodGet:
+		result, err = s.listUsers(ctx, r)
+	case len(parts) == 1 && parts[0] == "Users" && r.Method == http.MethodPost:
+		status = http.StatusCreated
+		result, err = s.createUser(ctx, r)
+	case len(parts) == 2 && parts[0] == "Users" && r.Method == http.MethodGet:
+		result, err = s.getUser(ctx, r, parts[1])
+	case len(parts) == 2 && parts[0] == "Users" && r.Method == http.MethodPut:
+		result, err = s.replaceUser(ctx, r, parts[1])
+	case len(parts) == 2 && parts[0] == "Users" && r.Method == http.MethodPatch:
+		result, err = s.patchUser(ctx, r, parts[1])
+	case len(parts) == 2 && parts[0] == "Users" && r.Method == http.MethodDelete:
+		status = http.StatusNoContent
+		err = s.deleteUser(ctx, r, parts[1])
+	case len(parts) == 1 && parts[0] == "Groups" && r.Method == http.MethodGet:
+		result, err = s.listGroups(ctx, r)
+	case len(parts) == 1 && parts[0] == "Groups" && r.Method == http.MethodPost:
+		status = http.StatusCreated
+		result, err = s.createGroup(ctx, r)
+	case len(parts) == 2 && parts[0] == "Groups" && r.Method == http.MethodGet:
+		result, err = s.getGroup(ctx, r, parts[1])
+	case len(parts) == 2 && parts[0] == "Groups" && r.Method == http.MethodPut:
+		result, err = s.replaceGroup(ctx, r, parts[1])
+	case len(parts) == 2 && parts[0] == "Groups" && r.Method == http.MethodPatch:
+		result, err = s.patchGroup(ctx, r, parts[1])
+	case len(parts) == 2 && parts[0] == "Groups" && r.Method == http.MethodDelete:
+		status = http.StatusNoContent
+		err = s.deleteGroup(ctx, r, parts[1])
+	default:
+		err = &SCIMError{Status: http.StatusNotFound, Detail: "endpoint not found"}
+	}
+
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+
+	if status == http.StatusCreated {
+		switch val := result.(type) {
+		case *SCIMUser:
+			w.Header().Set("Location", val.Meta.Location)
+		case *SCIMGroup:
+			w.Header().Set("Location", val.Meta.Location)
+		}
+	}
+
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// fail writes a SCIM error response.
+func (s *SCIMServer) fail(w http.ResponseWriter, err error) {
+	val, ok := err.(*SCIMError)
+
+	if !ok {
+		val = &SCIMError{Status: http.StatusBadRequest, Detail: err.Error()}
+	}
+
+	body := map[string]interface{}{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(val.Status),
+		"detail":  val.Detail,
+	}
+
+	if val.SCIMType != "" {
+		body["scimType"] = val.SCIMType
+	}
+
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(val.Status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// providerConfig describes the supported features of the bridge.
+func (s *SCIMServer) providerConfig() interface{} {
+	supported := func(val bool) map[string]interface{} {
+		return map[string]interface{}{"supported": val}
+	}
+
+	return map[string]interface{}{
+		"schemas":        []string{scimProviderSchema},
+		"patch":          supported(true),
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": 1000},
+		"changePassword": supported(true),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]interface{}{
+			{
+				"type":        "oauthbearertoken",
+				"name":        "Bearer Token",
+				"description": "Authentication via a static bearer token",
+			},
+		},
+	}
+}
+
+// listUsers lists all users matching the filter.
+func (s *SCIMServer) listUsers(ctx context.Context, r *http.Request) (interface{}, error) {
+	attr, val, err := parseSCIMFilter(r.URL.Query().Get("filter"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := listUsers(ctx, s.client)
+
+	if err != nil {
+		return nil, &SCIMError{Status: http.StatusBadGateway, Detail: err.Error()}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return stringValue(records[i].Username, "") < stringValue(records[j].Username, "")
+	})
+
+	result := make([]interface{}, 0, len(records))
+
+	for _, record := range records {
+		resource := s.toUser(r, record)
+
+		switch attr {
+		case "":
+		case "id":
+			if resource.ID != val {
+				continue
+			}
+		case "username":
+			if !strings.EqualFold(resource.UserName, val) {
+				continue
+			}
+		case "emails", "emails.value":
+			if len(resource.Emails) == 0 || !strings.EqualFold(resource.Emails[0].Value, val) {
+				continue
+			}
+		default:
+			return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidFilter", Detail: fmt.Sprintf("filtering by %s is not supported", attr)}
+		}
+
+		result = append(result, resource)
+	}
+
+	return paginateSCIM(r, result)
+}
+
+// getUser fetches a single user.
+func (s *SCIMServer) getUser(ctx context.Context, r *http.Request, id string) (interface{}, error) {
+	record, err := s.showUser(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toUser(r, record), nil
+}
+
+// createUser creates a user, a password gets generated if it is missing.
+func (s *SCIMServer) createUser(ctx context.Context, r *http.Request) (interface{}, error) {
+	resource := &SCIMUser{}
+
+	if err := json.NewDecoder(r.Body).Decode(resource); err != nil {
+		return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: err.Error()}
+	}
+
+	if resource.UserName == "" {
+		return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "userName is required"}
+	}
+
+	records, err := listUsers(ctx, s.client)
+
+	if err != nil {
+		return nil, &SCIMError{Status: http.StatusBadGateway, Detail: err.Error()}
+	}
+
+	for _, record := range records {
+		if strings.EqualFold(stringValue(record.Username, ""), resource.UserName) || strings.EqualFold(stringValue(record.Slug, ""), resource.UserName) {
+			return nil, &SCIMError{Status: http.StatusConflict, SCIMType: "uniqueness", Detail: fmt.Sprintf("user %s already exists", resource.UserName)}
+		}
+	}
+
+	record := &models.User{
+		Username: &resource.UserName,
+	}
+
+	if err := s.applyUser(record, resource); err != nil {
+		return nil, err
+	}
+
+	if record.Active == nil {
+		active := true
+		record.Active = &active
+	}
+
+	if record.Password == nil {
+		val, err := s.policy.Generate(32, resource.UserName, stringValue(record.Email, ""))
+
+		if err != nil {
+			return nil, &SCIMError{Status: http.StatusInternalServerError, Detail: err.Error()}
+		}
+
+		password := strfmt.Password(val)
+		record.Password = &password
+	}
+
+	id := ""
+
+	if err := s.journal(ctx, r, []string{"user", "create"}, "", func() (string, error) {
+		created, err := userCreate(ctx, s.client, record)
+
+		if err != nil {
+			return "", &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: err.Error()}
+		}
+
+		id = created.ID.String()
+		return id, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return s.getUser(ctx, r, id)
+}
+
+// replaceUser replaces all attributes of a user.
+func (s *SCIMServer) replaceUser(ctx context.Context, r *http.Request, id string) (interface{}, error) {
+	record, err := s.showUser(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resource := &SCIMUser{}
+
+	if err := json.NewDecoder(r.Body).Decode(resource); err != nil {
+		return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: err.Error()}
+	}
+
+	if resource.UserName == "" {
+		return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "userName is required"}
+	}
+
+	record.Username = &resource.UserName
+	return s.updateUser(ctx, r, record, resource)
+}
+
+// patchUser applies patch operations to a user.
+func (s *SCIMServer) patchUser(ctx context.Context, r *http.Request, id string) (interface{}, error) {
+	record, err := s.showUser(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := decodeSCIMPatch(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resource := s.toUser(r, record)
+
+	for _, op := range patch.Operations {
+		if err := patchSCIMUser(resource, op); err != nil {
+			return nil, err
+		}
+	}
+
+	record.Username = &resource.UserName
+	return s.updateUser(ctx, r, record, resource)
+}
+
+// updateUser writes the attributes of the resource to the user.
+func (s *SCIMServer) updateUser(ctx context.Context, r *http.Request, record *models.User, resource *SCIMUser) (interface{}, error) {
+	if err := s.applyUser(record, resource); err != nil {
+		return nil, err
+	}
+
+	record.Teams = nil
+
+	if err := s.journal(ctx, r, []string{"user", "update"}, record.ID.String(), func() (string, error) {
+		if err := userUpdate(ctx, s.client, record); err != nil {
+			return "", &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: err.Error()}
+		}
+
+		return record.ID.String(), nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return s.getUser(ctx, r, record.ID.String())
+}
+
+// deleteUser deletes a user, the last owner of a team can not be deleted.
+func (s *SCIMServer) deleteUser(ctx context.Context, r *http.Request, id string) error {
+	record, err := s.showUser(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	return s.journal(ctx, r, []string{"user", "delete"}, record.ID.String(), func() (string, error) {
+		teams, err := userTeams(ctx, s.client, record.ID.String())
+
+		if err != nil {
+			return "", &SCIMError{Status: http.StatusBadGateway, Detail: err.Error()}
+		}
+
+		for _, teamID := range ownedTeams(teams) {
+			if err := s.guardMembers(ctx, teamID, []*membershipChange{{Action: "remove", Target: record.ID.String()}}); err != nil {
+				return "", err
+			}
+		}
+
+		if _, err := userDelete(ctx, s.client, record.ID.String()); err != nil {
+			return "", &SCIMError{Status: http.StatusBadRequest, Detail: err.Error()}
+		}
+
+		return "", nil
+	})
+}
+
+// applyUser copies email, active and password of the resource.
+func (s *SCIMServer) applyUser(record *models.User, resource *SCIMUser) error {
+	if email := primarySCIMValue(resource.Emails); email != "" {
+		record.Email = &email
+	}
+
+	if record.Email == nil {
+		return &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "an email is required"}
+	}
+
+	if resource.Active != nil {
+		record.Active = resource.Active
+	}
+
+	if resource.Password != "" {
+		if err := s.policy.Check(resource.Password, resource.UserName, *record.Email); err != nil {
+			return &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: err.Error()}
+		}
+
+		password := strfmt.Password(resource.Password)
+		record.Password = &password
+	}
+
+	return nil
+}
+
+// showUser fetches a user and maps a missing user to a SCIM error.
+func (s *SCIMServer) showUser(ctx context.Context, id string) (*models.User, error) {
+	resp, err := s.client.User.ShowUser(
+		user.NewShowUserParams().WithContext(ctx).WithUserID(id),
+		s.client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *user.ShowUserForbidden:
+			return nil, &SCIMError{Status: http.StatusForbidden, Detail: *val.Payload.Message}
+		case *user.ShowUserNotFound:
+			return nil, &SCIMError{Status: http.StatusNotFound, Detail: fmt.Sprintf("user %s not found", id)}
+		case *user.ShowUserDefault:
+			return nil, &SCIMError{Status: http.StatusBadGateway, Detail: *val.Payload.Message}
+		default:
+			return nil, &SCIMError{Status: http.StatusBadGateway, Detail: PrettyError(err).Error()}
+		}
+	}
+
+	return resp.Payload, nil
+}
+
+// toUser converts a user to a SCIM resource.
+func (s *SCIMServer) toUser(r *http.Request, record *models.User) *SCIMUser {
+	active := record.Active != nil && *record.Active
+
+	result := &SCIMUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       record.ID.String(),
+		UserName: stringValue(record.Username, ""),
+		Active:   &active,
+		Meta:     s.meta(r, "User", "Users", record.ID.String(), record.CreatedAt, record.UpdatedAt),
+	}
+
+	if record.Email != nil {
+		result.Emails = []SCIMValue{
+			{
+				Value:   *record.Email,
+				Type:    "work",
+				Primary: true,
+			},
+		}
+	}
+
+	for _, member := range record.Teams {
+		if member.Team == nil {
+			continue
+		}
+
+		result.Groups = append(result.Groups, SCIMMember{
+			Value:   member.Team.ID.String(),
+			Display: stringValue(member.Team.Name, ""),
+		})
+	}
+
+	return result
+}
+
+// listGroups lists all groups matching the filter.
+func (s *SCIMServer) listGroups(ctx context.Context, r *http.Request) (interface{}, error) {
+	attr, val, err := parseSCIMFilter(r.URL.Query().Get("filter"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := listTeams(ctx, s.client)
+
+	if err != nil {
+		return nil, &SCIMError{Status: http.StatusBadGateway, Detail: err.Error()}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return stringValue(records[i].Name, "") < stringValue(records[j].Name, "")
+	})
+
+	teams := make([]*models.Team, 0, len(records))
+
+	for _, record := range records {
+		switch attr {
+		case "":
+		case "id":
+			if record.ID.String() != val {
+				continue
+			}
+		case "displayname":
+			if !strings.EqualFold(stringValue(record.Name, ""), val) {
+				continue
+			}
+		default:
+			return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidFilter", Detail: fmt.Sprintf("filtering by %s is not supported", attr)}
+		}
+
+		teams = append(teams, record)
+	}
+
+	members := make([][]*models.TeamUser, len(teams))
+
+	if !strings.Contains(strings.ToLower(r.URL.Query().Get("excludedAttributes")), "members") {
+		if err := parallel(ctx, s.concurrency, len(teams), func(ctx context.Context, i int) error {
+			records, err := teamUsers(ctx, s.client, teams[i].ID.String())
+			members[i] = records
+
+			return err
+		}); err != nil {
+			return nil, &SCIMError{Status: http.StatusBadGateway, Detail: err.Error()}
+		}
+	}
+
+	result := make([]interface{}, 0, len(teams))
+
+	for i, record := range teams {
+		result = append(result, s.toGroup(r, record, members[i]))
+	}
+
+	return paginateSCIM(r, result)
+}
+
+// getGroup fetches a single group including its members.
+func (s *SCIMServer) getGroup(ctx context.Context, r *http.Request, id string) (interface{}, error) {
+	record, err := s.showTeam(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := teamUsers(ctx, s.client, record.ID.String())
+
+	if err != nil {
+		return nil, &SCIMError{Status: http.StatusBadGateway, Detail: err.Error()}
+	}
+
+	return s.toGroup(r, record, members), nil
+}
+
+// createGroup creates a team and assigns the members as users.
+func (s *SCIMServer) createGroup(ctx context.Context, r *http.Request) (interface{}, error) {
+	resource := &SCIMGroup{}
+
+	if err := json.NewDecoder(r.Body).Decode(resource); err != nil {
+		return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: err.Error()}
+	}
+
+	if resource.DisplayName == "" {
+		return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "displayName is required"}
+	}
+
+	records, err := listTeams(ctx, s.client)
+
+	if err != nil {
+		return nil, &SCIMError{Status: http.StatusBadGateway, Detail: err.Error()}
+	}
+
+	for _, record := range records {
+		if strings.EqualFold(stringValue(record.Name, ""), resource.DisplayName) {
+			return nil, &SCIMError{Status: http.StatusConflict, SCIMType: "uniqueness", Detail: fmt.Sprintf("group %s already exists", resource.DisplayName)}
+		}
+	}
+
+	id := ""
+
+	if err := s.journal(ctx, r, []string{"team", "create"}, "", func() (string, error) {
+		created, err := teamCreate(ctx, s.client, &models.Team{
+			Name: &resource.DisplayName,
+		})
+
+		if err != nil {
+			return "", &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: err.Error()}
+		}
+
+		id = created.ID.String()
+
+		if err := s.syncMembers(ctx, id, nil, scimMemberIDs(resource.Members)); err != nil {
+			return id, s.rollbackGroup(id, err)
+		}
+
+		return id, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return s.getGroup(ctx, r, id)
+}
+
+// rollbackGroup deletes a partially created team, the deletion is detached
+// from the request as the client could have gone already.
+func (s *SCIMServer) rollbackGroup(id string, failed error) error {
+	ctx, cancel := timeoutContext(context.Background(), s.c.Duration("timeout"))
+	defer cancel()
+
+	if _, err := teamDelete(ctx, s.client, id); err != nil {
+		return &SCIMError{Status: http.StatusInternalServerError, Detail: fmt.Sprintf("%s, failed to remove the created team %s: %s", failed, id, err)}
+	}
+
+	return failed
+}
+
+// replaceGroup replaces the name and members of a group.
+func (s *SCIMServer) replaceGroup(ctx context.Context, r *http.Request, id string) (interface{}, error) {
+	record, err := s.showTeam(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resource := &SCIMGroup{}
+
+	if err := json.NewDecoder(r.Body).Decode(resource); err != nil {
+		return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: err.Error()}
+	}
+
+	if resource.DisplayName == "" {
+		return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "displayName is required"}
+	}
+
+	return s.updateGroup(ctx, r, record, resource.DisplayName, scimMemberIDs(resource.Members))
+}
+
+// patchGroup applies patch operations to the name and members of a group.
+func (s *SCIMServer) patchGroup(ctx context.Context, r *http.Request, id string) (interface{}, error) {
+	record, err := s.showTeam(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := decodeSCIMPatch(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := teamUsers(ctx, s.client, record.ID.String())
+
+	if err != nil {
+		return nil, &SCIMError{Status: http.StatusBadGateway, Detail: err.Error()}
+	}
+
+	name := stringValue(record.Name, "")
+	members := make([]string, 0, len(current))
+
+	for _, member := range current {
+		if member.User != nil {
+			members = append(members, member.User.ID.String())
+		}
+	}
+
+	for _, op := range patch.Operations {
+		if name, members, err = patchSCIMGroup(name, members, op); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.updateGroup(ctx, r, record, name, members)
+}
+
+// updateGroup renames the team if required and reconciles the members.
+func (s *SCIMServer) updateGroup(ctx context.Context, r *http.Request, record *models.Team, name string, members []string) (interface{}, error) {
+	if err := s.journal(ctx, r, []string{"team", "update"}, record.ID.String(), func() (string, error) {
+		current, err := teamUsers(ctx, s.client, record.ID.String())
+
+		if err != nil {
+			return "", &SCIMError{Status: http.StatusBadGateway, Detail: err.Error()}
+		}
+
+		if name != stringValue(record.Name, "") {
+			record.Name = &name
+			record.Users = nil
+
+			if err := teamUpdate(ctx, s.client, record); err != nil {
+				return "", &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: err.Error()}
+			}
+		}
+
+		return record.ID.String(), s.syncMembers(ctx, record.ID.String(), current, members)
+	}); err != nil {
+		return nil, err
+	}
+
+	return s.getGroup(ctx, r, record.ID.String())
+}
+
+// syncMembers assigns missing members as users and removes all others,
+// existing members keep their permission.
+func (s *SCIMServer) syncMembers(ctx context.Context, teamID string, current []*models.TeamUser, members []string) error {
+	desired := make([][2]string, 0, len(members))
+
+	for _, id := range members {
+		perm := "user"
+
+		for _, member := range current {
+			if matchUser(member.User, id) && member.Perm != nil {
+				perm = *member.Perm
+			}
+		}
+
+		desired = append(desired, [2]string{id, perm})
+	}
+
+	plan := planTeamUserSync(current, desired, false)
+
+	if err := s.guardMembers(ctx, teamID, plan); err != nil {
+		return err
+	}
+
+	for _, change := range plan {
+		var err error
+
+		switch change.Action {
+		case "append":
+			_, err = teamUserAppend(ctx, s.client, teamID, change.Target, change.To)
+		case "perm":
+			_, err = teamUserPerm(ctx, s.client, teamID, change.Target, change.To)
+		case "remove":
+			_, err = teamUserRemove(ctx, s.client, teamID, change.Target)
+		}
+
+		if err != nil {
+			return &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: fmt.Sprintf("failed to %s: %s", change, err)}
+		}
+	}
+
+	return nil
+}
+
+// deleteGroup deletes a team.
+func (s *SCIMServer) deleteGroup(ctx context.Context, r *http.Request, id string) error {
+	record, err := s.showTeam(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	return s.journal(ctx, r, []string{"team", "delete"}, record.ID.String(), func() (string, error) {
+		if _, err := teamDelete(ctx, s.client, record.ID.String()); err != nil {
+			return "", &SCIMError{Status: http.StatusBadRequest, Detail: err.Error()}
+		}
+
+		return "", nil
+	})
+}
+
+// guardMembers refuses membership changes which would leave a team without
+// owner, like the last owner guard of the commands.
+func (s *SCIMServer) guardMembers(ctx context.Context, teamID string, plan []*membershipChange) error {
+	current, err := teamUsers(ctx, s.client, teamID)
+
+	if err != nil {
+		return &SCIMError{Status: http.StatusBadGateway, Detail: err.Error()}
+	}
+
+	if leavesNoOwner(current, plan) {
+		return &SCIMError{Status: http.StatusConflict, SCIMType: "mutability", Detail: fmt.Sprintf("the changes would leave team %s without owner, transfer the ownership first", teamID)}
+	}
+
+	return nil
+}
+
+// journal records a mutation within the audit journal like the mutating
+// commands, the state before gets stored as snapshot. The function returns
+// the id of the modified record to record the state afterwards.
+func (s *SCIMServer) journal(ctx context.Context, r *http.Request, command []string, id string, fn func() (string, error)) error {
+	entry := &AuditEntry{
+		ID:       auditID(),
+		Time:     time.Now().UTC(),
+		Operator: auditOperator(),
+		Server:   s.c.String("server"),
+		Context:  s.c.String("context"),
+		Command:  command,
+		Args:     []string{"scim", r.Method, r.URL.Path},
+		Targets:  make([]string, 0),
+	}
+
+	if id != "" {
+		entry.Targets = append(entry.Targets, id)
+		entry.Before = auditSnapshot(ctx, s.c, s.client, command, id)
+		saveSnapshot(s.c, entry)
+	}
+
+	recordID, err := fn()
+
+	if recordID == "" {
+		recordID = entry.Before.recordID()
+	}
+
+	if recordID != "" {
+		if id == "" {
+			entry.Targets = append(entry.Targets, recordID)
+		}
+
+		entry.After = auditSnapshot(ctx, s.c, s.client, command, recordID)
+	}
+
+	auditWrite(s.c, entry, err, ctx.Err() != nil)
+	return err
+}
+
+// showTeam fetches a team and maps a missing team to a SCIM error.
+func (s *SCIMServer) showTeam(ctx context.Context, id string) (*models.Team, error) {
+	resp, err := s.client.Team.ShowTeam(
+		team.NewShowTeamParams().WithContext(ctx).WithTeamID(id),
+		s.client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *team.ShowTeamForbidden:
+			return nil, &SCIMError{Status: http.StatusForbidden, Detail: *val.Payload.Message}
+		case *team.ShowTeamNotFound:
+			return nil, &SCIMError{Status: http.StatusNotFound, Detail: fmt.Sprintf("group %s not found", id)}
+		case *team.ShowTeamDefault:
+			return nil, &SCIMError{Status: http.StatusBadGateway, Detail: *val.Payload.Message}
+		default:
+			return nil, &SCIMError{Status: http.StatusBadGateway, Detail: PrettyError(err).Error()}
+		}
+	}
+
+	return resp.Payload, nil
+}
+
+// toGroup converts a team and its members to a SCIM resource.
+func (s *SCIMServer) toGroup(r *http.Request, record *models.Team, members []*models.TeamUser) *SCIMGroup {
+	result := &SCIMGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          record.ID.String(),
+		DisplayName: stringValue(record.Name, ""),
+		Meta:        s.meta(r, "Group", "Groups", record.ID.String(), record.CreatedAt, record.UpdatedAt),
+	}
+
+	for _, member := range members {
+		if member.User == nil {
+			continue
+		}
+
+		result.Members = append(result.Members, SCIMMember{
+			Value:   member.User.ID.String(),
+			Display: stringValue(member.User.Username, ""),
+		})
+	}
+
+	return result
+}
+
+// meta builds the meta attributes including the location of a resource.
+func (s *SCIMServer) meta(r *http.Request, kind, endpoint, id string, created, updated strfmt.DateTime) *SCIMMeta {
+	result := &SCIMMeta{
+		ResourceType: kind,
+		Location:     fmt.Sprintf("%s/%s/%s", s.location(r), endpoint, id),
+	}
+
+	if !time.Time(created).IsZero() {
+		result.Created = created.String()
+	}
+
+	if !time.Time(updated).IsZero() {
+		result.LastModified = updated.String()
+	}
+
+	return result
+}
+
+// location returns the external url of the endpoints, forwarded headers are
+// only used if the proxy is trusted as clients could set them otherwise.
+func (s *SCIMServer) location(r *http.Request) string {
+	if s.external != "" {
+		return s.external
+	}
+
+	scheme, host := "http", r.Host
+
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if s.trustProxy {
+		if val := r.Header.Get("X-Forwarded-Proto"); val == "http" || val == "https" {
+			scheme = val
+		}
+
+		if val := r.Header.Get("X-Forwarded-Host"); val != "" {
+			host = strings.TrimSpace(strings.Split(val, ",")[0])
+		}
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, host, s.base)
+}
+
+// patchSCIMUser applies a single patch operation to the user resource.
+func patchSCIMUser(resource *SCIMUser, op SCIMOperation) error {
+	kind := strings.ToLower(op.Op)
+	path := strings.ToLower(op.Path)
+
+	if kind != "add" && kind != "replace" {
+		return &SCIMError{Status: http.StatusBadRequest, SCIMType: "mutability", Detail: fmt.Sprintf("operation %s is not supported for users", op.Op)}
+	}
+
+	if path == "" {
+		values := make(map[string]json.RawMessage)
+
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "value must be an object without path"}
+		}
+
+		for key, val := range values {
+			if err := patchSCIMUser(resource, SCIMOperation{Op: op.Op, Path: key, Value: val}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	switch {
+	case path == "active":
+		val, err := scimBool(op.Value)
+
+		if err != nil {
+			return err
+		}
+
+		resource.Active = &val
+	case path == "username":
+		val, err := scimString(op.Value)
+
+		if err != nil {
+			return err
+		}
+
+		resource.UserName = val
+	case path == "password":
+		val, err := scimString(op.Value)
+
+		if err != nil {
+			return err
+		}
+
+		resource.Password = val
+	case path == "emails":
+		values := make([]SCIMValue, 0)
+
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "emails must be a list"}
+		}
+
+		resource.Emails = values
+	case strings.HasPrefix(path, "emails"):
+		val, err := scimString(op.Value)
+
+		if err != nil {
+			return err
+		}
+
+		resource.Emails = []SCIMValue{{Value: val, Type: "work", Primary: true}}
+	case strings.HasPrefix(path, "urn:") || path == "externalid" || strings.HasPrefix(path, "name") || path == "displayname":
+		// attributes without a counterpart within gomematic are ignored
+	default:
+		return &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidPath", Detail: fmt.Sprintf("path %s is not supported", op.Path)}
+	}
+
+	return nil
+}
+
+// patchSCIMGroup applies a single patch operation to the group name and
+// member ids.
+func patchSCIMGroup(name string, members []string, op SCIMOperation) (string, []string, error) {
+	kind := strings.ToLower(op.Op)
+	path := strings.ToLower(op.Path)
+
+	if path == "" {
+		if kind == "remove" {
+			return name, members, &SCIMError{Status: http.StatusBadRequest, SCIMType: "noTarget", Detail: "remove requires a path"}
+		}
+
+		values := make(map[string]json.RawMessage)
+
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return name, members, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "value must be an object without path"}
+		}
+
+		var err error
+
+		for key, val := range values {
+			if name, members, err = patchSCIMGroup(name, members, SCIMOperation{Op: op.Op, Path: key, Value: val}); err != nil {
+				return name, members, err
+			}
+		}
+
+		return name, members, nil
+	}
+
+	if match := scimMemberPathPattern.FindStringSubmatch(op.Path); match != nil {
+		if kind != "remove" {
+			return name, members, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidPath", Detail: "filtered member paths only support remove"}
+		}
+
+		return name, removeStrings(members, []string{match[1]}), nil
+	}
+
+	switch path {
+	case "displayname":
+		if kind == "remove" {
+			return name, members, &SCIMError{Status: http.StatusBadRequest, SCIMType: "mutability", Detail: "displayName is required"}
+		}
+
+		val, err := scimString(op.Value)
+		return val, members, err
+	case "members":
+		values := make([]SCIMMember, 0)
+
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				return name, members, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "members must be a list"}
+			}
+		}
+
+		ids := scimMemberIDs(values)
+
+		switch kind {
+		case "add":
+			for _, id := range ids {
+				if !containsString(members, id) {
+					members = append(members, id)
+				}
+			}
+
+			return name, members, nil
+		case "replace":
+			return name, ids, nil
+		case "remove":
+			if len(ids) == 0 {
+				return name, []string{}, nil
+			}
+
+			return name, removeStrings(members, ids), nil
+		}
+	case "externalid":
+		return name, members, nil
+	}
+
+	return name, members, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidPath", Detail: fmt.Sprintf("operation %s on %s is not supported", op.Op, op.Path)}
+}
+
+// decodeSCIMPatch parses and validates a patch request.
+func decodeSCIMPatch(r *http.Request) (*SCIMPatch, error) {
+	patch := &SCIMPatch{}
+
+	if err := json.NewDecoder(r.Body).Decode(patch); err != nil {
+		return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: err.Error()}
+	}
+
+	if !containsString(patch.Schemas, scimPatchSchema) {
+		return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: "missing patch schema"}
+	}
+
+	if len(patch.Operations) == 0 {
+		return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: "missing operations"}
+	}
+
+	return patch, nil
+}
+
+// parseSCIMFilter parses a filter like userName eq "bob", only equality
+// filters are supported. The attribute gets returned in lower case.
+func parseSCIMFilter(filter string) (string, string, error) {
+	if filter == "" {
+		return "", "", nil
+	}
+
+	match := scimFilterPattern.FindStringSubmatch(filter)
+
+	if match == nil {
+		return "", "", &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidFilter", Detail: "only filters like attribute eq \"value\" are supported"}
+	}
+
+	val, err := strconv.Unquote(`"` + match[2] + `"`)
+
+	if err != nil {
+		return "", "", &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidFilter", Detail: err.Error()}
+	}
+
+	return strings.ToLower(match[1]), val, nil
+}
+
+// paginateSCIM wraps the resources into a list response respecting the
+// startIndex and count parameters.
+func paginateSCIM(r *http.Request, resources []interface{}) (*SCIMList, error) {
+	start, count := 1, len(resources)
+
+	if val := r.URL.Query().Get("startIndex"); val != "" {
+		num, err := strconv.Atoi(val)
+
+		if err != nil {
+			return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "startIndex must be a number"}
+		}
+
+		if num > 1 {
+			start = num
+		}
+	}
+
+	if val := r.URL.Query().Get("count"); val != "" {
+		num, err := strconv.Atoi(val)
+
+		if err != nil {
+			return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "count must be a number"}
+		}
+
+		if num >= 0 {
+			count = num
+		}
+	}
+
+	page := make([]interface{}, 0)
+
+	if start <= len(resources) {
+		end := start - 1 + count
+
+		if end > len(resources) {
+			end = len(resources)
+		}
+
+		page = resources[start-1 : end]
+	}
+
+	return &SCIMList{
+		Schemas:      []string{scimListSchema},
+		TotalResults: len(resources),
+		StartIndex:   start,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}, nil
+}
+
+// primarySCIMValue returns the primary or the first value.
+func primarySCIMValue(values []SCIMValue) string {
+	for _, val := range values {
+		if val.Primary {
+			return val.Value
+		}
+	}
+
+	if len(values) > 0 {
+		return values[0].Value
+	}
+
+	return ""
+}
+
+// scimMemberIDs extracts the ids of the member references.
+func scimMemberIDs(members []SCIMMember) []string {
+	result := make([]string, 0, len(members))
+
+	for _, member := range members {
+		if member.Value != "" && !containsString(result, member.Value) {
+			result = append(result, member.Value)
+		}
+	}
+
+	return result
+}
+
+// scimBool parses a boolean, some providers send it as string.
+func scimBool(raw json.RawMessage) (bool, error) {
+	var val interface{}
+
+	if err := json.Unmarshal(raw, &val); err == nil {
+		switch v := val.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if parsed, err := strconv.ParseBool(strings.ToLower(v)); err == nil {
+				return parsed, nil
+			}
+		}
+	}
+
+	return false, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "expected a boolean value"}
+}
+
+// scimString parses a string value.
+func scimString(raw json.RawMessage) (string, error) {
+	var val string
+
+	if err := json.Unmarshal(raw, &val); err != nil {
+		return "", &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: "expected a string value"}
+	}
+
+	return val, nil
+}
+
+// removeStrings drops all values of the second list from the first one.
+func removeStrings(list, values []string) []string {
+	result := make([]string, 0, len(list))
+
+	for _, val := range list {
+		if !containsString(values, val) {
+			result = append(result, val)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,667 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSCIMAuthentication(t *testing.T) {
+	env := newSCIMTest(t)
+	defer env.Close()
+
+	for _, token := range []string{"", "invalid"} {
+		req, err := http.NewRequest(http.MethodGet, env.scim.URL+"/scim/v2/Users", nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := decodeSCIMBody(t, resp)
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected status 401 for token %q, got %d", token, resp.StatusCode)
+		}
+
+		if resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("expected authenticate header for token %q", token)
+		}
+
+		assertSCIMError(t, body, "401", "")
+	}
+
+	if requests := env.api.Requests(); len(requests) != 0 {
+		t.Errorf("expected no api requests without authentication, got %v", requests)
+	}
+}
+
+func TestSCIMUsers(t *testing.T) {
+	env := newSCIMTest(t)
+	defer env.Close()
+
+	status, body, header := env.Do(http.MethodPost, "/Users", map[string]interface{}{
+		"schemas":  []string{scimUserSchema},
+		"userName": "alice",
+		"emails":   []map[string]interface{}{{"value": "alice@example.com", "primary": true}},
+	})
+
+	if status != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %v", status, body)
+	}
+
+	id, _ := body["id"].(string)
+	location := env.scim.URL + "/scim/v2/Users/" + id
+
+	if id == "" || header.Get("Location") != location || scimPath(body, "meta", "location") != location {
+		t.Errorf("expected location %s, got header %q and body %v", location, header.Get("Location"), body["meta"])
+	}
+
+	if env.api.User("alice") == nil || stringValue(env.api.User("alice").Email, "") != "alice@example.com" {
+		t.Errorf("expected user alice to be created with email")
+	}
+
+	status, body, _ = env.Do(http.MethodPost, "/Users", map[string]interface{}{
+		"userName": "ALICE",
+		"emails":   []map[string]interface{}{{"value": "other@example.com"}},
+	})
+
+	if status != http.StatusConflict {
+		t.Errorf("expected status 409 for duplicate user, got %d", status)
+	}
+
+	assertSCIMError(t, body, "409", "uniqueness")
+
+	status, body, _ = env.Do(http.MethodPost, "/Users", map[string]interface{}{
+		"userName": "bob",
+	})
+
+	if status != http.StatusBadRequest {
+		t.Errorf("expected status 400 for missing email, got %d", status)
+	}
+
+	assertSCIMError(t, body, "400", "invalidValue")
+
+	status, body, _ = env.Do(http.MethodGet, "/Users/"+id, nil)
+
+	if status != http.StatusOK || body["userName"] != "alice" || body["active"] != true {
+		t.Errorf("expected active user alice, got %d: %v", status, body)
+	}
+
+	status, body, _ = env.Do(http.MethodPut, "/Users/"+id, map[string]interface{}{
+		"userName": "alice",
+		"emails":   []map[string]interface{}{{"value": "alice@example.org"}},
+	})
+
+	if status != http.StatusOK || stringValue(env.api.User(id).Email, "") != "alice@example.org" {
+		t.Errorf("expected email to be replaced, got %d: %v", status, body)
+	}
+
+	status, body, _ = env.Do(http.MethodPatch, "/Users/"+id, map[string]interface{}{
+		"schemas": []string{scimPatchSchema},
+		"Operations": []map[string]interface{}{
+			{"op": "replace", "path": "active", "value": "False"},
+			{"op": "replace", "value": map[string]interface{}{"emails[type eq \"work\"].value": "alice@example.net"}},
+		},
+	})
+
+	if status != http.StatusOK || body["active"] != false {
+		t.Errorf("expected user to be deactivated, got %d: %v", status, body)
+	}
+
+	if stringValue(env.api.User(id).Email, "") != "alice@example.net" {
+		t.Errorf("expected email to be patched, got %s", stringValue(env.api.User(id).Email, ""))
+	}
+
+	status, body, _ = env.Do(http.MethodPatch, "/Users/"+id, map[string]interface{}{
+		"schemas":    []string{scimPatchSchema},
+		"Operations": []map[string]interface{}{{"op": "remove", "path": "active"}},
+	})
+
+	if status != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unsupported operation, got %d", status)
+	}
+
+	assertSCIMError(t, body, "400", "mutability")
+
+	status, body, _ = env.Do(http.MethodPatch, "/Users/"+id, map[string]interface{}{
+		"Operations": []map[string]interface{}{{"op": "replace", "path": "active", "value": true}},
+	})
+
+	if status != http.StatusBadRequest {
+		t.Errorf("expected status 400 for missing patch schema, got %d", status)
+	}
+
+	assertSCIMError(t, body, "400", "invalidSyntax")
+
+	status, _, _ = env.Do(http.MethodDelete, "/Users/"+id, nil)
+
+	if status != http.StatusNoContent || env.api.User(id) != nil {
+		t.Errorf("expected user to be deleted, got %d", status)
+	}
+
+	status, body, _ = env.Do(http.MethodGet, "/Users/"+id, nil)
+
+	if status != http.StatusNotFound {
+		t.Errorf("expected status 404 for deleted user, got %d", status)
+	}
+
+	assertSCIMError(t, body, "404", "")
+
+	commands := env.Journal()
+	expected := []string{"user create", "user update", "user update", "user delete"}
+
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected journal %v, got %v", expected, commands)
+	}
+}
+
+func TestSCIMFilter(t *testing.T) {
+	env := newSCIMTest(t)
+	defer env.Close()
+
+	alice := env.api.AddUser("alice", false, true)
+	env.api.AddUser("bob", false, true)
+	env.api.AddTeam("ops")
+	env.api.AddTeam("dev")
+
+	for _, row := range []struct {
+		path  string
+		total float64
+	}{
+		{"/Users", 2},
+		{`/Users?filter=userName eq "ALICE"`, 1},
+		{`/Users?filter=emails.value eq "bob@example.com"`, 1},
+		{`/Users?filter=id eq "` + alice + `"`, 1},
+		{`/Users?filter=userName eq "nobody"`, 0},
+		{`/Groups?filter=displayName eq "ops"`, 1},
+		{"/Groups?startIndex=2&count=5", 2},
+	} {
+		status, body, _ := env.Do(http.MethodGet, strings.Replace(row.path, " ", "%20", -1), nil)
+
+		if status != http.StatusOK {
+			t.Errorf("expected status 200 for %s, got %d: %v", row.path, status, body)
+			continue
+		}
+
+		if body["totalResults"] != row.total {
+			t.Errorf("expected %v results for %s, got %v", row.total, row.path, body["totalResults"])
+		}
+	}
+
+	status, body, _ := env.Do(http.MethodGet, "/Groups?startIndex=2&count=5", nil)
+
+	if status != http.StatusOK || body["itemsPerPage"] != float64(1) || body["startIndex"] != float64(2) {
+		t.Errorf("expected second page with a single group, got %v", body)
+	}
+
+	for _, filter := range []string{
+		`userName co "ali"`,
+		`title eq "boss"`,
+	} {
+		status, body, _ := env.Do(http.MethodGet, "/Users?filter="+strings.Replace(filter, " ", "%20", -1), nil)
+
+		if status != http.StatusBadRequest {
+			t.Errorf("expected status 400 for filter %s, got %d", filter, status)
+		}
+
+		assertSCIMError(t, body, "400", "invalidFilter")
+	}
+}
+
+func TestSCIMGroups(t *testing.T) {
+	env := newSCIMTest(t)
+	defer env.Close()
+
+	alice := env.api.AddUser("alice", false, true)
+	bob := env.api.AddUser("bob", false, true)
+
+	status, body, header := env.Do(http.MethodPost, "/Groups", map[string]interface{}{
+		"schemas":     []string{scimGroupSchema},
+		"displayName": "Ops",
+		"members":     []map[string]interface{}{{"value": alice}},
+	})
+
+	if status != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %v", status, body)
+	}
+
+	id, _ := body["id"].(string)
+
+	if header.Get("Location") != env.scim.URL+"/scim/v2/Groups/"+id {
+		t.Errorf("expected location of the group, got %q", header.Get("Location"))
+	}
+
+	if env.api.Perm("alice", id) != "user" {
+		t.Errorf("expected alice to be assigned as user")
+	}
+
+	status, body, _ = env.Do(http.MethodPost, "/Groups", map[string]interface{}{
+		"displayName": "ops",
+	})
+
+	if status != http.StatusConflict {
+		t.Errorf("expected status 409 for duplicate group, got %d", status)
+	}
+
+	assertSCIMError(t, body, "409", "uniqueness")
+
+	status, body, _ = env.Do(http.MethodPatch, "/Groups/"+id, map[string]interface{}{
+		"schemas": []string{scimPatchSchema},
+		"Operations": []map[string]interface{}{
+			{"op": "add", "path": "members", "value": []map[string]interface{}{{"value": bob}}},
+			{"op": "replace", "path": "displayName", "value": "Operations"},
+		},
+	})
+
+	if status != http.StatusOK || body["displayName"] != "Operations" || len(scimMembers(body)) != 2 {
+		t.Errorf("expected renamed group with two members, got %d: %v", status, body)
+	}
+
+	status, body, _ = env.Do(http.MethodPatch, "/Groups/"+id, map[string]interface{}{
+		"schemas": []string{scimPatchSchema},
+		"Operations": []map[string]interface{}{
+			{"op": "remove", "path": `members[value eq "` + alice + `"]`},
+		},
+	})
+
+	if status != http.StatusOK || !reflect.DeepEqual(scimMembers(body), []string{bob}) {
+		t.Errorf("expected only bob to be left, got %d: %v", status, body)
+	}
+
+	status, body, _ = env.Do(http.MethodPatch, "/Groups/"+id, map[string]interface{}{
+		"schemas":    []string{scimPatchSchema},
+		"Operations": []map[string]interface{}{{"op": "remove", "path": "displayName"}},
+	})
+
+	if status != http.StatusBadRequest {
+		t.Errorf("expected status 400 for removing the name, got %d", status)
+	}
+
+	assertSCIMError(t, body, "400", "mutability")
+
+	status, body, _ = env.Do(http.MethodPut, "/Groups/"+id, map[string]interface{}{
+		"displayName": "Ops",
+		"members":     []map[string]interface{}{{"value": alice}},
+	})
+
+	if status != http.StatusOK || body["displayName"] != "Ops" || !reflect.DeepEqual(scimMembers(body), []string{alice}) {
+		t.Errorf("expected group to be replaced, got %d: %v", status, body)
+	}
+
+	status, _, _ = env.Do(http.MethodDelete, "/Groups/"+id, nil)
+
+	if status != http.StatusNoContent || env.api.Team(id) != nil {
+		t.Errorf("expected group to be deleted, got %d", status)
+	}
+
+	status, body, _ = env.Do(http.MethodDelete, "/Groups/"+id, nil)
+
+	if status != http.StatusNotFound {
+		t.Errorf("expected status 404 for deleted group, got %d", status)
+	}
+
+	assertSCIMError(t, body, "404", "")
+
+	commands := env.Journal()
+	expected := []string{"team create", "team update", "team update", "team update", "team delete"}
+
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected journal %v, got %v", expected, commands)
+	}
+}
+
+func TestSCIMGroupRollback(t *testing.T) {
+	env := newSCIMTest(t)
+	defer env.Close()
+
+	status, body, _ := env.Do(http.MethodPost, "/Groups", map[string]interface{}{
+		"displayName": "Ops",
+		"members":     []map[string]interface{}{{"value": "missing"}},
+	})
+
+	if status != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unknown member, got %d: %v", status, body)
+	}
+
+	assertSCIMError(t, body, "400", "invalidValue")
+
+	if env.api.Team("ops") != nil {
+		t.Errorf("expected created team to be removed again")
+	}
+}
+
+func TestSCIMLastOwner(t *testing.T) {
+	env := newSCIMTest(t)
+	defer env.Close()
+
+	alice := env.api.AddUser("alice", false, true)
+	bob := env.api.AddUser("bob", false, true)
+	ops := env.api.AddTeam("ops")
+
+	env.api.AddMember(alice, ops, "owner")
+	env.api.AddMember(bob, ops, "user")
+
+	status, body, _ := env.Do(http.MethodDelete, "/Users/"+alice, nil)
+
+	if status != http.StatusConflict || env.api.User(alice) == nil {
+		t.Errorf("expected deletion of the last owner to be refused, got %d", status)
+	}
+
+	assertSCIMError(t, body, "409", "mutability")
+
+	status, body, _ = env.Do(http.MethodPatch, "/Groups/"+ops, map[string]interface{}{
+		"schemas": []string{scimPatchSchema},
+		"Operations": []map[string]interface{}{
+			{"op": "remove", "path": `members[value eq "` + alice + `"]`},
+		},
+	})
+
+	if status != http.StatusConflict || env.api.Perm("alice", "ops") != "owner" {
+		t.Errorf("expected removal of the last owner to be refused, got %d", status)
+	}
+
+	assertSCIMError(t, body, "409", "mutability")
+
+	status, _, _ = env.Do(http.MethodDelete, "/Users/"+bob, nil)
+
+	if status != http.StatusNoContent {
+		t.Errorf("expected deletion of a regular member, got %d", status)
+	}
+
+	entries := env.Entries()
+
+	if len(entries) != 3 || entries[0].Outcome != "failure" || entries[2].Outcome != "success" {
+		t.Fatalf("expected failed and successful journal entries, got %v", entries)
+	}
+
+	if entries[2].Before == nil || entries[2].Before.User == nil || entries[2].Before.User.ID.String() != bob {
+		t.Errorf("expected state of bob before deletion within journal")
+	}
+
+	snapshots, err := readSnapshots()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snapshots) != 3 {
+		t.Errorf("expected a snapshot per mutation, got %d", len(snapshots))
+	}
+}
+
+func TestSCIMLocation(t *testing.T) {
+	env := newSCIMTest(t)
+	defer env.Close()
+
+	id := env.api.AddTeam("ops")
+
+	for _, row := range []struct {
+		external string
+		trust    bool
+		expected string
+	}{
+		{"", false, env.scim.URL + "/scim/v2/Groups/" + id},
+		{"", true, "https://scim.example.com/scim/v2/Groups/" + id},
+		{"https://idm.example.com/bridge", false, "https://idm.example.com/bridge/Groups/" + id},
+	} {
+		env.server.external = row.external
+		env.server.trustProxy = row.trust
+
+		req, err := http.NewRequest(http.MethodGet, env.scim.URL+"/scim/v2/Groups/"+id, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "scim.example.com")
+
+		resp, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if location := scimPath(decodeSCIMBody(t, resp), "meta", "location"); location != row.expected {
+			t.Errorf("expected location %s, got %s", row.expected, location)
+		}
+	}
+}
+
+// scimTest bundles the fake api and the scim server for the tests.
+type scimTest struct {
+	t       *testing.T
+	api     *fakeAPI
+	backend *httptest.Server
+	scim    *httptest.Server
+	server  *SCIMServer
+	dir     string
+	env     map[string]string
+}
+
+// newSCIMTest starts the fake api and the scim server, the journal and the
+// snapshots get written to a temporary directory.
+func newSCIMTest(t *testing.T) *scimTest {
+	dir, err := ioutil.TempDir("", "gomematic-scim")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &scimTest{
+		t:   t,
+		api: newFakeAPI(),
+		dir: dir,
+		env: make(map[string]string),
+	}
+
+	for _, name := range []string{"HOME", "XDG_CONFIG_HOME"} {
+		env.env[name] = os.Getenv(name)
+		os.Setenv(name, dir)
+	}
+
+	var client *Client
+	env.backend, client = testServer(t, env.api)
+
+	c := testContext(
+		t,
+		Serve().Subcommands[1].Flags,
+		"--server", env.backend.URL,
+		"--audit-log", filepath.Join(dir, "audit.jsonl"),
+	)
+
+	env.server = &SCIMServer{
+		c:           c,
+		client:      client,
+		token:       "secret",
+		base:        "/scim/v2",
+		policy:      DefaultPasswordPolicy(),
+		concurrency: 2,
+	}
+
+	env.scim = httptest.NewServer(env.server)
+	return env
+}
+
+// Close stops the servers and removes the temporary directory.
+func (e *scimTest) Close() {
+	e.scim.Close()
+	e.backend.Close()
+
+	for name, val := range e.env {
+		os.Setenv(name, val)
+	}
+
+	os.RemoveAll(e.dir)
+}
+
+// Do sends an authenticated request to the scim server.
+func (e *scimTest) Do(method, path string, payload interface{}) (int, map[string]interface{}, http.Header) {
+	body := &bytes.Buffer{}
+
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			e.t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, e.scim.URL+"/scim/v2"+path, body)
+
+	if err != nil {
+		e.t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Content-Type", scimContentType)
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		e.t.Fatal(err)
+	}
+
+	return resp.StatusCode, decodeSCIMBody(e.t, resp), resp.Header
+}
+
+// Entries reads all entries of the audit journal.
+func (e *scimTest) Entries() []*AuditEntry {
+	file, err := os.Open(filepath.Join(e.dir, "audit.jsonl"))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		e.t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	result := make([]*AuditEntry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		entry := &AuditEntry{}
+
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			e.t.Fatal(err)
+		}
+
+		result = append(result, entry)
+	}
+
+	return result
+}
+
+// Journal returns the commands of the audit journal entries.
+func (e *scimTest) Journal() []string {
+	result := make([]string, 0)
+
+	for _, entry := range e.Entries() {
+		result = append(result, strings.Join(entry.Command, " "))
+	}
+
+	return result
+}
+
+// decodeSCIMBody decodes the json response, empty responses result in nil.
+func decodeSCIMBody(t *testing.T, resp *http.Response) map[string]interface{} {
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(content) == 0 {
+		return nil
+	}
+
+	if val := resp.Header.Get("Content-Type"); val != scimContentType {
+		t.Errorf("expected content type %s, got %s", scimContentType, val)
+	}
+
+	result := make(map[string]interface{})
+
+	if err := json.Unmarshal(content, &result); err != nil {
+		t.Fatalf("failed to decode %s: %s", content, err)
+	}
+
+	return result
+}
+
+// assertSCIMError checks the error response for the error schema.
+func assertSCIMError(t *testing.T, body map[string]interface{}, status, scimType string) {
+	t.Helper()
+
+	schemas, _ := body["schemas"].([]interface{})
+
+	if len(schemas) != 1 || schemas[0] != scimErrorSchema {
+		t.Errorf("expected error schema, got %v", body["schemas"])
+	}
+
+	if body["status"] != status {
+		t.Errorf("expected status %q within error, got %v", status, body["status"])
+	}
+
+	if scimType != "" && body["scimType"] != scimType {
+		t.Errorf("expected scim type %s, got %v", scimType, body["scimType"])
+	}
+
+	if detail, _ := body["detail"].(string); detail == "" {
+		t.Errorf("expected error detail, got %v", body)
+	}
+}
+
+// scimPath returns a nested string attribute of the response.
+func scimPath(body map[string]interface{}, keys ...string) string {
+	var current interface{} = body
+
+	for _, key := range keys {
+		val, ok := current.(map[string]interface{})
+
+		if !ok {
+			return ""
+		}
+
+		current = val[key]
+	}
+
+	result, _ := current.(string)
+	return result
+}
+
+// scimMembers returns the member ids of a group response.
+func scimMembers(body map[string]interface{}) []string {
+	result := make([]string, 0)
+	members, _ := body["members"].([]interface{})
+
+	for _, member := range members {
+		if val, ok := member.(map[string]interface{}); ok {
+			result = append(result, val["value"].(string))
+		}
+	}
+
+	return result
+}
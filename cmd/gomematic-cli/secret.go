@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// secretRedacted replaces secret values within logs and output.
+const secretRedacted = "[REDACTED]"
+
+// secretFlags defines the flags which accept secret references and whose
+// values never get written to logs.
+var secretFlags = map[string]bool{
+	"password":     true,
+	"token":        true,
+	"bearer-token": true,
+}
+
+var (
+	// resolvedSecrets stores all resolved secret values for redaction.
+	resolvedSecrets = make([]string, 0)
+
+	// secretStdin stores the flag which already consumed stdin.
+	secretStdin = ""
+)
+
+// ResolveSecrets replaces secret references of the given flags by their
+// values. References can be env:VAR, file:/path, exec:command or - to read
+// from stdin, literal:value escapes values which look like a reference and
+// all other values are used literally. Commands are only executed if the
+// reference has been defined by the command line or the config file.
+func ResolveSecrets(c *cli.Context, names ...string) error {
+	for _, name := range names {
+		if !c.IsSet(name) {
+			continue
+		}
+
+		ref := c.String(name)
+
+		if ref == "-" {
+			if secretStdin != "" {
+				return fmt.Errorf("only one secret can be read from stdin, %s and %s both use it", secretStdin, name)
+			}
+
+			secretStdin = name
+		}
+
+		if strings.HasPrefix(ref, "exec:") && secretFromEnv(c, name, ref) {
+			return fmt.Errorf("failed to resolve %s: exec references are not allowed within environment variables", name)
+		}
+
+		val, err := resolveSecret(ref)
+
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %s", name, err)
+		}
+
+		if len(val) >= 4 {
+			resolvedSecrets = append(resolvedSecrets, val)
+		}
+
+		if val == ref {
+			continue
+		}
+
+		if val == "" {
+			return fmt.Errorf("%s resolved to an empty value", name)
+		}
+
+		if err := c.Set(name, val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Redact replaces all resolved secret values within the string, very short
+// values are skipped as they would garble the whole output.
+func Redact(val string) string {
+	for _, secret := range resolvedSecrets {
+		val = strings.Replace(val, secret, secretRedacted, -1)
+	}
+
+	return val
+}
+
+// resolveSecret resolves a single secret reference.
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case ref == "-":
+		content, err := ioutil.ReadAll(os.Stdin)
+
+		if err != nil {
+			return "", fmt.Errorf("failed to read stdin: %s", err)
+		}
+
+		return trimSecret(content), nil
+	case strings.HasPrefix(ref, "literal:"):
+		return strings.TrimPrefix(ref, "literal:"), nil
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		val, ok := os.LookupEnv(name)
+
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		return trimSecret([]byte(val)), nil
+	case strings.HasPrefix(ref, "file:"):
+		name := strings.TrimPrefix(ref, "file:")
+		stat, err := os.Stat(name)
+
+		if err != nil {
+			return "", err
+		}
+
+		if stat.Mode().Perm()&0077 != 0 {
+			logger.Warnf("secret file %s is accessible by other users (mode %#o)", name, stat.Mode().Perm())
+		}
+
+		content, err := ioutil.ReadFile(name)
+
+		if err != nil {
+			return "", err
+		}
+
+		return trimSecret(content), nil
+	case strings.HasPrefix(ref, "exec:"):
+		words, err := splitCommandLine(strings.TrimPrefix(ref, "exec:"))
+
+		if err != nil {
+			return "", err
+		}
+
+		if len(words) == 0 {
+			return "", fmt.Errorf("missing command to execute")
+		}
+
+		var stdout bytes.Buffer
+
+		cmd := exec.Command(words[0], words[1:]...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("command %s failed: %s", words[0], err)
+		}
+
+		return trimSecret(stdout.Bytes()), nil
+	default:
+		return ref, nil
+	}
+}
+
+// secretFromEnv checks if the value of the flag has been taken from one of
+// its environment variables instead of the command line.
+func secretFromEnv(c *cli.Context, name, ref string) bool {
+	for _, ctx := range c.Lineage() {
+		flags := ctx.App.Flags
+
+		if ctx.Command != nil {
+			flags = append(ctx.Command.Flags, flags...)
+		}
+
+		for _, flag := range flags {
+			val, ok := flag.(*cli.StringFlag)
+
+			if !ok {
+				continue
+			}
+
+			names := append(strings.Split(val.Name, ", "), val.Aliases...)
+
+			if names[0] != name {
+				continue
+			}
+
+			if flagInArgs(c, names) {
+				return false
+			}
+
+			for _, env := range val.EnvVars {
+				if os.Getenv(env) == ref {
+					return true
+				}
+			}
+
+			return false
+		}
+	}
+
+	return false
+}
+
+// flagInArgs checks if one of the flag names has been passed as argument.
+func flagInArgs(c *cli.Context, names []string) bool {
+	args, ok := c.App.Metadata["args"].([]string)
+
+	if !ok {
+		args = os.Args
+	}
+
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		arg = strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+
+		if containsString(names, arg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trimSecret drops trailing newlines added by files or commands.
+func trimSecret(content []byte) string {
+	return strings.TrimRight(string(content), "\r\n")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"gopkg.in/urfave/cli.v2"
+)
+
+// Serve provides the sub-command for long running servers.
+func Serve() *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "server commands",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "metrics",
+				Usage:     "expose access metrics for prometheus",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Value: ":9112",
+						Usage: "address to listen on",
+					},
+					&cli.DurationFlag{
+						Name:  "interval",
+						Value: time.Minute,
+						Usage: "interval between scrapes of the api",
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Value: 8,
+						Usage: "number of parallel requests",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return Handle(c, ServeMetrics)
+				},
+			},
+			{
+				Name:      "scim",
+				Usage:     "provision users and teams via scim 2.0",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Value: ":9113",
+						Usage: "address to listen on",
+					},
+					&cli.StringFlag{
+						Name:  "base-path",
+						Value: "/scim/v2",
+						Usage: "path prefix of the scim endpoints",
+					},
+					&cli.StringFlag{
+						Name:  "external-url",
+						Value: "",
+						Usage: "external url of the scim endpoints used for resource locations",
+					},
+					&cli.BoolFlag{
+						Name:  "trust-proxy",
+						Usage: "use forwarded headers of a reverse proxy for resource locations",
+					},
+					&cli.StringFlag{
+						Name:    "bearer-token",
+						Value:   "",
+						Usage:   "token required from scim clients, accepts env:, file:, exec:, literal: or -",
+						EnvVars: []string{"GOMEMATIC_SCIM_TOKEN"},
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Value: 8,
+						Usage: "number of parallel requests",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return Handle(c, ServeSCIM)
+				},
+			},
+		},
+	}
+}
+
+// listenAndServe runs the http server until the context is done and shuts
+// it down gracefully afterwards.
+func listenAndServe(ctx context.Context, addr string, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	listener, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	logger.Infof("listening on %s", listener.Addr())
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return server.Shutdown(shutdown)
+}
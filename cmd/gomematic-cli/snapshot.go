@@ -0,0 +1,701 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/gomematic/gomematic-go/gomematic/team"
+	"github.com/gomematic/gomematic-go/gomematic/user"
+	"github.com/gomematic/gomematic-go/models"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// tmplSnapshotList represents a row within snapshot listing.
+var tmplSnapshotList = "ID: \x1b[33m{{ .ID }} \x1b[0m" + `
+Time: {{ .Time.Format "2006-01-02 15:04:05 MST" }}
+Server: {{ .Server }}{{ with .Context }} ({{ . }}){{ end }}
+Command: {{ join " " .Command }}
+Record: {{ .Kind }} {{ .Subject }}{{ with .Restored }}
+Restored: {{ .Format "2006-01-02 15:04:05 MST" }}{{ end }}
+`
+
+// Snapshot represents the state of a record before it got modified.
+type Snapshot struct {
+	ID       string         `json:"id"`
+	Time     time.Time      `json:"time"`
+	Server   string         `json:"server"`
+	Context  string         `json:"context,omitempty"`
+	Command  []string       `json:"command"`
+	State    *AuditSnapshot `json:"state"`
+	Restored *time.Time     `json:"restored,omitempty"`
+}
+
+// Kind returns the type of the record within the snapshot.
+func (s *Snapshot) Kind() string {
+	switch {
+	case s.State.User != nil:
+		return "user"
+	case s.State.Team != nil:
+		return "team"
+	default:
+		return "unknown"
+	}
+}
+
+// Subject returns the slug of the record within the snapshot.
+func (s *Snapshot) Subject() string {
+	switch {
+	case s.State.User != nil && s.State.User.Slug != nil:
+		return *s.State.User.Slug
+	case s.State.Team != nil && s.State.Team.Slug != nil:
+		return *s.State.Team.Slug
+	default:
+		return ""
+	}
+}
+
+// Snapshots provides the sub-commands to list and restore snapshots.
+func Snapshots() []*cli.Command {
+	restoreFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "password",
+			Usage: "new password, required to recreate a deleted user, accepts secret references",
+		},
+		&cli.BoolFlag{
+			Name:  "keep-extra",
+			Usage: "keep memberships which had been added after the snapshot",
+		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "restore even if the snapshot belongs to another server",
+		},
+	}
+
+	return []*cli.Command{
+		{
+			Name:  "snapshot",
+			Usage: "snapshot commands",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "list",
+					Aliases:   []string{"ls"},
+					Usage:     "list all local snapshots",
+					ArgsUsage: " ",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:   "format",
+							Value:  tmplSnapshotList,
+							Usage:  "custom output format",
+							Hidden: true,
+						},
+					},
+					Action: SnapshotList,
+				},
+				{
+					Name:      "prune",
+					Usage:     "remove snapshots older than the retention",
+					ArgsUsage: " ",
+					Action:    SnapshotPrune,
+				},
+			},
+		},
+		{
+			Name:      "restore",
+			Usage:     "restore a user or team from a snapshot",
+			ArgsUsage: "<snapshot-id>",
+			Flags:     restoreFlags,
+			Action: func(c *cli.Context) error {
+				return Handle(c, SnapshotRestore)
+			},
+		},
+		{
+			Name:      "undo",
+			Usage:     "restore the latest snapshot of the current server",
+			ArgsUsage: " ",
+			Flags:     restoreFlags,
+			Action: func(c *cli.Context) error {
+				return Handle(c, SnapshotUndo)
+			},
+		},
+	}
+}
+
+// SnapshotList provides the sub-command to list all snapshots.
+func SnapshotList(c *cli.Context) error {
+	records, err := readSnapshots()
+
+	if err != nil {
+		logger.Errorf("failed to read snapshots: %s", err)
+		os.Exit(2)
+	}
+
+	if len(records) == 0 {
+		logger.Info("empty result")
+		return nil
+	}
+
+	tmpl, err := template.New(
+		"_",
+	).Funcs(
+		globalFuncMap,
+	).Funcs(
+		sprigFuncMap,
+	).Parse(
+		fmt.Sprintln(c.String("format")),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if err := tmpl.Execute(os.Stdout, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SnapshotPrune provides the sub-command to apply the retention policy.
+func SnapshotPrune(c *cli.Context) error {
+	removed, err := pruneSnapshots(c.Duration("snapshot-retention"))
+
+	if err != nil {
+		logger.Errorf("failed to prune snapshots: %s", err)
+		os.Exit(2)
+	}
+
+	logger.Infof("removed %d snapshots", removed)
+	return nil
+}
+
+// SnapshotRestore provides the sub-command to restore a snapshot by id.
+func SnapshotRestore(ctx context.Context, c *cli.Context, client *Client) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("you must provide exactly one snapshot id")
+	}
+
+	record, err := readSnapshot(c.Args().First())
+
+	if err != nil {
+		return err
+	}
+
+	if err := restoreSnapshot(ctx, c, client, record); err != nil {
+		return err
+	}
+
+	consumeSnapshot(record)
+	return nil
+}
+
+// SnapshotUndo provides the sub-command to restore the latest snapshot.
+func SnapshotUndo(ctx context.Context, c *cli.Context, client *Client) error {
+	records, err := readSnapshots()
+
+	if err != nil {
+		return fmt.Errorf("failed to read snapshots: %s", err)
+	}
+
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Server != c.String("server") || records[i].Restored != nil {
+			continue
+		}
+
+		logger.Infof("restoring snapshot %s of %s", records[i].ID, strings.Join(records[i].Command, " "))
+
+		if err := restoreSnapshot(ctx, c, client, records[i]); err != nil {
+			return err
+		}
+
+		consumeSnapshot(records[i])
+		return nil
+	}
+
+	return fmt.Errorf("no snapshot available for %s", c.String("server"))
+}
+
+// consumeSnapshot marks the snapshot as restored, undo skips restored
+// snapshots while restore by id is still possible.
+func consumeSnapshot(record *Snapshot) {
+	now := time.Now().UTC()
+	record.Restored = &now
+
+	if err := writeSnapshot(record); err != nil {
+		logger.Warnf("failed to mark snapshot as restored: %s", err)
+	}
+}
+
+// restoreSnapshot recreates or updates the record and reconciles all
+// memberships to match the snapshot.
+func restoreSnapshot(ctx context.Context, c *cli.Context, client *Client, snapshot *Snapshot) error {
+	if snapshot.Server != c.String("server") && !c.Bool("force") {
+		return fmt.Errorf("snapshot belongs to %s, use --force to restore it anyway", snapshot.Server)
+	}
+
+	var (
+		plan  []*membershipChange
+		apply func(*membershipChange) (string, error)
+	)
+
+	switch snapshot.Kind() {
+	case "user":
+		userID, err := restoreUser(ctx, c, client, snapshot.State.User)
+
+		if err != nil {
+			return err
+		}
+
+		current, err := userTeams(ctx, client, userID)
+
+		if err != nil {
+			return err
+		}
+
+		plan = planUserTeamSync(current, snapshotMembers(snapshot), c.Bool("keep-extra"))
+		apply = func(change *membershipChange) (string, error) {
+			switch change.Action {
+			case "append":
+				return userTeamAppend(ctx, client, userID, change.Target, change.To)
+			case "perm":
+				return userTeamPerm(ctx, client, userID, change.Target, change.To)
+			default:
+				return userTeamRemove(ctx, client, userID, change.Target)
+			}
+		}
+	case "team":
+		teamID, err := restoreTeam(ctx, client, snapshot.State.Team)
+
+		if err != nil {
+			return err
+		}
+
+		current, err := teamUsers(ctx, client, teamID)
+
+		if err != nil {
+			return err
+		}
+
+		plan = planTeamUserSync(current, snapshotMembers(snapshot), c.Bool("keep-extra"))
+		apply = func(change *membershipChange) (string, error) {
+			switch change.Action {
+			case "append":
+				return teamUserAppend(ctx, client, teamID, change.Target, change.To)
+			case "perm":
+				return teamUserPerm(ctx, client, teamID, change.Target, change.To)
+			default:
+				return teamUserRemove(ctx, client, teamID, change.Target)
+			}
+		}
+	default:
+		return fmt.Errorf("snapshot %s does not contain a user or team", snapshot.ID)
+	}
+
+	failed := 0
+
+	for i, change := range plan {
+		if ctx.Err() != nil {
+			return fmt.Errorf("interrupted after %d of %d changes", i, len(plan))
+		}
+
+		if _, err := apply(change); err != nil {
+			logger.Errorf("failed to %s: %s", change, err)
+			failed++
+
+			continue
+		}
+
+		fmt.Fprintln(os.Stdout, change)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("restored %s %s, but %d of %d membership changes failed", snapshot.Kind(), snapshot.Subject(), failed, len(plan))
+	}
+
+	logger.Infof("successfully restored %s %s", snapshot.Kind(), snapshot.Subject())
+	return nil
+}
+
+// restoreUser recreates a deleted user or resets the fields of an existing
+// one, it returns the slug to manage the memberships.
+func restoreUser(ctx context.Context, c *cli.Context, client *Client, snapshot *models.User) (string, error) {
+	slug := stringValue(snapshot.Slug, snapshot.ID.String())
+	record, err := existingUser(ctx, client, slug)
+
+	if err != nil {
+		return "", err
+	}
+
+	if record == nil {
+		val, _, err := resolvePassword(c, stringValue(snapshot.Username, ""), stringValue(snapshot.Email, ""))
+
+		if err != nil {
+			return "", err
+		}
+
+		if val == "" {
+			return "", fmt.Errorf("user %s does not exist anymore, you must provide a new password", slug)
+		}
+
+		password := strfmt.Password(val)
+
+		created, err := userCreate(ctx, client, &models.User{
+			Slug:     snapshot.Slug,
+			Username: snapshot.Username,
+			Email:    snapshot.Email,
+			Active:   snapshot.Active,
+			Admin:    snapshot.Admin,
+			Password: &password,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		slug = stringValue(created.Slug, created.ID.String())
+
+		logger.Infof("recreated user %s", slug)
+		return slug, nil
+	}
+
+	record.Slug = snapshot.Slug
+	record.Username = snapshot.Username
+	record.Email = snapshot.Email
+	record.Active = snapshot.Active
+	record.Admin = snapshot.Admin
+
+	val, _, err := resolvePassword(c, stringValue(snapshot.Username, ""), stringValue(snapshot.Email, ""))
+
+	if err != nil {
+		return "", err
+	}
+
+	if val != "" {
+		password := strfmt.Password(val)
+		record.Password = &password
+	}
+
+	if err := userUpdate(ctx, client, record); err != nil {
+		return "", err
+	}
+
+	return stringValue(record.Slug, record.ID.String()), nil
+}
+
+// restoreTeam recreates a deleted team or resets the fields of an existing
+// one, it returns the slug to manage the memberships.
+func restoreTeam(ctx context.Context, client *Client, snapshot *models.Team) (string, error) {
+	record, err := existingTeam(ctx, client, stringValue(snapshot.Slug, snapshot.ID.String()))
+
+	if err != nil {
+		return "", err
+	}
+
+	if record == nil {
+		created, err := teamCreate(ctx, client, &models.Team{
+			Slug: snapshot.Slug,
+			Name: snapshot.Name,
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		slug := stringValue(created.Slug, created.ID.String())
+
+		logger.Infof("recreated team %s", slug)
+		return slug, nil
+	}
+
+	record.Slug = snapshot.Slug
+	record.Name = snapshot.Name
+
+	if err := teamUpdate(ctx, client, record); err != nil {
+		return "", err
+	}
+
+	return stringValue(record.Slug, record.ID.String()), nil
+}
+
+// existingUser fetches the user to restore, only a deleted user results in
+// neither a record nor an error.
+func existingUser(ctx context.Context, client *Client, id string) (*models.User, error) {
+	resp, err := client.User.ShowUser(
+		user.NewShowUserParams().WithContext(ctx).WithUserID(id),
+		client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *user.ShowUserNotFound:
+			return nil, nil
+		case *user.ShowUserForbidden:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *user.ShowUserDefault:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		default:
+			return nil, PrettyError(err)
+		}
+	}
+
+	return resp.Payload, nil
+}
+
+// existingTeam fetches the team to restore, only a deleted team results in
+// neither a record nor an error.
+func existingTeam(ctx context.Context, client *Client, id string) (*models.Team, error) {
+	resp, err := client.Team.ShowTeam(
+		team.NewShowTeamParams().WithContext(ctx).WithTeamID(id),
+		client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *team.ShowTeamNotFound:
+			return nil, nil
+		case *team.ShowTeamForbidden:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *team.ShowTeamDefault:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		default:
+			return nil, PrettyError(err)
+		}
+	}
+
+	return resp.Payload, nil
+}
+
+// snapshotMembers converts the memberships of the snapshot to desired
+// assignments, preferring slugs as ids change if records get recreated.
+func snapshotMembers(snapshot *Snapshot) [][2]string {
+	result := make([][2]string, 0, len(snapshot.State.Members))
+
+	for _, member := range snapshot.State.Members {
+		if member.Perm == nil {
+			continue
+		}
+
+		var (
+			id   strfmt.UUID
+			slug *string
+		)
+
+		switch {
+		case snapshot.State.User != nil && member.Team != nil:
+			id, slug = member.Team.ID, member.Team.Slug
+		case snapshot.State.Team != nil && member.User != nil:
+			id, slug = member.User.ID, member.User.Slug
+		default:
+			continue
+		}
+
+		if slug != nil {
+			result = append(result, [2]string{*slug, *member.Perm})
+		} else {
+			result = append(result, [2]string{id.String(), *member.Perm})
+		}
+	}
+
+	return result
+}
+
+// snapshotDir returns the directory used to store snapshots.
+func snapshotDir() string {
+	return filepath.Join(configDir(), "snapshots")
+}
+
+// saveSnapshot stores the state recorded before a mutating command and
+// applies the retention policy afterwards.
+func saveSnapshot(c *cli.Context, entry *AuditEntry) {
+	if entry == nil {
+		return
+	}
+
+	states := append([]*AuditSnapshot{entry.Before}, entry.Batch...)
+	written := 0
+
+	for i, state := range states {
+		if state == nil || (state.User == nil && state.Team == nil) {
+			continue
+		}
+
+		record := &Snapshot{
+			ID:      entry.ID,
+			Time:    entry.Time,
+			Server:  entry.Server,
+			Context: entry.Context,
+			Command: entry.Command,
+			State:   state,
+		}
+
+		if i > 0 {
+			record.ID = fmt.Sprintf("%s-%d", entry.ID, i)
+		}
+
+		if err := writeSnapshot(record); err != nil {
+			logger.Warnf("failed to write snapshot: %s", err)
+			return
+		}
+
+		written++
+	}
+
+	if written == 0 {
+		return
+	}
+
+	if _, err := pruneSnapshots(c.Duration("snapshot-retention")); err != nil {
+		logger.Warnf("failed to prune snapshots: %s", err)
+	}
+}
+
+// writeSnapshot stores a single snapshot as json file.
+func writeSnapshot(record *Snapshot) error {
+	if err := os.MkdirAll(snapshotDir(), 0700); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(record, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(
+		filepath.Join(snapshotDir(), record.ID+".json"),
+		content,
+		0600,
+	)
+}
+
+// readSnapshot loads a single snapshot by its id.
+func readSnapshot(id string) (*Snapshot, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, fmt.Errorf("invalid snapshot id %q", id)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(snapshotDir(), id+".json"))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("snapshot %s does not exist", id)
+		}
+
+		return nil, err
+	}
+
+	record := &Snapshot{}
+
+	if err := json.Unmarshal(content, record); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %s", id, err)
+	}
+
+	if record.State == nil {
+		return nil, fmt.Errorf("snapshot %s is empty", id)
+	}
+
+	return record, nil
+}
+
+// readSnapshots loads all snapshots sorted by time, a missing directory is
+// not an error.
+func readSnapshots() ([]*Snapshot, error) {
+	files, err := ioutil.ReadDir(snapshotDir())
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	result := make([]*Snapshot, 0, len(files))
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		record, err := readSnapshot(strings.TrimSuffix(file.Name(), ".json"))
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, record)
+	}
+
+	// items of a batch share the time, they are ordered by the index which
+	// gets appended to the id of the audit entry.
+	sort.SliceStable(result, func(i, j int) bool {
+		if !result[i].Time.Equal(result[j].Time) {
+			return result[i].Time.Before(result[j].Time)
+		}
+
+		if len(result[i].ID) != len(result[j].ID) {
+			return len(result[i].ID) < len(result[j].ID)
+		}
+
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+// pruneSnapshots removes all snapshots older than the retention, a zero
+// retention keeps snapshots forever.
+func pruneSnapshots(retention time.Duration) (int, error) {
+	if retention <= 0 {
+		return 0, nil
+	}
+
+	files, err := ioutil.ReadDir(snapshotDir())
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	removed := 0
+	threshold := time.Now().Add(-retention)
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		// restoring rewrites the file, so the age is taken from the recorded
+		// time, broken snapshots fall back to the modification time.
+		created := file.ModTime()
+
+		if record, err := readSnapshot(strings.TrimSuffix(file.Name(), ".json")); err == nil {
+			created = record.Time
+		}
+
+		if created.After(threshold) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(snapshotDir(), file.Name())); err != nil {
+			return removed, err
+		}
+
+		removed++
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gomematic/gomematic-go/models"
+)
+
+func TestSnapshotOrder(t *testing.T) {
+	_, cleanup := testConfigDir(t)
+	defer cleanup()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	slug := "ops"
+
+	for _, record := range []*Snapshot{
+		{ID: "b-10", Time: now},
+		{ID: "b-2", Time: now},
+		{ID: "b", Time: now},
+		{ID: "a", Time: now.Add(-time.Minute)},
+		{ID: "c", Time: now.Add(time.Minute)},
+	} {
+		record.State = &AuditSnapshot{Team: &models.Team{Slug: &slug}}
+
+		if err := writeSnapshot(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := readSnapshots()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a", "b", "b-2", "b-10", "c"}
+
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d snapshots, got %d", len(expected), len(records))
+	}
+
+	for i, id := range expected {
+		if records[i].ID != id {
+			t.Errorf("expected snapshot %d to be %s, got %s", i, id, records[i].ID)
+		}
+	}
+}
+
+func TestSnapshotPrune(t *testing.T) {
+	_, cleanup := testConfigDir(t)
+	defer cleanup()
+
+	slug := "ops"
+	now := time.Now().UTC()
+
+	for _, record := range []*Snapshot{
+		{ID: "old", Time: now.Add(-48 * time.Hour)},
+		{ID: "new", Time: now.Add(-time.Hour)},
+	} {
+		record.State = &AuditSnapshot{Team: &models.Team{Slug: &slug}}
+
+		if err := writeSnapshot(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old, err := readSnapshot("old")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// restoring rewrites the file and must not reset the retention.
+	consumeSnapshot(old)
+
+	removed, err := pruneSnapshots(24 * time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if removed != 1 {
+		t.Errorf("expected 1 removed snapshot, got %d", removed)
+	}
+
+	if _, err := os.Stat(filepath.Join(snapshotDir(), "old.json")); !os.IsNotExist(err) {
+		t.Errorf("expected old snapshot to be removed")
+	}
+
+	if _, err := readSnapshot("new"); err != nil {
+		t.Errorf("expected new snapshot to be kept, got %s", err)
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"text/template"
+	"time"
 
 	"github.com/go-openapi/strfmt"
 	"github.com/gomematic/gomematic-go/gomematic/team"
@@ -50,6 +52,15 @@ func Team() *cli.Command {
 				Usage:     "list all teams",
 				ArgsUsage: " ",
 				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "watch",
+						Usage: "refresh periodically and highlight changes",
+					},
+					&cli.DurationFlag{
+						Name:  "interval",
+						Value: 5 * time.Second,
+						Usage: "interval between refreshes while watching",
+					},
 					&cli.StringFlag{
 						Name:   "format",
 						Value:  tmplTeamList,
@@ -64,12 +75,20 @@ func Team() *cli.Command {
 			{
 				Name:      "show",
 				Usage:     "show a team",
-				ArgsUsage: " ",
+				ArgsUsage: "[<id>...]",
 				Flags: []cli.Flag{
-					&cli.StringFlag{
+					&cli.StringSliceFlag{
 						Name:  "id, i",
-						Value: "",
-						Usage: "team id or slug",
+						Usage: "team id or slug, can be repeated or - for stdin",
+					},
+					&cli.BoolFlag{
+						Name:  "watch",
+						Usage: "refresh periodically and highlight changes",
+					},
+					&cli.DurationFlag{
+						Name:  "interval",
+						Value: 5 * time.Second,
+						Usage: "interval between refreshes while watching",
 					},
 					&cli.StringFlag{
 						Name:   "format",
@@ -86,12 +105,11 @@ func Team() *cli.Command {
 				Name:      "delete",
 				Aliases:   []string{"rm"},
 				Usage:     "delete a team",
-				ArgsUsage: " ",
+				ArgsUsage: "[<id>...]",
 				Flags: []cli.Flag{
-					&cli.StringFlag{
+					&cli.StringSliceFlag{
 						Name:  "id, i",
-						Value: "",
-						Usage: "team id or slug",
+						Usage: "team id or slug, can be repeated or - for stdin",
 					},
 				},
 				Action: func(c *cli.Context) error {
@@ -143,6 +161,68 @@ func Team() *cli.Command {
 					return Handle(c, TeamCreate)
 				},
 			},
+			{
+				Name:      "clone",
+				Usage:     "clone a team including its users",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "id, i",
+						Value: "",
+						Usage: "team id or slug to clone",
+					},
+					&cli.StringFlag{
+						Name:  "slug",
+						Value: "",
+						Usage: "provide a slug",
+					},
+					&cli.StringFlag{
+						Name:  "name",
+						Value: "",
+						Usage: "provide a name",
+					},
+					&cli.StringSliceFlag{
+						Name:  "exclude",
+						Usage: "user id or slug to exclude",
+					},
+					&cli.BoolFlag{
+						Name:  "downgrade-owners",
+						Usage: "copy owners as admins",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return Handle(c, TeamClone)
+				},
+			},
+			{
+				Name:      "transfer",
+				Usage:     "transfer the ownership of a team",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "id, i",
+						Value: "",
+						Usage: "team id or slug",
+					},
+					&cli.StringFlag{
+						Name:  "to",
+						Value: "",
+						Usage: "user id or slug of the new owner",
+					},
+					&cli.StringFlag{
+						Name:  "demote-to",
+						Value: "admin",
+						Usage: "new permission of previous owners, can be admin, user or remove",
+					},
+					&cli.BoolFlag{
+						Name:  "append",
+						Usage: "append the new owner if not a member yet",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return Handle(c, TeamTransfer)
+				},
+			},
 			{
 				Name:  "user",
 				Usage: "user assignments",
@@ -151,12 +231,20 @@ func Team() *cli.Command {
 						Name:      "list",
 						Aliases:   []string{"ls"},
 						Usage:     "list assigned users for a team",
-						ArgsUsage: " ",
+						ArgsUsage: "[<id>...]",
 						Flags: []cli.Flag{
-							&cli.StringFlag{
+							&cli.StringSliceFlag{
 								Name:  "id, i",
-								Value: "",
-								Usage: "team id or slug",
+								Usage: "team id or slug, can be repeated or - for stdin",
+							},
+							&cli.BoolFlag{
+								Name:  "watch",
+								Usage: "refresh periodically and highlight changes",
+							},
+							&cli.DurationFlag{
+								Name:  "interval",
+								Value: 5 * time.Second,
+								Usage: "interval between refreshes while watching",
 							},
 							&cli.StringFlag{
 								Name:   "format",
@@ -172,12 +260,11 @@ func Team() *cli.Command {
 					{
 						Name:      "append",
 						Usage:     "append a user to team",
-						ArgsUsage: " ",
+						ArgsUsage: "[<id>...]",
 						Flags: []cli.Flag{
-							&cli.StringFlag{
+							&cli.StringSliceFlag{
 								Name:  "id, i",
-								Value: "",
-								Usage: "team id or slug",
+								Usage: "team id or slug, can be repeated or - for stdin",
 							},
 							&cli.StringFlag{
 								Name:  "user, u",
@@ -197,12 +284,11 @@ func Team() *cli.Command {
 					{
 						Name:      "perm",
 						Usage:     "update team user permissions",
-						ArgsUsage: " ",
+						ArgsUsage: "[<id>...]",
 						Flags: []cli.Flag{
-							&cli.StringFlag{
+							&cli.StringSliceFlag{
 								Name:  "id, i",
-								Value: "",
-								Usage: "team id or slug",
+								Usage: "team id or slug, can be repeated or - for stdin",
 							},
 							&cli.StringFlag{
 								Name:  "user, u",
@@ -214,6 +300,10 @@ func Team() *cli.Command {
 								Value: "user",
 								Usage: "permission, can be user, admin or owner",
 							},
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "allow to leave teams without owner",
+							},
 						},
 						Action: func(c *cli.Context) error {
 							return Handle(c, TeamUserPerm)
@@ -223,18 +313,21 @@ func Team() *cli.Command {
 						Name:      "remove",
 						Aliases:   []string{"rm"},
 						Usage:     "remove a user from a team",
-						ArgsUsage: " ",
+						ArgsUsage: "[<id>...]",
 						Flags: []cli.Flag{
-							&cli.StringFlag{
+							&cli.StringSliceFlag{
 								Name:  "id, i",
-								Value: "",
-								Usage: "team id or slug",
+								Usage: "team id or slug, can be repeated or - for stdin",
 							},
 							&cli.StringFlag{
 								Name:  "user, u",
 								Value: "",
 								Usage: "user id or slug",
 							},
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "allow to leave teams without owner",
+							},
 						},
 						Action: func(c *cli.Context) error {
 							return Handle(c, TeamUserRemove)
@@ -247,135 +340,59 @@ func Team() *cli.Command {
 }
 
 // TeamList provides the sub-command to list all teams.
-func TeamList(c *cli.Context, client *Client) error {
-	resp, err := client.Team.ListTeams(
-		team.NewListTeamsParams(),
-		client.AuthInfo,
-	)
+func TeamList(ctx context.Context, c *cli.Context, client *Client) error {
+	return renderRecords(ctx, c, func(ctx context.Context) ([]interface{}, error) {
+		records, err := listTeams(ctx, client)
 
-	if err != nil {
-		switch val := err.(type) {
-		case *team.ListTeamsForbidden:
-			return fmt.Errorf(*val.Payload.Message)
-		case *team.ListTeamsDefault:
-			return fmt.Errorf(*val.Payload.Message)
-		default:
-			return PrettyError(err)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	if len(resp.Payload) == 0 {
-		fmt.Fprintln(os.Stderr, "empty result")
-		return nil
-	}
 
-	tmpl, err := template.New(
-		"_",
-	).Funcs(
-		globalFuncMap,
-	).Funcs(
-		sprigFuncMap,
-	).Parse(
-		fmt.Sprintln(c.String("format")),
-	)
+		result := make([]interface{}, len(records))
 
-	if err != nil {
-		return err
-	}
-
-	for _, record := range resp.Payload {
-		if err := tmpl.Execute(os.Stdout, record); err != nil {
-			return err
+		for i, record := range records {
+			result[i] = record
 		}
-	}
 
-	return nil
+		return result, nil
+	})
 }
 
 // TeamShow provides the sub-command to show team details.
-func TeamShow(c *cli.Context, client *Client) error {
-	resp, err := client.Team.ShowTeam(
-		team.NewShowTeamParams().WithTeamID(GetIdentifierParam(c)),
-		client.AuthInfo,
-	)
+func TeamShow(ctx context.Context, c *cli.Context, client *Client) error {
+	return renderBatch(ctx, c, func(ctx context.Context, id string) ([]interface{}, error) {
+		record, err := showTeam(ctx, client, id)
 
-	if err != nil {
-		switch val := err.(type) {
-		case *team.ShowTeamForbidden:
-			return fmt.Errorf(*val.Payload.Message)
-		case *team.ShowTeamNotFound:
-			return fmt.Errorf(*val.Payload.Message)
-		case *team.ShowTeamDefault:
-			return fmt.Errorf(*val.Payload.Message)
-		default:
-			return PrettyError(err)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	tmpl, err := template.New(
-		"_",
-	).Funcs(
-		globalFuncMap,
-	).Funcs(
-		sprigFuncMap,
-	).Parse(
-		fmt.Sprintln(c.String("format")),
-	)
-
-	if err != nil {
-		return err
-	}
 
-	return tmpl.Execute(os.Stdout, resp.Payload)
+		return []interface{}{record}, nil
+	})
 }
 
 // TeamDelete provides the sub-command to delete a team.
-func TeamDelete(c *cli.Context, client *Client) error {
-	resp, err := client.Team.DeleteTeam(
-		team.NewDeleteTeamParams().WithTeamID(GetIdentifierParam(c)),
-		client.AuthInfo,
-	)
+func TeamDelete(ctx context.Context, c *cli.Context, client *Client) error {
+	return runBatch(ctx, GetIdentifierParams(c), func(ctx context.Context, teamID string, stdout io.Writer, log *Logger) error {
+		msg, err := teamDelete(ctx, client, teamID)
 
-	if err != nil {
-		switch val := err.(type) {
-		case *team.DeleteTeamForbidden:
-			return fmt.Errorf(*val.Payload.Message)
-		case *team.DeleteTeamNotFound:
-			return fmt.Errorf(*val.Payload.Message)
-		case *team.DeleteTeamBadRequest:
-			return fmt.Errorf(*val.Payload.Message)
-		case *team.DeleteTeamDefault:
-			return fmt.Errorf(*val.Payload.Message)
-		default:
-			return PrettyError(err)
+		if err != nil {
+			return err
 		}
-	}
 
-	fmt.Fprintln(os.Stderr, *resp.Payload.Message)
-	return nil
+		log.Info(msg)
+		return nil
+	})
 }
 
 // TeamUpdate provides the sub-command to update a team.
-func TeamUpdate(c *cli.Context, client *Client) error {
-	resp, err := client.Team.ShowTeam(
-		team.NewShowTeamParams().WithTeamID(GetIdentifierParam(c)),
-		client.AuthInfo,
-	)
+func TeamUpdate(ctx context.Context, c *cli.Context, client *Client) error {
+	record, err := showTeam(ctx, client, GetIdentifierParam(c))
 
 	if err != nil {
-		switch val := err.(type) {
-		case *team.ShowTeamForbidden:
-			return fmt.Errorf(*val.Payload.Message)
-		case *team.ShowTeamNotFound:
-			return fmt.Errorf(*val.Payload.Message)
-		case *team.ShowTeamDefault:
-			return fmt.Errorf(*val.Payload.Message)
-		default:
-			return PrettyError(err)
-		}
+		return err
 	}
 
-	record := resp.Payload
 	changed := false
 
 	if val := c.String("slug"); c.IsSet("slug") && val != *record.Slug {
@@ -389,40 +406,43 @@ func TeamUpdate(c *cli.Context, client *Client) error {
 	}
 
 	if changed {
-		if err := record.Validate(strfmt.Default); err != nil {
-			return ValidateError(err)
+		if err := teamUpdate(ctx, client, record); err != nil {
+			return err
 		}
 
-		_, err := client.Team.UpdateTeam(
-			team.NewUpdateTeamParams().WithTeamID(record.ID.String()).WithTeam(record),
-			client.AuthInfo,
-		)
+		logger.Info("successfully updated")
+	} else {
+		logger.Info("nothing to update...")
+	}
 
-		if err != nil {
-			switch val := err.(type) {
-			case *team.UpdateTeamForbidden:
-				return fmt.Errorf(*val.Payload.Message)
-			case *team.UpdateTeamNotFound:
-				return fmt.Errorf(*val.Payload.Message)
-			case *team.UpdateTeamDefault:
-				return fmt.Errorf(*val.Payload.Message)
-			case *team.UpdateTeamUnprocessableEntity:
-				return ValidateError(*val.Payload)
-			default:
-				return PrettyError(err)
-			}
-		}
+	return nil
+}
 
-		fmt.Fprintln(os.Stderr, "successfully updated")
+// TeamCreate provides the sub-command to create a team.
+func TeamCreate(ctx context.Context, c *cli.Context, client *Client) error {
+	record := &models.Team{}
+
+	if val := c.String("slug"); c.IsSet("slug") && val != "" {
+		record.Slug = &val
+	}
+
+	if val := c.String("name"); c.IsSet("name") && val != "" {
+		record.Name = &val
 	} else {
-		fmt.Fprintln(os.Stderr, "nothing to update...")
+		return fmt.Errorf("you must provide a name")
 	}
 
+	if _, err := teamCreate(ctx, client, record); err != nil {
+		return err
+	}
+
+	logger.Info("successfully created")
 	return nil
 }
 
-// TeamCreate provides the sub-command to create a team.
-func TeamCreate(c *cli.Context, client *Client) error {
+// TeamClone provides the sub-command to clone a team including its users.
+func TeamClone(ctx context.Context, c *cli.Context, client *Client) error {
+	sourceID := GetIdentifierParam(c)
 	record := &models.Team{}
 
 	if val := c.String("slug"); c.IsSet("slug") && val != "" {
@@ -435,87 +455,493 @@ func TeamCreate(c *cli.Context, client *Client) error {
 		return fmt.Errorf("you must provide a name")
 	}
 
+	excluded := make(map[string]bool)
+
+	for _, val := range c.StringSlice("exclude") {
+		excluded[val] = true
+	}
+
+	members, err := teamUsers(ctx, client, sourceID)
+
+	if err != nil {
+		return err
+	}
+
+	created, err := teamCreate(ctx, client, record)
+
+	if err != nil {
+		return err
+	}
+
+	teamID := created.ID.String()
+	report := make([]*teamCloneEntry, 0, len(members))
+	failed := 0
+
+	for i, member := range members {
+		if ctx.Err() != nil {
+			printTeamCloneReport(report)
+			return fmt.Errorf("interrupted after %d of %d users", i, len(members))
+		}
+
+		entry := &teamCloneEntry{
+			Perm: stringValue(member.Perm, "user"),
+		}
+
+		userID := ""
+
+		if member.User != nil {
+			userID = member.User.ID.String()
+			entry.User = stringValue(member.User.Slug, userID)
+		} else if member.UserID != nil {
+			userID = member.UserID.String()
+			entry.User = userID
+		}
+
+		report = append(report, entry)
+
+		if userID == "" {
+			entry.Result = "failed: missing user"
+			failed++
+
+			continue
+		}
+
+		if excluded[entry.User] || excluded[userID] {
+			entry.Result = "excluded"
+			continue
+		}
+
+		if entry.Perm == "owner" && c.Bool("downgrade-owners") {
+			entry.Perm = "admin"
+			entry.Result = "downgraded from owner"
+		}
+
+		if _, err := teamUserAppend(ctx, client, teamID, userID, entry.Perm); err != nil {
+			entry.Result = fmt.Sprintf("failed: %s", err)
+			failed++
+
+			continue
+		}
+
+		if entry.Result == "" {
+			entry.Result = "copied"
+		}
+	}
+
+	printTeamCloneReport(report)
+
+	if failed > 0 {
+		return fmt.Errorf("failed to copy %d of %d users", failed, len(members))
+	}
+
+	logger.Info("successfully cloned")
+	return nil
+}
+
+// teamCloneEntry represents a single user within the clone report.
+type teamCloneEntry struct {
+	User   string
+	Perm   string
+	Result string
+}
+
+// printTeamCloneReport prints which users had been copied to the clone.
+func printTeamCloneReport(report []*teamCloneEntry) {
+	for _, entry := range report {
+		fmt.Fprintf(os.Stdout, "%s as %s: %s\n", entry.User, entry.Perm, entry.Result)
+	}
+}
+
+// TeamTransfer provides the sub-command to transfer the ownership of a team.
+func TeamTransfer(ctx context.Context, c *cli.Context, client *Client) error {
+	teamID := GetIdentifierParam(c)
+	target := c.String("to")
+	demote := c.String("demote-to")
+
+	if target == "" {
+		return fmt.Errorf("you must provide the new owner")
+	}
+
+	if demote != "admin" && demote != "user" && demote != "remove" {
+		return fmt.Errorf("invalid demotion, can be admin, user or remove")
+	}
+
+	members, err := teamUsers(ctx, client, teamID)
+
+	if err != nil {
+		return err
+	}
+
+	var (
+		owner  *models.TeamUser
+		undo   []func(context.Context) error
+		failed error
+	)
+
+	previous := make([]string, 0)
+
+	for _, member := range members {
+		if owner == nil && matchUser(member.User, target) {
+			owner = member
+			continue
+		}
+
+		if stringValue(member.Perm, "") != "owner" {
+			continue
+		}
+
+		userID := teamMemberID(member)
+
+		if userID == "" {
+			return fmt.Errorf("an owner of %s is missing the user, please check the team manually", teamID)
+		}
+
+		previous = append(previous, userID)
+	}
+
+	switch {
+	case owner == nil && !c.Bool("append"):
+		return fmt.Errorf("%s is not a member of %s, use --append to add", target, teamID)
+	case owner == nil:
+		if _, failed = teamUserAppend(ctx, client, teamID, target, "owner"); failed == nil {
+			logger.Infof("appended %s as owner", target)
+
+			undo = append(undo, func(ctx context.Context) error {
+				_, err := teamUserRemove(ctx, client, teamID, target)
+				return err
+			})
+		}
+	case stringValue(owner.Perm, "user") != "owner":
+		perm := stringValue(owner.Perm, "user")
+
+		if _, failed = teamUserPerm(ctx, client, teamID, target, "owner"); failed == nil {
+			logger.Infof("promoted %s from %s to owner", target, perm)
+
+			undo = append(undo, func(ctx context.Context) error {
+				_, err := teamUserPerm(ctx, client, teamID, target, perm)
+				return err
+			})
+		}
+	default:
+		logger.Infof("%s is already an owner", target)
+	}
+
+	for _, userID := range previous {
+		userID := userID
+
+		if failed != nil {
+			break
+		}
+
+		if ctx.Err() != nil {
+			failed = fmt.Errorf("interrupted")
+			break
+		}
+
+		if demote == "remove" {
+			if _, failed = teamUserRemove(ctx, client, teamID, userID); failed == nil {
+				logger.Infof("removed previous owner %s", userID)
+
+				undo = append(undo, func(ctx context.Context) error {
+					_, err := teamUserAppend(ctx, client, teamID, userID, "owner")
+					return err
+				})
+			}
+		} else {
+			if _, failed = teamUserPerm(ctx, client, teamID, userID, demote); failed == nil {
+				logger.Infof("demoted previous owner %s to %s", userID, demote)
+
+				undo = append(undo, func(ctx context.Context) error {
+					_, err := teamUserPerm(ctx, client, teamID, userID, "owner")
+					return err
+				})
+			}
+		}
+	}
+
+	if failed == nil {
+		logger.Info("successfully transferred")
+		return nil
+	}
+
+	logger.Warnf("transfer failed, restoring original permissions: %s", failed)
+
+	for i := len(undo) - 1; i >= 0; i-- {
+		if err := teamTransferUndo(c, undo[i]); err != nil {
+			return fmt.Errorf("failed to restore original permissions, please check the team manually: %s", err)
+		}
+	}
+
+	return fmt.Errorf("transfer aborted, original permissions restored: %s", failed)
+}
+
+// teamMemberID returns the slug or id of the member, it is empty if the
+// membership neither embeds the user nor references it.
+func teamMemberID(member *models.TeamUser) string {
+	if member.User != nil {
+		return stringValue(member.User.Slug, member.User.ID.String())
+	}
+
+	if member.UserID != nil {
+		return member.UserID.String()
+	}
+
+	return ""
+}
+
+// teamTransferUndo executes a single restore step with its own timeout, the
+// steps are detached from the command context as it could be interrupted.
+func teamTransferUndo(c *cli.Context, undo func(context.Context) error) error {
+	ctx, cancel := timeoutContext(context.Background(), c.Duration("timeout"))
+	defer cancel()
+
+	return undo(ctx)
+}
+
+// TeamUserList provides the sub-command to list users of the team.
+func TeamUserList(ctx context.Context, c *cli.Context, client *Client) error {
+	return renderBatch(ctx, c, func(ctx context.Context, id string) ([]interface{}, error) {
+		records, err := teamUsers(ctx, client, id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]interface{}, len(records))
+
+		for i, record := range records {
+			result[i] = record
+		}
+
+		return result, nil
+	})
+}
+
+// TeamUserAppend provides the sub-command to append a user to the team.
+func TeamUserAppend(ctx context.Context, c *cli.Context, client *Client) error {
+	userID := GetUserParam(c)
+	perm := GetPermParam(c)
+
+	return runBatch(ctx, GetIdentifierParams(c), func(ctx context.Context, teamID string, stdout io.Writer, log *Logger) error {
+		msg, err := teamUserAppend(ctx, client, teamID, userID, perm)
+
+		if err != nil {
+			return err
+		}
+
+		log.Info(msg)
+		return nil
+	})
+}
+
+// TeamUserPerm provides the sub-command to update team user permissions.
+func TeamUserPerm(ctx context.Context, c *cli.Context, client *Client) error {
+	userID := GetUserParam(c)
+	perm := GetPermParam(c)
+	ids := GetIdentifierParams(c)
+
+	if perm != "owner" {
+		if err := GuardBatchOwners(ctx, c, client, batchDemoted(ids, userID)); err != nil {
+			return err
+		}
+	}
+
+	return runBatch(ctx, ids, func(ctx context.Context, teamID string, stdout io.Writer, log *Logger) error {
+		msg, err := teamUserPerm(ctx, client, teamID, userID, perm)
+
+		if err != nil {
+			return err
+		}
+
+		log.Info(msg)
+		return nil
+	})
+}
+
+// TeamUserRemove provides the sub-command to remove a user from the team.
+func TeamUserRemove(ctx context.Context, c *cli.Context, client *Client) error {
+	userID := GetUserParam(c)
+	ids := GetIdentifierParams(c)
+
+	if err := GuardBatchOwners(ctx, c, client, batchDemoted(ids, userID)); err != nil {
+		return err
+	}
+
+	return runBatch(ctx, ids, func(ctx context.Context, teamID string, stdout io.Writer, log *Logger) error {
+		msg, err := teamUserRemove(ctx, client, teamID, userID)
+
+		if err != nil {
+			return err
+		}
+
+		log.Info(msg)
+		return nil
+	})
+}
+
+// batchDemoted maps every team of the batch to the removed or demoted user.
+func batchDemoted(teamIDs []string, userID string) map[string][]string {
+	result := make(map[string][]string, len(teamIDs))
+
+	for _, teamID := range teamIDs {
+		result[teamID] = append(result[teamID], userID)
+	}
+
+	return result
+}
+
+// showTeam fetches a single team by id or slug.
+func showTeam(ctx context.Context, client *Client, id string) (*models.Team, error) {
+	resp, err := client.Team.ShowTeam(
+		team.NewShowTeamParams().WithContext(ctx).WithTeamID(id),
+		client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *team.ShowTeamForbidden:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *team.ShowTeamNotFound:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *team.ShowTeamDefault:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		default:
+			return nil, PrettyError(err)
+		}
+	}
+
+	return resp.Payload, nil
+}
+
+// listTeams fetches all available teams.
+func listTeams(ctx context.Context, client *Client) ([]*models.Team, error) {
+	resp, err := client.Team.ListTeams(
+		team.NewListTeamsParams().WithContext(ctx),
+		client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *team.ListTeamsForbidden:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *team.ListTeamsDefault:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		default:
+			return nil, PrettyError(err)
+		}
+	}
+
+	return resp.Payload, nil
+}
+
+// teamCreate validates and creates a new team.
+func teamCreate(ctx context.Context, client *Client, record *models.Team) (*models.Team, error) {
 	if err := record.Validate(strfmt.Default); err != nil {
-		return ValidateError(err)
+		return nil, ValidateError(err)
 	}
 
-	_, err := client.Team.CreateTeam(
-		team.NewCreateTeamParams().WithTeam(record),
+	resp, err := client.Team.CreateTeam(
+		team.NewCreateTeamParams().WithContext(ctx).WithTeam(record),
 		client.AuthInfo,
 	)
 
 	if err != nil {
 		switch val := err.(type) {
 		case *team.CreateTeamForbidden:
-			return fmt.Errorf(*val.Payload.Message)
+			return nil, fmt.Errorf(*val.Payload.Message)
 		case *team.CreateTeamDefault:
-			return fmt.Errorf(*val.Payload.Message)
+			return nil, fmt.Errorf(*val.Payload.Message)
 		case *team.CreateTeamUnprocessableEntity:
-			return ValidateError(*val.Payload)
+			return nil, ValidateError(*val.Payload)
 		default:
-			return PrettyError(err)
+			return nil, PrettyError(err)
 		}
 	}
 
-	fmt.Fprintln(os.Stderr, "successfully created")
-	return nil
+	return resp.Payload, nil
 }
 
-// TeamUserList provides the sub-command to list users of the team.
-func TeamUserList(c *cli.Context, client *Client) error {
-	resp, err := client.Team.ListTeamUsers(
-		team.NewListTeamUsersParams().WithTeamID(GetIdentifierParam(c)),
+// teamUpdate validates and updates an existing team.
+func teamUpdate(ctx context.Context, client *Client, record *models.Team) error {
+	if err := record.Validate(strfmt.Default); err != nil {
+		return ValidateError(err)
+	}
+
+	_, err := client.Team.UpdateTeam(
+		team.NewUpdateTeamParams().WithContext(ctx).WithTeamID(record.ID.String()).WithTeam(record),
 		client.AuthInfo,
 	)
 
 	if err != nil {
 		switch val := err.(type) {
-		case *team.ListTeamUsersForbidden:
+		case *team.UpdateTeamForbidden:
 			return fmt.Errorf(*val.Payload.Message)
-		case *team.ListTeamUsersNotFound:
+		case *team.UpdateTeamNotFound:
 			return fmt.Errorf(*val.Payload.Message)
-		case *team.ListTeamUsersDefault:
+		case *team.UpdateTeamDefault:
 			return fmt.Errorf(*val.Payload.Message)
+		case *team.UpdateTeamUnprocessableEntity:
+			return ValidateError(*val.Payload)
 		default:
 			return PrettyError(err)
 		}
 	}
 
-	if len(resp.Payload) == 0 {
-		fmt.Fprintln(os.Stderr, "empty result")
-		return nil
-	}
+	return nil
+}
 
-	tmpl, err := template.New(
-		"_",
-	).Funcs(
-		globalFuncMap,
-	).Funcs(
-		sprigFuncMap,
-	).Parse(
-		fmt.Sprintln(c.String("format")),
+// teamDelete deletes a single team by id or slug.
+func teamDelete(ctx context.Context, client *Client, id string) (string, error) {
+	resp, err := client.Team.DeleteTeam(
+		team.NewDeleteTeamParams().WithContext(ctx).WithTeamID(id),
+		client.AuthInfo,
 	)
 
 	if err != nil {
-		return err
+		switch val := err.(type) {
+		case *team.DeleteTeamForbidden:
+			return "", fmt.Errorf(*val.Payload.Message)
+		case *team.DeleteTeamNotFound:
+			return "", fmt.Errorf(*val.Payload.Message)
+		case *team.DeleteTeamBadRequest:
+			return "", fmt.Errorf(*val.Payload.Message)
+		case *team.DeleteTeamDefault:
+			return "", fmt.Errorf(*val.Payload.Message)
+		default:
+			return "", PrettyError(err)
+		}
 	}
 
-	for _, record := range resp.Payload {
-		if err := tmpl.Execute(os.Stdout, record); err != nil {
-			return err
+	return *resp.Payload.Message, nil
+}
+
+// teamUsers fetches the user assignments of a team.
+func teamUsers(ctx context.Context, client *Client, teamID string) ([]*models.TeamUser, error) {
+	resp, err := client.Team.ListTeamUsers(
+		team.NewListTeamUsersParams().WithContext(ctx).WithTeamID(teamID),
+		client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *team.ListTeamUsersForbidden:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *team.ListTeamUsersNotFound:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *team.ListTeamUsersDefault:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		default:
+			return nil, PrettyError(err)
 		}
 	}
 
-	return nil
+	return resp.Payload, nil
 }
 
-// TeamUserAppend provides the sub-command to append a user to the team.
-func TeamUserAppend(c *cli.Context, client *Client) error {
-	userID := GetUserParam(c)
-	perm := GetPermParam(c)
-
+// teamUserAppend assigns a user with a permission to a team.
+func teamUserAppend(ctx context.Context, client *Client, teamID, userID, perm string) (string, error) {
 	resp, err := client.Team.AppendTeamToUser(
-		team.NewAppendTeamToUserParams().WithTeamID(GetIdentifierParam(c)).WithTeamUser(
+		team.NewAppendTeamToUserParams().WithContext(ctx).WithTeamID(teamID).WithTeamUser(
 			&models.TeamUserParams{
 				User: &userID,
 				Perm: &perm,
@@ -527,33 +953,29 @@ func TeamUserAppend(c *cli.Context, client *Client) error {
 	if err != nil {
 		switch val := err.(type) {
 		case *team.AppendTeamToUserForbidden:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *team.AppendTeamToUserNotFound:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *team.AppendTeamToUserPreconditionFailed:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 
 		case *team.AppendTeamToUserUnprocessableEntity:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 
 		case *team.AppendTeamToUserDefault:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		default:
-			return PrettyError(err)
+			return "", PrettyError(err)
 		}
 	}
 
-	fmt.Fprintln(os.Stderr, *resp.Payload.Message)
-	return nil
+	return *resp.Payload.Message, nil
 }
 
-// TeamUserPerm provides the sub-command to update team user permissions.
-func TeamUserPerm(c *cli.Context, client *Client) error {
-	userID := GetUserParam(c)
-	perm := GetPermParam(c)
-
+// teamUserPerm updates the permission of a user within a team.
+func teamUserPerm(ctx context.Context, client *Client, teamID, userID, perm string) (string, error) {
 	resp, err := client.Team.PermitTeamUser(
-		team.NewPermitTeamUserParams().WithTeamID(GetIdentifierParam(c)).WithTeamUser(
+		team.NewPermitTeamUserParams().WithContext(ctx).WithTeamID(teamID).WithTeamUser(
 			&models.TeamUserParams{
 				User: &userID,
 				Perm: &perm,
@@ -565,33 +987,31 @@ func TeamUserPerm(c *cli.Context, client *Client) error {
 	if err != nil {
 		switch val := err.(type) {
 		case *team.PermitTeamUserForbidden:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *team.PermitTeamUserNotFound:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *team.PermitTeamUserPreconditionFailed:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 
 		case *team.PermitTeamUserUnprocessableEntity:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 
 		case *team.PermitTeamUserDefault:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		default:
-			return PrettyError(err)
+			return "", PrettyError(err)
 		}
 	}
 
-	fmt.Fprintln(os.Stderr, *resp.Payload.Message)
-	return nil
+	return *resp.Payload.Message, nil
 }
 
-// TeamUserRemove provides the sub-command to remove a user from the team.
-func TeamUserRemove(c *cli.Context, client *Client) error {
-	userID := GetUserParam(c)
+// teamUserRemove removes a user assignment from a team.
+func teamUserRemove(ctx context.Context, client *Client, teamID, userID string) (string, error) {
 	perm := "user"
 
 	resp, err := client.Team.DeleteTeamFromUser(
-		team.NewDeleteTeamFromUserParams().WithTeamID(GetIdentifierParam(c)).WithTeamUser(
+		team.NewDeleteTeamFromUserParams().WithContext(ctx).WithTeamID(teamID).WithTeamUser(
 			&models.TeamUserParams{
 				User: &userID,
 				Perm: &perm,
@@ -603,18 +1023,17 @@ func TeamUserRemove(c *cli.Context, client *Client) error {
 	if err != nil {
 		switch val := err.(type) {
 		case *team.DeleteTeamFromUserForbidden:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *team.DeleteTeamFromUserNotFound:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *team.DeleteTeamFromUserPreconditionFailed:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *team.DeleteTeamFromUserDefault:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		default:
-			return PrettyError(err)
+			return "", PrettyError(err)
 		}
 	}
 
-	fmt.Fprintln(os.Stderr, *resp.Payload.Message)
-	return nil
+	return *resp.Payload.Message, nil
 }
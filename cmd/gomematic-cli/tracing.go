@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomematic/gomematic-cli/pkg/version"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// traceBatchSize defines the number of finished spans exported together,
+// long running commands like serve export their spans in batches.
+const traceBatchSize = 512
+
+// traceparentPattern matches a W3C traceparent header of version 00.
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// SpanKind defines the kind of a span as defined by OTLP.
+type SpanKind int
+
+const (
+	// SpanInternal defines spans of operations within the cli.
+	SpanInternal SpanKind = 1
+
+	// SpanClient defines spans of requests sent to the api.
+	SpanClient SpanKind = 3
+)
+
+// spanKey is the context key of the active span.
+type spanKey struct{}
+
+// Span represents a single timed operation within a trace.
+type Span struct {
+	tracer     *Tracer
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Kind       SpanKind
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Failed     bool
+	Message    string
+
+	mu    sync.Mutex
+	ended bool
+}
+
+// SetAttribute records an attribute, it is safe for concurrent use.
+func (s *Span) SetAttribute(key string, val interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Attributes[key] = val
+}
+
+// SetError marks the span as failed with the redacted error message.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Failed = true
+	s.Message = Redact(err.Error())
+}
+
+// Finish ends the span and hands it over to the tracer.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.record(s)
+}
+
+// Traceparent formats the W3C trace context header of the span.
+func (s *Span) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID)
+}
+
+// Tracer collects finished spans and exports them to an OTLP endpoint or
+// appends them to a local file.
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	file     string
+	timeout  time.Duration
+	traceID  string
+	parentID string
+
+	mu    sync.Mutex
+	spans []*Span
+	wg    sync.WaitGroup
+}
+
+// tracer is the global tracer, it stays nil if tracing is disabled.
+var tracer *Tracer
+
+// SetupTracer configures the global tracer by the global flags, a trace
+// context passed by TRACEPARENT continues the trace of the caller.
+func SetupTracer(c *cli.Context) error {
+	endpoint := c.String("trace-endpoint")
+	file := c.String("trace-file")
+
+	if endpoint == "" && file == "" {
+		return nil
+	}
+
+	t := &Tracer{
+		file:    file,
+		headers: make(map[string]string),
+		timeout: c.Duration("timeout"),
+	}
+
+	if endpoint != "" {
+		parsed, err := url.Parse(endpoint)
+
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("invalid trace endpoint %s", endpoint)
+		}
+
+		if parsed.Path == "" || parsed.Path == "/" {
+			parsed.Path = "/v1/traces"
+		}
+
+		t.endpoint = parsed.String()
+	}
+
+	for _, header := range c.StringSlice("trace-header") {
+		parts := strings.SplitN(header, "=", 2)
+
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("invalid trace header %s, expected key=value", header)
+		}
+
+		t.headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	if match := traceparentPattern.FindStringSubmatch(os.Getenv("TRACEPARENT")); match != nil {
+		t.traceID = match[1]
+		t.parentID = match[2]
+	}
+
+	tracer = t
+	return nil
+}
+
+// StartSpan starts a span as child of the span within the context, without
+// a parent it starts a new trace. Without a tracer it returns a nil span,
+// all methods of spans are safe to call on nil.
+func StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer:     tracer,
+		SpanID:     randomHex(8),
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}),
+	}
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else if tracer.traceID != "" {
+		span.TraceID = tracer.traceID
+		span.ParentID = tracer.parentID
+	} else {
+		span.TraceID = randomHex(16)
+	}
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SpanFromContext returns the active span of the context, it returns nil
+// without an active span.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// record stores a finished span and exports a full batch in background.
+func (t *Tracer) record(span *Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.spans = append(t.spans, span)
+
+	if len(t.spans) < traceBatchSize {
+		return
+	}
+
+	batch := t.spans
+	t.spans = nil
+	t.wg.Add(1)
+
+	go func() {
+		defer t.wg.Done()
+
+		if err := t.export(batch); err != nil {
+			logger.Warnf("failed to export traces: %s", err)
+		}
+	}()
+}
+
+// Shutdown exports the remaining spans and waits for running exports.
+func (t *Tracer) Shutdown() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	batch := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+
+	if len(batch) > 0 {
+		if err := t.export(batch); err != nil {
+			logger.Warnf("failed to export traces: %s", err)
+		}
+	}
+
+	t.wg.Wait()
+}
+
+// export sends the spans to the endpoint and appends them to the file.
+func (t *Tracer) export(spans []*Span) error {
+	content, err := json.Marshal(otlpRequest(spans))
+
+	if err != nil {
+		return err
+	}
+
+	if t.file != "" {
+		handle, err := os.OpenFile(t.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := handle.Write(append(content, '\n')); err != nil {
+			handle.Close()
+			return err
+		}
+
+		if err := handle.Close(); err != nil {
+			return err
+		}
+	}
+
+	if t.endpoint != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+		defer cancel()
+
+		req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(content))
+
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		for key, val := range t.headers {
+			req.Header.Set(key, val)
+		}
+
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+
+		if err != nil {
+			return err
+		}
+
+		defer resp.Body.Close()
+		ioutil.ReadAll(resp.Body)
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("endpoint responded with %s", resp.Status)
+		}
+	}
+
+	logger.Debug("exported traces", "spans", len(spans))
+	return nil
+}
+
+// otlpRequest builds the OTLP/JSON export request of the spans.
+func otlpRequest(spans []*Span) map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(spans))
+
+	for _, span := range spans {
+		span.mu.Lock()
+
+		row := map[string]interface{}{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"name":              span.Name,
+			"kind":              int(span.Kind),
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.Attributes),
+			"status":            map[string]interface{}{"code": 1},
+		}
+
+		if span.ParentID != "" {
+			row["parentSpanId"] = span.ParentID
+		}
+
+		if span.Failed {
+			row["status"] = map[string]interface{}{"code": 2, "message": span.Message}
+		}
+
+		span.mu.Unlock()
+		result = append(result, row)
+	}
+
+	name := os.Getenv("OTEL_SERVICE_NAME")
+
+	if name == "" {
+		name = "gomematic-cli"
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{
+						"service.name":    name,
+						"service.version": version.String,
+					}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{
+							"name":    "gomematic-cli",
+							"version": version.String,
+						},
+						"spans": result,
+					},
+				},
+			},
+		},
+	}
+}
+
+// otlpAttributes converts the attributes into typed OTLP key values.
+func otlpAttributes(attrs map[string]interface{}) []interface{} {
+	result := make([]interface{}, 0, len(attrs))
+
+	for key, val := range attrs {
+		var value map[string]interface{}
+
+		switch v := val.(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": Redact(fmt.Sprint(v))}
+		}
+
+		result = append(result, map[string]interface{}{
+			"key":   key,
+			"value": value,
+		})
+	}
+
+	return result
+}
+
+// traceTransport records a client span per api request including the
+// phases of dns lookup, connect and tls handshake, and propagates the
+// trace context to the api.
+type traceTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := StartSpan(req.Context(), req.Method+" "+req.URL.Path, SpanClient)
+
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	span.SetAttribute("net.peer.name", req.URL.Hostname())
+
+	var (
+		mu                       sync.Mutex
+		dns, connect, handshake  *Span
+		connected, firstResponse time.Time
+	)
+
+	phase := func(name string) *Span {
+		_, child := StartSpan(ctx, name, SpanInternal)
+		return child
+	}
+
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			dns = phase("dns")
+			dns.SetAttribute("net.host.name", info.Host)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			dns.SetError(info.Err)
+			dns.Finish()
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			connect = phase("connect")
+			connect.SetAttribute("net.peer.address", addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			connect.SetError(err)
+			connect.Finish()
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			handshake = phase("tls")
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			handshake.SetError(err)
+			handshake.Finish()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			connected = time.Now()
+			span.SetAttribute("net.conn.reused", info.Reused)
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			firstResponse = time.Now()
+		},
+	})
+
+	req = req.WithContext(ctx)
+
+	if span != nil {
+		req.Header.Set("traceparent", span.Traceparent())
+	}
+
+	resp, err := t.next.RoundTrip(req)
+
+	mu.Lock()
+
+	if !connected.IsZero() && !firstResponse.IsZero() {
+		span.SetAttribute("http.response_wait_ms", float64(firstResponse.Sub(connected))/float64(time.Millisecond))
+	}
+
+	mu.Unlock()
+
+	if err != nil {
+		span.SetError(err)
+		span.Finish()
+		return resp, err
+	}
+
+	span.SetAttribute("http.status_code", resp.StatusCode)
+
+	if resp.StatusCode >= 400 {
+		span.SetError(fmt.Errorf("api responded with %s", resp.Status))
+	}
+
+	span.Finish()
+	return resp, nil
+}
+
+// randomHex generates a random identifier of the given number of bytes.
+func randomHex(size int) string {
+	buf := make([]byte, size)
+
+	if _, err := rand.Read(buf); err != nil {
+		return strings.Repeat("0", size*2-1) + "1"
+	}
+
+	return hex.EncodeToString(buf)
+}
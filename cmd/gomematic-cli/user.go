@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"text/template"
+	"strings"
+	"time"
 
 	"github.com/go-openapi/strfmt"
 	"github.com/gomematic/gomematic-go/gomematic/user"
@@ -53,6 +56,15 @@ func User() *cli.Command {
 				Usage:     "list all users",
 				ArgsUsage: " ",
 				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "watch",
+						Usage: "refresh periodically and highlight changes",
+					},
+					&cli.DurationFlag{
+						Name:  "interval",
+						Value: 5 * time.Second,
+						Usage: "interval between refreshes while watching",
+					},
 					&cli.StringFlag{
 						Name:   "format",
 						Value:  tmplUserList,
@@ -67,12 +79,20 @@ func User() *cli.Command {
 			{
 				Name:      "show",
 				Usage:     "show an user",
-				ArgsUsage: " ",
+				ArgsUsage: "[<id>...]",
 				Flags: []cli.Flag{
-					&cli.StringFlag{
+					&cli.StringSliceFlag{
 						Name:  "id, i",
-						Value: "",
-						Usage: "user id or slug",
+						Usage: "user id or slug, can be repeated or - for stdin",
+					},
+					&cli.BoolFlag{
+						Name:  "watch",
+						Usage: "refresh periodically and highlight changes",
+					},
+					&cli.DurationFlag{
+						Name:  "interval",
+						Value: 5 * time.Second,
+						Usage: "interval between refreshes while watching",
 					},
 					&cli.StringFlag{
 						Name:   "format",
@@ -89,12 +109,15 @@ func User() *cli.Command {
 				Name:      "delete",
 				Aliases:   []string{"rm"},
 				Usage:     "delete an user",
-				ArgsUsage: " ",
+				ArgsUsage: "[<id>...]",
 				Flags: []cli.Flag{
-					&cli.StringFlag{
+					&cli.StringSliceFlag{
 						Name:  "id, i",
-						Value: "",
-						Usage: "user id or slug",
+						Usage: "user id or slug, can be repeated or - for stdin",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "allow to leave teams without owner",
 					},
 				},
 				Action: func(c *cli.Context) error {
@@ -129,7 +152,21 @@ func User() *cli.Command {
 					&cli.StringFlag{
 						Name:  "password",
 						Value: "",
-						Usage: "provide a password",
+						Usage: "provide a password, accepts env:VAR, file:path, exec:command, literal:value or -",
+					},
+					&cli.BoolFlag{
+						Name:  "generate-password",
+						Usage: "generate a random password",
+					},
+					&cli.IntFlag{
+						Name:  "length",
+						Value: 20,
+						Usage: "length of the generated password",
+					},
+					&cli.StringFlag{
+						Name:  "password-file",
+						Value: "",
+						Usage: "write the generated password to this file",
 					},
 					&cli.BoolFlag{
 						Name:  "active",
@@ -167,7 +204,21 @@ func User() *cli.Command {
 					&cli.StringFlag{
 						Name:  "password",
 						Value: "",
-						Usage: "provide a password",
+						Usage: "provide a password, accepts env:VAR, file:path, exec:command, literal:value or -",
+					},
+					&cli.BoolFlag{
+						Name:  "generate-password",
+						Usage: "generate a random password",
+					},
+					&cli.IntFlag{
+						Name:  "length",
+						Value: 20,
+						Usage: "length of the generated password",
+					},
+					&cli.StringFlag{
+						Name:  "password-file",
+						Value: "",
+						Usage: "write the generated password to this file",
 					},
 					&cli.BoolFlag{
 						Name:  "active",
@@ -190,12 +241,20 @@ func User() *cli.Command {
 						Name:      "list",
 						Aliases:   []string{"ls"},
 						Usage:     "list assigned teams for a user",
-						ArgsUsage: " ",
+						ArgsUsage: "[<id>...]",
 						Flags: []cli.Flag{
-							&cli.StringFlag{
+							&cli.StringSliceFlag{
 								Name:  "id, i",
-								Value: "",
-								Usage: "user id or slug",
+								Usage: "user id or slug, can be repeated or - for stdin",
+							},
+							&cli.BoolFlag{
+								Name:  "watch",
+								Usage: "refresh periodically and highlight changes",
+							},
+							&cli.DurationFlag{
+								Name:  "interval",
+								Value: 5 * time.Second,
+								Usage: "interval between refreshes while watching",
 							},
 							&cli.StringFlag{
 								Name:   "format",
@@ -211,17 +270,17 @@ func User() *cli.Command {
 					{
 						Name:      "append",
 						Usage:     "append a team to an user",
-						ArgsUsage: " ",
+						ArgsUsage: "[<id>...]",
 						Flags: []cli.Flag{
-							&cli.StringFlag{
+							&cli.StringSliceFlag{
 								Name:  "id, i",
-								Value: "",
-								Usage: "user id or slug",
+								Usage: "user id or slug, can be repeated or - for stdin",
 							},
 							&cli.StringFlag{
-								Name:  "team, t",
-								Value: "",
-								Usage: "team id or slug",
+								Name:    "team",
+								Aliases: []string{"t"},
+								Value:   "",
+								Usage:   "team id or slug",
 							},
 							&cli.StringFlag{
 								Name:  "perm",
@@ -236,23 +295,27 @@ func User() *cli.Command {
 					{
 						Name:      "perm",
 						Usage:     "update user team permissions",
-						ArgsUsage: " ",
+						ArgsUsage: "[<id>...]",
 						Flags: []cli.Flag{
-							&cli.StringFlag{
+							&cli.StringSliceFlag{
 								Name:  "id, i",
-								Value: "",
-								Usage: "user id or slug to update",
+								Usage: "user id or slug to update, can be repeated or - for stdin",
 							},
 							&cli.StringFlag{
-								Name:  "team, t",
-								Value: "",
-								Usage: "team id or slug to update",
+								Name:    "team",
+								Aliases: []string{"t"},
+								Value:   "",
+								Usage:   "team id or slug to update",
 							},
 							&cli.StringFlag{
 								Name:  "perm",
 								Value: "user",
 								Usage: "permission, can be user, admin or owner",
 							},
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "allow to leave teams without owner",
+							},
 						},
 						Action: func(c *cli.Context) error {
 							return Handle(c, UserTeamPerm)
@@ -262,21 +325,57 @@ func User() *cli.Command {
 						Name:      "remove",
 						Aliases:   []string{"rm"},
 						Usage:     "remove a team from an user",
+						ArgsUsage: "[<id>...]",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "id, i",
+								Usage: "user id or slug to remove from, can be repeated or - for stdin",
+							},
+							&cli.StringFlag{
+								Name:    "team",
+								Aliases: []string{"t"},
+								Value:   "",
+								Usage:   "team id or slug to remove",
+							},
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "allow to leave teams without owner",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return Handle(c, UserTeamRemove)
+						},
+					},
+					{
+						Name:      "sync",
+						Usage:     "sync team assignments of an user",
 						ArgsUsage: " ",
 						Flags: []cli.Flag{
 							&cli.StringFlag{
 								Name:  "id, i",
 								Value: "",
-								Usage: "user id or slug to remove from",
+								Usage: "user id or slug to sync",
 							},
-							&cli.StringFlag{
-								Name:  "team, t",
-								Value: "",
-								Usage: "team id or slug to remove",
+							&cli.StringSliceFlag{
+								Name:    "team",
+								Aliases: []string{"t"},
+								Usage:   "desired team as id or slug with optional permission, like ops:admin",
+							},
+							&cli.BoolFlag{
+								Name:  "keep-extra",
+								Usage: "keep assigned teams which are not listed",
+							},
+							&cli.BoolFlag{
+								Name:  "dry-run",
+								Usage: "only show the plan without applying it",
+							},
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: "allow to leave teams without owner or to remove all teams",
 							},
 						},
 						Action: func(c *cli.Context) error {
-							return Handle(c, UserTeamRemove)
+							return Handle(c, UserTeamSync)
 						},
 					},
 				},
@@ -286,135 +385,81 @@ func User() *cli.Command {
 }
 
 // UserList provides the sub-command to list all users.
-func UserList(c *cli.Context, client *Client) error {
-	resp, err := client.User.ListUsers(
-		user.NewListUsersParams(),
-		client.AuthInfo,
-	)
+func UserList(ctx context.Context, c *cli.Context, client *Client) error {
+	return renderRecords(ctx, c, func(ctx context.Context) ([]interface{}, error) {
+		records, err := listUsers(ctx, client)
 
-	if err != nil {
-		switch val := err.(type) {
-		case *user.ListUsersForbidden:
-			return fmt.Errorf(*val.Payload.Message)
-		case *user.ListUsersDefault:
-			return fmt.Errorf(*val.Payload.Message)
-		default:
-			return PrettyError(err)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	if len(resp.Payload) == 0 {
-		fmt.Fprintln(os.Stderr, "empty result")
-		return nil
-	}
+		result := make([]interface{}, len(records))
 
-	tmpl, err := template.New(
-		"_",
-	).Funcs(
-		globalFuncMap,
-	).Funcs(
-		sprigFuncMap,
-	).Parse(
-		fmt.Sprintln(c.String("format")),
-	)
-
-	if err != nil {
-		return err
-	}
-
-	for _, record := range resp.Payload {
-		if err := tmpl.Execute(os.Stdout, record); err != nil {
-			return err
+		for i, record := range records {
+			result[i] = record
 		}
-	}
 
-	return nil
+		return result, nil
+	})
 }
 
 // UserShow provides the sub-command to show user details.
-func UserShow(c *cli.Context, client *Client) error {
-	resp, err := client.User.ShowUser(
-		user.NewShowUserParams().WithUserID(GetIdentifierParam(c)),
-		client.AuthInfo,
-	)
+func UserShow(ctx context.Context, c *cli.Context, client *Client) error {
+	return renderBatch(ctx, c, func(ctx context.Context, id string) ([]interface{}, error) {
+		record, err := showUser(ctx, client, id)
 
-	if err != nil {
-		switch val := err.(type) {
-		case *user.ShowUserForbidden:
-			return fmt.Errorf(*val.Payload.Message)
-		case *user.ShowUserNotFound:
-			return fmt.Errorf(*val.Payload.Message)
-		case *user.ShowUserDefault:
-			return fmt.Errorf(*val.Payload.Message)
-		default:
-			return PrettyError(err)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	tmpl, err := template.New(
-		"_",
-	).Funcs(
-		globalFuncMap,
-	).Funcs(
-		sprigFuncMap,
-	).Parse(
-		fmt.Sprintln(c.String("format")),
-	)
-
-	if err != nil {
-		return err
-	}
-
-	return tmpl.Execute(os.Stdout, resp.Payload)
+		return []interface{}{record}, nil
+	})
 }
 
 // UserDelete provides the sub-command to delete a user.
-func UserDelete(c *cli.Context, client *Client) error {
-	resp, err := client.User.DeleteUser(
-		user.NewDeleteUserParams().WithUserID(GetIdentifierParam(c)),
-		client.AuthInfo,
-	)
+func UserDelete(ctx context.Context, c *cli.Context, client *Client) error {
+	ids := GetIdentifierParams(c)
 
-	if err != nil {
-		switch val := err.(type) {
-		case *user.DeleteUserForbidden:
-			return fmt.Errorf(*val.Payload.Message)
-		case *user.DeleteUserNotFound:
-			return fmt.Errorf(*val.Payload.Message)
-		case *user.DeleteUserBadRequest:
-			return fmt.Errorf(*val.Payload.Message)
-		case *user.DeleteUserDefault:
-			return fmt.Errorf(*val.Payload.Message)
-		default:
-			return PrettyError(err)
+	if !c.Bool("force") {
+		demoted := make(map[string][]string)
+
+		for _, userID := range ids {
+			records, err := userTeams(ctx, client, userID)
+
+			if err != nil {
+				return err
+			}
+
+			for _, teamID := range ownedTeams(records) {
+				demoted[teamID] = append(demoted[teamID], userID)
+			}
+		}
+
+		if err := GuardBatchOwners(ctx, c, client, demoted); err != nil {
+			return err
 		}
 	}
 
-	fmt.Fprintln(os.Stderr, *resp.Payload.Message)
-	return nil
+	return runBatch(ctx, ids, func(ctx context.Context, userID string, stdout io.Writer, log *Logger) error {
+		msg, err := userDelete(ctx, client, userID)
+
+		if err != nil {
+			return err
+		}
+
+		log.Info(msg)
+		return nil
+	})
 }
 
 // UserUpdate provides the sub-command to update a user.
-func UserUpdate(c *cli.Context, client *Client) error {
-	resp, err := client.User.ShowUser(
-		user.NewShowUserParams().WithUserID(GetIdentifierParam(c)),
-		client.AuthInfo,
-	)
+func UserUpdate(ctx context.Context, c *cli.Context, client *Client) error {
+	record, err := showUser(ctx, client, GetIdentifierParam(c))
 
 	if err != nil {
-		switch val := err.(type) {
-		case *user.ShowUserForbidden:
-			return fmt.Errorf(*val.Payload.Message)
-		case *user.ShowUserNotFound:
-			return fmt.Errorf(*val.Payload.Message)
-		case *user.ShowUserDefault:
-			return fmt.Errorf(*val.Payload.Message)
-		default:
-			return PrettyError(err)
-		}
+		return err
 	}
 
-	record := resp.Payload
 	changed := false
 
 	if val := c.String("slug"); c.IsSet("slug") && val != *record.Slug {
@@ -432,9 +477,15 @@ func UserUpdate(c *cli.Context, client *Client) error {
 		changed = true
 	}
 
-	if val := c.String("password"); c.IsSet("password") {
-		password := strfmt.Password(val)
-		record.Password = &password
+	password, generated, err := resolvePassword(c, *record.Username, *record.Email)
+
+	if err != nil {
+		return err
+	}
+
+	if password != "" {
+		val := strfmt.Password(password)
+		record.Password = &val
 		changed = true
 	}
 
@@ -451,40 +502,24 @@ func UserUpdate(c *cli.Context, client *Client) error {
 	}
 
 	if changed {
-		if err := record.Validate(strfmt.Default); err != nil {
-			return ValidateError(err)
+		if err := userUpdate(ctx, client, record); err != nil {
+			return err
 		}
 
-		_, err := client.User.UpdateUser(
-			user.NewUpdateUserParams().WithUserID(record.ID.String()).WithUser(record),
-			client.AuthInfo,
-		)
+		logger.Info("successfully update")
 
-		if err != nil {
-			switch val := err.(type) {
-			case *user.UpdateUserForbidden:
-				return fmt.Errorf(*val.Payload.Message)
-			case *user.UpdateUserNotFound:
-				return fmt.Errorf(*val.Payload.Message)
-			case *user.UpdateUserDefault:
-				return fmt.Errorf(*val.Payload.Message)
-			case *user.UpdateUserUnprocessableEntity:
-				return ValidateError(*val.Payload)
-			default:
-				return PrettyError(err)
-			}
+		if generated {
+			return handoutPassword(c, password)
 		}
-
-		fmt.Fprintln(os.Stderr, "successfully update")
 	} else {
-		fmt.Fprintln(os.Stderr, "nothing to update...")
+		logger.Info("nothing to update...")
 	}
 
 	return nil
 }
 
 // UserCreate provides the sub-command to create a user.
-func UserCreate(c *cli.Context, client *Client) error {
+func UserCreate(ctx context.Context, c *cli.Context, client *Client) error {
 	record := &models.User{}
 
 	if val := c.String("slug"); c.IsSet("slug") && val != "" {
@@ -503,11 +538,17 @@ func UserCreate(c *cli.Context, client *Client) error {
 		return fmt.Errorf("you must provide an username")
 	}
 
-	if val := c.String("password"); c.IsSet("password") && val != "" {
-		password := strfmt.Password(val)
-		record.Password = &password
+	password, generated, err := resolvePassword(c, *record.Username, *record.Email)
+
+	if err != nil {
+		return err
+	}
+
+	if password != "" {
+		val := strfmt.Password(password)
+		record.Password = &val
 	} else {
-		return fmt.Errorf("you must provide a password")
+		return fmt.Errorf("you must provide or generate a password")
 	}
 
 	if c.IsSet("active") {
@@ -520,87 +561,505 @@ func UserCreate(c *cli.Context, client *Client) error {
 		record.Admin = &val
 	}
 
+	if _, err := userCreate(ctx, client, record); err != nil {
+		return err
+	}
+
+	logger.Info("successfully created")
+
+	if generated {
+		return handoutPassword(c, password)
+	}
+
+	return nil
+}
+
+// UserTeamList provides the sub-command to list teams of the user.
+func UserTeamList(ctx context.Context, c *cli.Context, client *Client) error {
+	return renderBatch(ctx, c, func(ctx context.Context, id string) ([]interface{}, error) {
+		records, err := userTeams(ctx, client, id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]interface{}, len(records))
+
+		for i, record := range records {
+			result[i] = record
+		}
+
+		return result, nil
+	})
+}
+
+// UserTeamAppend provides the sub-command to append a team to the user.
+func UserTeamAppend(ctx context.Context, c *cli.Context, client *Client) error {
+	teamID := GetTeamParam(c)
+	perm := GetPermParam(c)
+
+	return runBatch(ctx, GetIdentifierParams(c), func(ctx context.Context, userID string, stdout io.Writer, log *Logger) error {
+		msg, err := userTeamAppend(ctx, client, userID, teamID, perm)
+
+		if err != nil {
+			return err
+		}
+
+		log.Info(msg)
+		return nil
+	})
+}
+
+// UserTeamPerm provides the sub-command to update user team permissions.
+func UserTeamPerm(ctx context.Context, c *cli.Context, client *Client) error {
+	teamID := GetTeamParam(c)
+	perm := GetPermParam(c)
+	ids := GetIdentifierParams(c)
+
+	if perm != "owner" {
+		if err := GuardBatchOwners(ctx, c, client, map[string][]string{teamID: ids}); err != nil {
+			return err
+		}
+	}
+
+	return runBatch(ctx, ids, func(ctx context.Context, userID string, stdout io.Writer, log *Logger) error {
+		msg, err := userTeamPerm(ctx, client, userID, teamID, perm)
+
+		if err != nil {
+			return err
+		}
+
+		log.Info(msg)
+		return nil
+	})
+}
+
+// UserTeamRemove provides the sub-command to remove a team from the user.
+func UserTeamRemove(ctx context.Context, c *cli.Context, client *Client) error {
+	teamID := GetTeamParam(c)
+	ids := GetIdentifierParams(c)
+
+	if err := GuardBatchOwners(ctx, c, client, map[string][]string{teamID: ids}); err != nil {
+		return err
+	}
+
+	return runBatch(ctx, ids, func(ctx context.Context, userID string, stdout io.Writer, log *Logger) error {
+		msg, err := userTeamRemove(ctx, client, userID, teamID)
+
+		if err != nil {
+			return err
+		}
+
+		log.Info(msg)
+		return nil
+	})
+}
+
+// UserTeamSync provides the sub-command to reconcile teams of the user.
+func UserTeamSync(ctx context.Context, c *cli.Context, client *Client) error {
+	userID := GetIdentifierParam(c)
+	desired, err := parseTeamPerms(c.StringSlice("team"))
+
+	if err != nil {
+		return err
+	}
+
+	current, err := userTeams(ctx, client, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if len(desired) == 0 && !c.Bool("keep-extra") && !c.Bool("force") {
+		return fmt.Errorf("no desired teams given, this would remove all memberships, use --force to proceed")
+	}
+
+	plan := planUserTeamSync(current, desired, c.Bool("keep-extra"))
+
+	if len(plan) == 0 {
+		logger.Info("nothing to sync...")
+		return nil
+	}
+
+	for _, change := range plan {
+		fmt.Fprintln(os.Stdout, change)
+	}
+
+	if c.Bool("dry-run") {
+		return nil
+	}
+
+	if !c.Bool("force") {
+		members := make(map[string][]*models.TeamUser)
+		plans := make(map[string][]*membershipChange)
+
+		for _, change := range plan {
+			if change.Action == "append" {
+				continue
+			}
+
+			records, err := teamUsers(ctx, client, change.Target)
+
+			if err != nil {
+				return err
+			}
+
+			members[change.Target] = records
+			plans[change.Target] = []*membershipChange{{
+				Action: change.Action,
+				Target: userID,
+				From:   change.From,
+				To:     change.To,
+			}}
+		}
+
+		if err := GuardTeamOwners(c, members, plans); err != nil {
+			return err
+		}
+	}
+
+	for i, change := range plan {
+		if ctx.Err() != nil {
+			return fmt.Errorf("interrupted after %d of %d changes", i, len(plan))
+		}
+
+		var (
+			msg string
+			err error
+		)
+
+		switch change.Action {
+		case "append":
+			msg, err = userTeamAppend(ctx, client, userID, change.Target, change.To)
+		case "perm":
+			msg, err = userTeamPerm(ctx, client, userID, change.Target, change.To)
+		case "remove":
+			msg, err = userTeamRemove(ctx, client, userID, change.Target)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to %s after %d of %d changes: %s", change, i, len(plan), err)
+		}
+
+		logger.Info(msg)
+	}
+
+	return nil
+}
+
+// membershipChange represents a single step to reconcile memberships.
+type membershipChange struct {
+	Action string
+	Target string
+	From   string
+	To     string
+}
+
+// String implements the fmt.Stringer interface.
+func (m *membershipChange) String() string {
+	switch m.Action {
+	case "append":
+		return fmt.Sprintf("append %s as %s", m.Target, m.To)
+	case "perm":
+		return fmt.Sprintf("perm %s from %s to %s", m.Target, m.From, m.To)
+	default:
+		return fmt.Sprintf("remove %s", m.Target)
+	}
+}
+
+// parseTeamPerms parses team definitions like ops:admin, the permission
+// defaults to user if it is omitted.
+func parseTeamPerms(values []string) ([][2]string, error) {
+	result := make([][2]string, 0, len(values))
+	seen := make(map[string]bool)
+
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		teamID, perm := parts[0], "user"
+
+		if len(parts) == 2 {
+			perm = parts[1]
+		}
+
+		if teamID == "" {
+			return nil, fmt.Errorf("invalid team definition %q", value)
+		}
+
+		if !validPerm(perm) {
+			return nil, fmt.Errorf("invalid permission for %s, can be user, admin or owner", teamID)
+		}
+
+		if seen[teamID] {
+			return nil, fmt.Errorf("team %s is defined multiple times", teamID)
+		}
+
+		seen[teamID] = true
+		result = append(result, [2]string{teamID, perm})
+	}
+
+	return result, nil
+}
+
+// planUserTeamSync calculates the minimal changes to reach the desired teams.
+func planUserTeamSync(current []*models.TeamUser, desired [][2]string, keepExtra bool) []*membershipChange {
+	return planMembershipSync(current, desired, keepExtra, func(record *models.TeamUser) (string, string, bool) {
+		if record.Team == nil {
+			return "", "", false
+		}
+
+		slug := ""
+
+		if record.Team.Slug != nil {
+			slug = *record.Team.Slug
+		}
+
+		return record.Team.ID.String(), slug, true
+	})
+}
+
+// planTeamUserSync calculates the minimal changes to reach the desired users.
+func planTeamUserSync(current []*models.TeamUser, desired [][2]string, keepExtra bool) []*membershipChange {
+	return planMembershipSync(current, desired, keepExtra, func(record *models.TeamUser) (string, string, bool) {
+		if record.User == nil {
+			return "", "", false
+		}
+
+		slug := ""
+
+		if record.User.Slug != nil {
+			slug = *record.User.Slug
+		}
+
+		return record.User.ID.String(), slug, true
+	})
+}
+
+// planMembershipSync calculates the minimal changes to reach the desired
+// memberships, the key function resolves the id and slug of the other side.
+func planMembershipSync(current []*models.TeamUser, desired [][2]string, keepExtra bool, key func(*models.TeamUser) (string, string, bool)) []*membershipChange {
+	result := make([]*membershipChange, 0)
+	matched := make(map[*models.TeamUser]bool)
+
+	for _, want := range desired {
+		var found *models.TeamUser
+
+		for _, record := range current {
+			id, slug, ok := key(record)
+
+			if !ok {
+				continue
+			}
+
+			if id == want[0] || (slug != "" && slug == want[0]) {
+				found = record
+				break
+			}
+		}
+
+		if found == nil {
+			result = append(result, &membershipChange{
+				Action: "append",
+				Target: want[0],
+				To:     want[1],
+			})
+
+			continue
+		}
+
+		matched[found] = true
+
+		if found.Perm == nil || *found.Perm != want[1] {
+			from := ""
+
+			if found.Perm != nil {
+				from = *found.Perm
+			}
+
+			result = append(result, &membershipChange{
+				Action: "perm",
+				Target: want[0],
+				From:   from,
+				To:     want[1],
+			})
+		}
+	}
+
+	if keepExtra {
+		return result
+	}
+
+	for _, record := range current {
+		id, slug, ok := key(record)
+
+		if matched[record] || !ok {
+			continue
+		}
+
+		if slug != "" {
+			id = slug
+		}
+
+		result = append(result, &membershipChange{
+			Action: "remove",
+			Target: id,
+		})
+	}
+
+	return result
+}
+
+// showUser fetches a single user by id or slug.
+func showUser(ctx context.Context, client *Client, id string) (*models.User, error) {
+	resp, err := client.User.ShowUser(
+		user.NewShowUserParams().WithContext(ctx).WithUserID(id),
+		client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *user.ShowUserForbidden:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *user.ShowUserNotFound:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *user.ShowUserDefault:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		default:
+			return nil, PrettyError(err)
+		}
+	}
+
+	return resp.Payload, nil
+}
+
+// userCreate validates and creates a new user.
+func userCreate(ctx context.Context, client *Client, record *models.User) (*models.User, error) {
 	if err := record.Validate(strfmt.Default); err != nil {
-		return ValidateError(err)
+		return nil, ValidateError(err)
 	}
 
-	_, err := client.User.CreateUser(
-		user.NewCreateUserParams().WithUser(record),
+	resp, err := client.User.CreateUser(
+		user.NewCreateUserParams().WithContext(ctx).WithUser(record),
 		client.AuthInfo,
 	)
 
 	if err != nil {
 		switch val := err.(type) {
 		case *user.CreateUserForbidden:
-			return fmt.Errorf(*val.Payload.Message)
+			return nil, fmt.Errorf(*val.Payload.Message)
 		case *user.CreateUserDefault:
-			return fmt.Errorf(*val.Payload.Message)
+			return nil, fmt.Errorf(*val.Payload.Message)
 		case *user.CreateUserUnprocessableEntity:
-			return ValidateError(*val.Payload)
+			return nil, ValidateError(*val.Payload)
 		default:
-			return PrettyError(err)
+			return nil, PrettyError(err)
 		}
 	}
 
-	fmt.Fprintln(os.Stderr, "successfully created")
-	return nil
+	return resp.Payload, nil
 }
 
-// UserTeamList provides the sub-command to list teams of the user.
-func UserTeamList(c *cli.Context, client *Client) error {
-	resp, err := client.User.ListUserTeams(
-		user.NewListUserTeamsParams().WithUserID(GetIdentifierParam(c)),
+// userUpdate validates and updates an existing user.
+func userUpdate(ctx context.Context, client *Client, record *models.User) error {
+	if err := record.Validate(strfmt.Default); err != nil {
+		return ValidateError(err)
+	}
+
+	_, err := client.User.UpdateUser(
+		user.NewUpdateUserParams().WithContext(ctx).WithUserID(record.ID.String()).WithUser(record),
 		client.AuthInfo,
 	)
 
 	if err != nil {
 		switch val := err.(type) {
-		case *user.ListUserTeamsForbidden:
+		case *user.UpdateUserForbidden:
 			return fmt.Errorf(*val.Payload.Message)
-		case *user.ListUserTeamsNotFound:
+		case *user.UpdateUserNotFound:
 			return fmt.Errorf(*val.Payload.Message)
-		case *user.ListUserTeamsDefault:
+		case *user.UpdateUserDefault:
 			return fmt.Errorf(*val.Payload.Message)
+		case *user.UpdateUserUnprocessableEntity:
+			return ValidateError(*val.Payload)
 		default:
 			return PrettyError(err)
 		}
 	}
 
-	if len(resp.Payload) == 0 {
-		fmt.Fprintln(os.Stderr, "empty result")
-		return nil
-	}
+	return nil
+}
 
-	tmpl, err := template.New(
-		"_",
-	).Funcs(
-		globalFuncMap,
-	).Funcs(
-		sprigFuncMap,
-	).Parse(
-		fmt.Sprintln(c.String("format")),
+// userDelete deletes a single user by id or slug.
+func userDelete(ctx context.Context, client *Client, id string) (string, error) {
+	resp, err := client.User.DeleteUser(
+		user.NewDeleteUserParams().WithContext(ctx).WithUserID(id),
+		client.AuthInfo,
 	)
 
 	if err != nil {
-		return err
+		switch val := err.(type) {
+		case *user.DeleteUserForbidden:
+			return "", fmt.Errorf(*val.Payload.Message)
+		case *user.DeleteUserNotFound:
+			return "", fmt.Errorf(*val.Payload.Message)
+		case *user.DeleteUserBadRequest:
+			return "", fmt.Errorf(*val.Payload.Message)
+		case *user.DeleteUserDefault:
+			return "", fmt.Errorf(*val.Payload.Message)
+		default:
+			return "", PrettyError(err)
+		}
 	}
 
-	for _, record := range resp.Payload {
-		if err := tmpl.Execute(os.Stdout, record); err != nil {
-			return err
+	return *resp.Payload.Message, nil
+}
+
+// listUsers fetches all available users.
+func listUsers(ctx context.Context, client *Client) ([]*models.User, error) {
+	resp, err := client.User.ListUsers(
+		user.NewListUsersParams().WithContext(ctx),
+		client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *user.ListUsersForbidden:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *user.ListUsersDefault:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		default:
+			return nil, PrettyError(err)
 		}
 	}
 
-	return nil
+	return resp.Payload, nil
 }
 
-// UserTeamAppend provides the sub-command to append a team to the user.
-func UserTeamAppend(c *cli.Context, client *Client) error {
-	teamID := GetTeamParam(c)
-	perm := GetPermParam(c)
+// userTeams fetches the team assignments of a user.
+func userTeams(ctx context.Context, client *Client, userID string) ([]*models.TeamUser, error) {
+	resp, err := client.User.ListUserTeams(
+		user.NewListUserTeamsParams().WithContext(ctx).WithUserID(userID),
+		client.AuthInfo,
+	)
+
+	if err != nil {
+		switch val := err.(type) {
+		case *user.ListUserTeamsForbidden:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *user.ListUserTeamsNotFound:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		case *user.ListUserTeamsDefault:
+			return nil, fmt.Errorf(*val.Payload.Message)
+		default:
+			return nil, PrettyError(err)
+		}
+	}
+
+	return resp.Payload, nil
+}
 
+// userTeamAppend assigns a team with a permission to a user.
+func userTeamAppend(ctx context.Context, client *Client, userID, teamID, perm string) (string, error) {
 	resp, err := client.User.AppendUserToTeam(
-		user.NewAppendUserToTeamParams().WithUserID(GetIdentifierParam(c)).WithUserTeam(
+		user.NewAppendUserToTeamParams().WithContext(ctx).WithUserID(userID).WithUserTeam(
 			&models.UserTeamParams{
 				Team: &teamID,
 				Perm: &perm,
@@ -612,33 +1071,29 @@ func UserTeamAppend(c *cli.Context, client *Client) error {
 	if err != nil {
 		switch val := err.(type) {
 		case *user.AppendUserToTeamForbidden:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *user.AppendUserToTeamNotFound:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *user.AppendUserToTeamPreconditionFailed:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 
 		case *user.AppendUserToTeamUnprocessableEntity:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 
 		case *user.AppendUserToTeamDefault:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		default:
-			return PrettyError(err)
+			return "", PrettyError(err)
 		}
 	}
 
-	fmt.Fprintln(os.Stderr, *resp.Payload.Message)
-	return nil
+	return *resp.Payload.Message, nil
 }
 
-// UserTeamPerm provides the sub-command to update user team permissions.
-func UserTeamPerm(c *cli.Context, client *Client) error {
-	teamID := GetTeamParam(c)
-	perm := GetPermParam(c)
-
+// userTeamPerm updates the permission of a user within a team.
+func userTeamPerm(ctx context.Context, client *Client, userID, teamID, perm string) (string, error) {
 	resp, err := client.User.PermitUserTeam(
-		user.NewPermitUserTeamParams().WithUserID(GetIdentifierParam(c)).WithUserTeam(
+		user.NewPermitUserTeamParams().WithContext(ctx).WithUserID(userID).WithUserTeam(
 			&models.UserTeamParams{
 				Team: &teamID,
 				Perm: &perm,
@@ -650,33 +1105,31 @@ func UserTeamPerm(c *cli.Context, client *Client) error {
 	if err != nil {
 		switch val := err.(type) {
 		case *user.PermitUserTeamForbidden:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *user.PermitUserTeamNotFound:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *user.PermitUserTeamPreconditionFailed:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 
 		case *user.PermitUserTeamUnprocessableEntity:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 
 		case *user.PermitUserTeamDefault:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		default:
-			return PrettyError(err)
+			return "", PrettyError(err)
 		}
 	}
 
-	fmt.Fprintln(os.Stderr, *resp.Payload.Message)
-	return nil
+	return *resp.Payload.Message, nil
 }
 
-// UserTeamRemove provides the sub-command to remove a team from the user.
-func UserTeamRemove(c *cli.Context, client *Client) error {
-	teamID := GetTeamParam(c)
+// userTeamRemove removes a team assignment from a user.
+func userTeamRemove(ctx context.Context, client *Client, userID, teamID string) (string, error) {
 	perm := "user"
 
 	resp, err := client.User.DeleteUserFromTeam(
-		user.NewDeleteUserFromTeamParams().WithUserID(GetIdentifierParam(c)).WithUserTeam(
+		user.NewDeleteUserFromTeamParams().WithContext(ctx).WithUserID(userID).WithUserTeam(
 			&models.UserTeamParams{
 				Team: &teamID,
 				Perm: &perm,
@@ -688,18 +1141,17 @@ func UserTeamRemove(c *cli.Context, client *Client) error {
 	if err != nil {
 		switch val := err.(type) {
 		case *user.DeleteUserFromTeamForbidden:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *user.DeleteUserFromTeamNotFound:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *user.DeleteUserFromTeamPreconditionFailed:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		case *user.DeleteUserFromTeamDefault:
-			return fmt.Errorf(*val.Payload.Message)
+			return "", fmt.Errorf(*val.Payload.Message)
 		default:
-			return PrettyError(err)
+			return "", PrettyError(err)
 		}
 	}
 
-	fmt.Fprintln(os.Stderr, *resp.Payload.Message)
-	return nil
+	return *resp.Payload.Message, nil
 }
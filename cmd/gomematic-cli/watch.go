@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gomematic/gomematic-go/models"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// FetchFunc fetches the records rendered by list and show commands.
+type FetchFunc func(ctx context.Context) ([]interface{}, error)
+
+// watchIgnored defines fields which are not reported as change on their own.
+var watchIgnored = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+}
+
+// watchEntry represents a single record within a watch iteration.
+type watchEntry struct {
+	Key    string
+	Label  string
+	Fields map[string]interface{}
+	Record interface{}
+}
+
+// watchEvent represents a single difference between two iterations.
+type watchEvent struct {
+	Action  string
+	Entry   *watchEntry
+	Changes []string
+}
+
+// String implements the fmt.Stringer interface.
+func (e *watchEvent) String() string {
+	if len(e.Changes) == 0 {
+		return fmt.Sprintf("%s %s", e.Action, e.Entry.Label)
+	}
+
+	return fmt.Sprintf("%s %s %s", e.Action, e.Entry.Label, strings.Join(e.Changes, " "))
+}
+
+// renderRecords fetches the records and renders them with the format
+// template, if the watch flag is set the records get refreshed until the
+// command gets interrupted.
+func renderRecords(ctx context.Context, c *cli.Context, fetch FetchFunc) error {
+	tmpl, err := parseFormat(c)
+
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("watch") {
+		return watchRecords(ctx, c, tmpl, fetch)
+	}
+
+	records, err := fetch(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if len(records) == 0 {
+		logger.Info("empty result")
+		return nil
+	}
+
+	for _, record := range records {
+		if err := tmpl.Execute(os.Stdout, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseFormat parses the format template of the command.
+func parseFormat(c *cli.Context) (*template.Template, error) {
+	return template.New(
+		"_",
+	).Funcs(
+		globalFuncMap,
+	).Funcs(
+		sprigFuncMap,
+	).Parse(
+		fmt.Sprintln(c.String("format")),
+	)
+}
+
+// watchRecords refreshes the records periodically. On a terminal the whole
+// output gets redrawn with highlighted changes, otherwise the initial
+// records are followed by change events only.
+func watchRecords(ctx context.Context, c *cli.Context, tmpl *template.Template, fetch FetchFunc) error {
+	interval := c.Duration("interval")
+
+	if interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	tty := isTerminal(os.Stdout)
+	title := strings.Join(commandPath(c), " ")
+
+	var previous []*watchEntry
+
+	for first := true; ; first = false {
+		records, err := fetch(ctx)
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			if tty {
+				fmt.Fprint(os.Stdout, "\x1b[H\x1b[2J")
+				fmt.Fprintf(os.Stdout, "Every %s: %s, %s\n\n", interval, title, time.Now().Format("15:04:05"))
+			}
+
+			logger.Error(err.Error())
+		} else {
+			current := watchEntries(records)
+			events := diffWatchEntries(previous, current)
+
+			switch {
+			case tty:
+				if err := redrawWatch(tmpl, title, interval, current, events, first); err != nil {
+					return err
+				}
+			case first:
+				for _, entry := range current {
+					if err := tmpl.Execute(os.Stdout, entry.Record); err != nil {
+						return err
+					}
+				}
+			default:
+				for _, event := range events {
+					fmt.Fprintf(os.Stdout, "%s %s\n", time.Now().Format(time.RFC3339), event)
+				}
+			}
+
+			previous = current
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// redrawWatch clears the terminal and renders all records, added and
+// changed records are highlighted and removed records are appended.
+func redrawWatch(tmpl *template.Template, title string, interval time.Duration, current []*watchEntry, events []*watchEvent, first bool) error {
+	var buf bytes.Buffer
+
+	buf.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&buf, "Every %s: %s, %s\n\n", interval, title, time.Now().Format("15:04:05"))
+
+	marks := make(map[string]*watchEvent, len(events))
+
+	for _, event := range events {
+		marks[event.Entry.Key] = event
+	}
+
+	if len(current) == 0 {
+		buf.WriteString("empty result\n")
+	}
+
+	for _, entry := range current {
+		if event, ok := marks[entry.Key]; ok && !first {
+			switch event.Action {
+			case "added":
+				buf.WriteString("\x1b[32m[added]\x1b[0m\n")
+			case "changed":
+				fmt.Fprintf(&buf, "\x1b[33m[changed %s]\x1b[0m\n", strings.Join(event.Changes, " "))
+			}
+		}
+
+		if err := tmpl.Execute(&buf, entry.Record); err != nil {
+			return err
+		}
+	}
+
+	for _, event := range events {
+		if event.Action != "removed" {
+			continue
+		}
+
+		buf.WriteString("\x1b[31m[removed]\x1b[0m\n")
+
+		if err := tmpl.Execute(&buf, event.Entry.Record); err != nil {
+			return err
+		}
+	}
+
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+// watchEntries converts the records to comparable entries.
+func watchEntries(records []interface{}) []*watchEntry {
+	result := make([]*watchEntry, 0, len(records))
+
+	for _, record := range records {
+		fields := make(map[string]interface{})
+
+		if content, err := json.Marshal(record); err == nil {
+			json.Unmarshal(content, &fields)
+		}
+
+		key, label := watchIdentity(record)
+
+		result = append(result, &watchEntry{
+			Key:    key,
+			Label:  label,
+			Fields: fields,
+			Record: record,
+		})
+	}
+
+	return result
+}
+
+// diffWatchEntries detects added, changed and removed entries, without
+// previous entries nothing gets reported.
+func diffWatchEntries(previous, current []*watchEntry) []*watchEvent {
+	result := make([]*watchEvent, 0)
+
+	if previous == nil {
+		return result
+	}
+
+	before := make(map[string]*watchEntry, len(previous))
+
+	for _, entry := range previous {
+		before[entry.Key] = entry
+	}
+
+	seen := make(map[string]bool, len(current))
+
+	for _, entry := range current {
+		seen[entry.Key] = true
+		old, ok := before[entry.Key]
+
+		if !ok {
+			result = append(result, &watchEvent{
+				Action: "added",
+				Entry:  entry,
+			})
+
+			continue
+		}
+
+		if changes := diffWatchFields(old.Fields, entry.Fields); len(changes) > 0 {
+			result = append(result, &watchEvent{
+				Action:  "changed",
+				Entry:   entry,
+				Changes: changes,
+			})
+		}
+	}
+
+	for _, entry := range previous {
+		if !seen[entry.Key] {
+			result = append(result, &watchEvent{
+				Action: "removed",
+				Entry:  entry,
+			})
+		}
+	}
+
+	return result
+}
+
+// diffWatchFields lists the changed top-level fields like perm=user->admin.
+func diffWatchFields(before, after map[string]interface{}) []string {
+	keys := make([]string, 0, len(after))
+
+	for key := range before {
+		keys = append(keys, key)
+	}
+
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	result := make([]string, 0)
+
+	for _, key := range keys {
+		if watchIgnored[key] || reflect.DeepEqual(before[key], after[key]) {
+			continue
+		}
+
+		old, oldOK := watchScalar(before[key])
+		val, valOK := watchScalar(after[key])
+
+		if oldOK && valOK {
+			result = append(result, fmt.Sprintf("%s=%s->%s", key, old, val))
+		} else {
+			result = append(result, key)
+		}
+	}
+
+	return result
+}
+
+// watchScalar formats simple values, nested values are not formatted.
+func watchScalar(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case nil:
+		return "none", true
+	case string, bool, float64:
+		return fmt.Sprintf("%v", v), true
+	default:
+		return "", false
+	}
+}
+
+// watchIdentity returns a stable key and a readable label of the record.
+func watchIdentity(record interface{}) (string, string) {
+	switch val := record.(type) {
+	case *models.User:
+		return val.ID.String(), stringValue(val.Slug, val.ID.String())
+	case *models.Team:
+		return val.ID.String(), stringValue(val.Slug, val.ID.String())
+	case *models.Profile:
+		return val.ID.String(), stringValue(val.Slug, val.ID.String())
+	case *models.TeamUser:
+		teamKey, userKey := "", ""
+		labels := make([]string, 0, 2)
+
+		if val.TeamID != nil {
+			teamKey = val.TeamID.String()
+		}
+
+		if val.UserID != nil {
+			userKey = val.UserID.String()
+		}
+
+		if val.Team != nil {
+			teamKey = val.Team.ID.String()
+			labels = append(labels, stringValue(val.Team.Slug, teamKey))
+		}
+
+		if val.User != nil {
+			userKey = val.User.ID.String()
+			labels = append(labels, stringValue(val.User.Slug, userKey))
+		}
+
+		if len(labels) == 0 {
+			labels = append(labels, teamKey, userKey)
+		}
+
+		return teamKey + "/" + userKey, strings.Join(labels, "/")
+	default:
+		return fmt.Sprintf("%p", record), fmt.Sprintf("%v", record)
+	}
+}
+
+// stringValue dereferences the string or returns the fallback.
+func stringValue(val *string, fallback string) string {
+	if val == nil {
+		return fallback
+	}
+
+	return *val
+}
+
+// isTerminal checks if the file is connected to a terminal.
+func isTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}